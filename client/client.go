@@ -0,0 +1,249 @@
+// Package client is a typed Go client for the users API. It speaks the
+// REST API's JSON envelope, scopes every call to one organization, and
+// retries calls that are safe to repeat.
+//
+//	c := client.New("https://ips2.obi.ninja/api")
+//	c.Organization = "acme"
+//	user, err := c.GetUserByUsername(ctx, "ada")
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the users API. Set its fields before the first call; a
+// Client is safe for concurrent use after that.
+type Client struct {
+	// BaseURL is the API root, e.g. https://ips2.obi.ninja/api.
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Token is sent as a bearer token whose org claim names the
+	// organization. Organization is sent as X-Organization instead, for
+	// deployments without signed tokens.
+	Token        string
+	Organization string
+	// Actor names the operator in the server's audit log.
+	Actor string
+
+	// Timeout bounds each attempt of a call; the caller's context bounds
+	// the call as a whole.
+	Timeout time.Duration
+	// MaxRetries is how many times a GET, PUT or DELETE is repeated after
+	// a network error, 429 or 502-504. Creates are never retried, since a
+	// repeat could fail with a conflict after the first one succeeded.
+	MaxRetries int
+	// RetryWait is the wait before the first retry. It doubles on every
+	// retry, up to MaxRetryWait, unless the server sends Retry-After.
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+}
+
+// New returns a Client for the API at baseURL with default timeouts and
+// retries.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		HTTPClient:   &http.Client{},
+		Timeout:      10 * time.Second,
+		MaxRetries:   2,
+		RetryWait:    200 * time.Millisecond,
+		MaxRetryWait: 5 * time.Second,
+	}
+}
+
+// envelope is the server's response body.
+type envelope struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   struct {
+		Error string `json:"error"`
+	} `json:"error"`
+}
+
+// do sends a request with body encoded as JSON, retrying it when allowed,
+// and decodes the response's data into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	// every attempt shares one request ID, so the server logs show retries
+	requestID := newRequestID()
+
+	retries := c.MaxRetries
+	if method == http.MethodPost {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(ctx, method, target, requestID, payload)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if attempt >= retries {
+				return err
+			}
+			if err := c.wait(ctx, attempt, ""); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if retryable(resp.StatusCode) && attempt < retries {
+			resp.Body.Close()
+			if err := c.wait(ctx, attempt, resp.Header.Get("Retry-After")); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return decode(resp, out)
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, target, requestID string, payload []byte) (*http.Response, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		// the body is read before the response is returned
+		defer cancel()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Request-ID", requestID)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Organization != "" {
+		req.Header.Set("X-Organization", c.Organization)
+	}
+	if c.Actor != "" {
+		req.Header.Set("X-Actor", c.Actor)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// read the body while the attempt's deadline still applies
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+
+	return resp, nil
+}
+
+// wait sleeps before retry number attempt+1, for Retry-After seconds when
+// the server sent it.
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter string) error {
+	delay := c.RetryWait << attempt
+	if c.MaxRetryWait > 0 && delay > c.MaxRetryWait {
+		delay = c.MaxRetryWait
+	}
+	// jitter spreads out clients that failed together
+	if delay > 0 {
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// decode reads the envelope of resp, returning an *Error for error
+// responses.
+func decode(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil && !errors.Is(err, io.EOF) {
+		if resp.StatusCode >= 400 {
+			// e.g. a proxy's error page
+			return &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		}
+		return err
+	}
+
+	if resp.StatusCode >= 400 || env.Status == "error" {
+		return &Error{StatusCode: resp.StatusCode, Message: env.Message, Detail: env.Error.Error}
+	}
+
+	if out == nil || len(env.Data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(env.Data, out)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := New(server.URL + "/api")
+	c.Organization = "acme"
+	c.RetryWait = time.Millisecond
+	return c
+}
+
+func TestCreateUser(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST /api/users/", r.Method+" "+r.URL.Path)
+		assert.Equal(t, "acme", r.Header.Get("X-Organization"))
+		assert.NotEmpty(t, r.Header.Get("X-Request-ID"))
+
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]any{"username": "ada", "email": "ada@example.com"}, body)
+
+		w.Write([]byte(`{"status":"success","message":"User created successfully.","data":{"user":{"id":7,"username":"ada","email":"ada@example.com","status":"active"}}}`))
+	})
+
+	user, err := c.CreateUser(context.Background(), User{ID: 3, Username: "ada", Email: "ada@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, &User{ID: 7, Username: "ada", Email: "ada@example.com", Status: "active"}, user)
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		body    string
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name:    "User not found",
+			code:    http.StatusBadRequest,
+			body:    `{"status":"error","message":"User does not exist.","data":null}`,
+			wantErr: ErrNotFound,
+			wantMsg: "users api: 400 User does not exist.",
+		},
+		{
+			name:    "Username taken",
+			code:    http.StatusBadRequest,
+			body:    `{"status":"error","message":"Username has been taken!","data":null}`,
+			wantErr: ErrUsernameTaken,
+			wantMsg: "users api: 400 Username has been taken!",
+		},
+		{
+			name:    "Bad token",
+			code:    http.StatusUnauthorized,
+			body:    `{"status":"error","message":"Organization token not valid."}`,
+			wantErr: ErrUnauthorized,
+			wantMsg: "users api: 401 Organization token not valid.",
+		},
+		{
+			name:    "Server error with detail",
+			code:    http.StatusInternalServerError,
+			body:    `{"status":"error","message":"Failed to retrieve user.","data":null,"error":{"error":"connection refused"}}`,
+			wantErr: ErrServer,
+			wantMsg: "users api: 500 Failed to retrieve user.: connection refused",
+		},
+		{
+			name:    "Proxy error page",
+			code:    http.StatusBadGateway,
+			body:    `<html>Bad Gateway</html>`,
+			wantErr: ErrServer,
+			wantMsg: "users api: 502 Bad Gateway",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.code)
+				w.Write([]byte(test.body))
+			})
+			c.MaxRetries = 0
+
+			_, err := c.GetUser(context.Background(), 1)
+
+			var apiErr *Error
+			assert.True(t, errors.As(err, &apiErr))
+			assert.ErrorIs(t, err, test.wantErr)
+			assert.EqualError(t, err, test.wantMsg)
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		codes        []int
+		wantErr      error
+		wantAttempts int32
+	}{
+		{
+			name:         "Retry GET until it succeeds",
+			method:       http.MethodGet,
+			codes:        []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: 3,
+		},
+		{
+			name:         "Give up after MaxRetries",
+			method:       http.MethodDelete,
+			codes:        []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			wantErr:      ErrRateLimited,
+			wantAttempts: 3,
+		},
+		{
+			name:         "Never retry POST",
+			method:       http.MethodPost,
+			codes:        []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantErr:      ErrServer,
+			wantAttempts: 1,
+		},
+		{
+			name:         "Don't retry client errors",
+			method:       http.MethodGet,
+			codes:        []int{http.StatusBadRequest, http.StatusOK},
+			wantErr:      ErrInvalid,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+				code := test.codes[attempts.Add(1)-1]
+				w.WriteHeader(code)
+				if code == http.StatusOK {
+					w.Write([]byte(`{"status":"success","message":"ok","data":{"user":{"id":1}}}`))
+				} else {
+					w.Write([]byte(`{"status":"error","message":"nope","data":null}`))
+				}
+			})
+
+			var err error
+			switch test.method {
+			case http.MethodGet:
+				_, err = c.GetUser(context.Background(), 1)
+			case http.MethodDelete:
+				err = c.DeleteUser(context.Background(), 1)
+			case http.MethodPost:
+				_, err = c.CreateUser(context.Background(), User{Username: "ada", Email: "ada@example.com"})
+			}
+
+			if test.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, test.wantErr)
+			}
+			assert.Equal(t, test.wantAttempts, attempts.Load())
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	c.Timeout = 10 * time.Millisecond
+	c.MaxRetries = 1
+
+	_, err := c.GetUser(context.Background(), 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestListUsers(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("limit"))
+		assert.Equal(t, "eng", r.URL.Query().Get("attr.department"))
+
+		switch r.URL.Query().Get("after") {
+		case "":
+			w.Write([]byte(`{"status":"success","data":{"users":[{"id":1},{"id":2}],"next_after":2}}`))
+		case "2":
+			w.Write([]byte(`{"status":"success","data":{"users":[{"id":5}]}}`))
+		default:
+			t.Errorf("Unexpected page after %s", r.URL.Query().Get("after"))
+		}
+	})
+
+	it := c.ListUsers(context.Background(), ListOptions{Attributes: map[string]string{"department": "eng"}, PageSize: 2})
+	var ids []uint
+	for it.Next() {
+		ids = append(ids, it.User().ID)
+	}
+
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []uint{1, 2, 5}, ids)
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors an *Error matches with errors.Is, after the server's status code
+// and message.
+var (
+	// ErrNotFound is a user that does not exist in the organization.
+	ErrNotFound = errors.New("client: user does not exist")
+	// ErrUsernameTaken and ErrEmailTaken are creates or updates that
+	// would repeat another user's username or email.
+	ErrUsernameTaken = errors.New("client: username has been taken")
+	ErrEmailTaken    = errors.New("client: email has been taken")
+	// ErrInvalid is any other request the server rejected as malformed.
+	ErrInvalid = errors.New("client: request not valid")
+	// ErrUnauthorized is a bearer token the server did not accept.
+	ErrUnauthorized = errors.New("client: organization token not valid")
+	// ErrOrganizationNotFound is an organization the server doesn't know.
+	ErrOrganizationNotFound = errors.New("client: organization does not exist")
+	// ErrRateLimited is a request rejected with 429 after every retry.
+	ErrRateLimited = errors.New("client: rate limited")
+	// ErrServer is a 5xx response.
+	ErrServer = errors.New("client: server error")
+)
+
+// Error is an error response from the API.
+type Error struct {
+	StatusCode int
+	// Message is the response's message, e.g. "User does not exist.".
+	Message string
+	// Detail is the underlying error the server reported, if any.
+	Detail string
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("users api: %d %s: %s", e.StatusCode, e.Message, e.Detail)
+	}
+
+	return fmt.Sprintf("users api: %d %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether target is the sentinel error for e's status code and
+// message.
+func (e *Error) Is(target error) bool {
+	return target == e.kind()
+}
+
+func (e *Error) kind() error {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServer
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	}
+
+	switch e.Message {
+	case "User does not exist.":
+		return ErrNotFound
+	case "Username has been taken!":
+		return ErrUsernameTaken
+	case "Email has been taken!":
+		return ErrEmailTaken
+	case "Organization does not exist.":
+		return ErrOrganizationNotFound
+	}
+
+	if e.StatusCode == http.StatusBadRequest {
+		return ErrInvalid
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultPageSize is the number of users ListUsers fetches per request
+// unless ListOptions says otherwise; the server allows up to 100.
+const DefaultPageSize = 50
+
+// User is a user of the caller's organization.
+type User struct {
+	ID       uint   `json:"id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Fullname string `json:"fullname,omitempty"`
+
+	// Status and SuspendedUntil are read-only here; the server changes them
+	// through its lifecycle endpoints.
+	Status         string     `json:"status,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// CreateUser creates user, which needs a username and an email, and returns
+// it as stored.
+func (c *Client) CreateUser(ctx context.Context, user User) (*User, error) {
+	user.ID = 0
+	user.Status = ""
+	user.SuspendedUntil = nil
+
+	var data struct {
+		User *User `json:"user"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/users/", nil, user, &data); err != nil {
+		return nil, err
+	}
+	if data.User == nil {
+		return nil, errors.New("client: create response has no user")
+	}
+
+	return data.User, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, id uint) (*User, error) {
+	var data struct {
+		User *User `json:"user"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/users/"+strconv.FormatUint(uint64(id), 10), nil, nil, &data); err != nil {
+		return nil, err
+	}
+
+	return data.User, nil
+}
+
+func (c *Client) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	var data struct {
+		User *User `json:"user"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/users/", url.Values{"username": {username}}, nil, &data); err != nil {
+		return nil, err
+	}
+
+	return data.User, nil
+}
+
+// UpdateUser sets the non-empty fields of update on user id. Attributes,
+// when set, replace the whole set.
+func (c *Client) UpdateUser(ctx context.Context, id uint, update User) error {
+	update.ID = 0
+	update.Status = ""
+	update.SuspendedUntil = nil
+
+	return c.do(ctx, http.MethodPut, "/users/"+strconv.FormatUint(uint64(id), 10), nil, update, nil)
+}
+
+func (c *Client) DeleteUser(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, "/users/"+strconv.FormatUint(uint64(id), 10), nil, nil, nil)
+}
+
+// ListOptions filters ListUsers.
+type ListOptions struct {
+	Status string
+	// Attributes filters on custom attributes by name, e.g.
+	// {"department": "eng"}.
+	Attributes map[string]string
+	// PageSize defaults to DefaultPageSize.
+	PageSize int
+}
+
+// ListUsers returns an iterator over the users matching opts, in ID order.
+// It fetches a page at a time as the iterator advances.
+//
+//	it := c.ListUsers(ctx, client.ListOptions{Status: "active"})
+//	for it.Next() {
+//		fmt.Println(it.User().Username)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+func (c *Client) ListUsers(ctx context.Context, opts ListOptions) *UserIterator {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+	for name, value := range opts.Attributes {
+		query.Set("attr."+name, value)
+	}
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	query.Set("limit", strconv.Itoa(pageSize))
+
+	return &UserIterator{ctx: ctx, client: c, query: query}
+}
+
+// UserIterator pages through the users of ListUsers.
+type UserIterator struct {
+	ctx    context.Context
+	client *Client
+	query  url.Values
+
+	page  []User
+	index int
+	// after is the last ID of the page fetched so far; done is set once
+	// the server reports no further page.
+	after uint
+	done  bool
+	err   error
+}
+
+// Next advances to the next user, fetching the next page when needed. It
+// returns false at the end of the list or on an error; see Err.
+func (it *UserIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.index+1 < len(it.page) {
+		it.index++
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	if it.after > 0 {
+		it.query.Set("after", strconv.FormatUint(uint64(it.after), 10))
+	}
+	var data struct {
+		Users     []User `json:"users"`
+		NextAfter uint   `json:"next_after"`
+	}
+	if err := it.client.do(it.ctx, http.MethodGet, "/users/", it.query, nil, &data); err != nil {
+		it.err = err
+		return false
+	}
+
+	it.page, it.index = data.Users, 0
+	it.after = data.NextAfter
+	it.done = data.NextAfter == 0
+
+	return len(it.page) > 0
+}
+
+// User returns the current user.
+func (it *UserIterator) User() User {
+	return it.page[it.index]
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *UserIterator) Err() error {
+	return it.err
+}
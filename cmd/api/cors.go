@@ -0,0 +1,64 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+)
+
+// corsMiddleware answers browsers with the policy of the longest route group
+// the request path falls in, else the default policy. Groups are matched by
+// path, as preflight requests match no route.
+func corsMiddleware(cfg config.CORS) gin.HandlerFunc {
+	fallback := corsHandler(cfg.Policy())
+
+	groups := map[string]gin.HandlerFunc{}
+	var prefixes []string
+	for group, policy := range cfg.GroupPolicies() {
+		prefix := strings.TrimSuffix(group, "/")
+		groups[prefix] = corsHandler(policy)
+		prefixes = append(prefixes, prefix)
+	}
+	// nested groups first
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, prefix := range prefixes {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				groups[prefix](c)
+				return
+			}
+		}
+		fallback(c)
+	}
+}
+
+// corsHandler enforces policy. Without origins it adds no headers, so
+// browsers keep to same-origin calls. Validate has checked the policy, which
+// cors.New would otherwise panic on.
+func corsHandler(policy config.CORSPolicy) gin.HandlerFunc {
+	if len(policy.AllowOrigins) == 0 {
+		return func(*gin.Context) {}
+	}
+
+	cfg := cors.Config{
+		AllowMethods:     policy.AllowMethods,
+		AllowHeaders:     policy.AllowHeaders,
+		ExposeHeaders:    policy.ExposeHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           policy.MaxAge,
+		AllowWildcard:    true,
+	}
+	if slices.Contains(policy.AllowOrigins, "*") {
+		cfg.AllowAllOrigins = true
+	} else {
+		cfg.AllowOrigins = policy.AllowOrigins
+	}
+
+	return cors.New(cfg)
+}
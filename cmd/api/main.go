@@ -1,13 +1,67 @@
 package main
 
-import "github.com/obimadu/ipc3-stage-2/internals/config"
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
-const webPort string = ":8080"
+	"github.com/obimadu/ipc3-stage-2/internals/broker"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/db"
+	"github.com/obimadu/ipc3-stage-2/internals/logging"
+	"github.com/obimadu/ipc3-stage-2/internals/ratelimit"
+	"github.com/obimadu/ipc3-stage-2/internals/storage"
+)
 
 func main() {
+	// Config, from flags such as -config or -server.port, then the file
+	// and environment
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	// JSON logs, with personal data redacted
+	logging.Init(cfg.Log)
+
+	// Subcommands, e.g. `api audit verify`
+	if len(args) > 0 {
+		if err := runCommand(cfg, args); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	slog.Info("Effective config", "config", cfg)
+
 	// Init
-	config.Config()
+	setup(cfg)
+
+	// Serve until SIGINT or SIGTERM, e.g. from docker stop
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := serve(ctx, cfg); err != nil {
+		fatal(err)
+	}
+}
+
+// fatal logs err and exits.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
 
-	// Run http server
-	router().Run(webPort)
+// setup connects the database, avatar storage and event broker.
+func setup(cfg *config.Config) {
+	db.InitDB(cfg.Database)
+	storage.InitAvatars(cfg.Avatars)
+	broker.Init(cfg.Events)
+	ratelimit.Init(cfg.RateLimit)
 }
@@ -1,46 +1,285 @@
 package main
 
 import (
-	"github.com/gin-contrib/cors"
+	"context"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/broker"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
 	"github.com/obimadu/ipc3-stage-2/internals/db"
 	"github.com/obimadu/ipc3-stage-2/internals/handlers"
+	"github.com/obimadu/ipc3-stage-2/internals/health"
+	"github.com/obimadu/ipc3-stage-2/internals/logging"
+	"github.com/obimadu/ipc3-stage-2/internals/metrics"
+	"github.com/obimadu/ipc3-stage-2/internals/openapi"
+	"github.com/obimadu/ipc3-stage-2/internals/ratelimit"
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"github.com/obimadu/ipc3-stage-2/internals/storage"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"github.com/obimadu/ipc3-stage-2/internals/timeout"
+	"github.com/obimadu/ipc3-stage-2/internals/tracing"
+	"gorm.io/gorm"
 )
 
-func router() *gin.Engine {
+func router(cfg *config.Config) *gin.Engine {
 	// make router
-	mux := gin.Default()
+	mux := gin.New()
+
+	// only read client IPs from X-Forwarded-For behind trusted proxies;
+	// Validate has checked them
+	mux.SetTrustedProxies(cfg.Server.TrustedProxies)
+
+	// trace every request, continuing the caller's trace
+	mux.Use(tracing.Middleware(cfg.Tracing.ServiceName))
+
+	// request ID and actor for every request
+	mux.Use(requestinfo.Middleware())
+
+	// log every request with its request ID
+	mux.Use(logging.Middleware())
+
+	// count and time every request
+	mux.Use(metrics.Middleware())
+
+	// answer 500 to handlers that panic; inside the logger and metrics, so
+	// they see the 500
+	mux.Use(logging.Recovery())
+
+	// bound every request, so slow queries are cancelled and answered 504;
+	// event streams stay open until the client or shutdown ends them
+	timeouts := map[string]time.Duration{"GET /api/users/events": 0}
+	for route, limit := range cfg.Server.Timeouts() {
+		timeouts[route] = limit
+	}
+	mux.Use(timeout.Middleware(cfg.Server.RequestTimeout, timeouts))
+
+	// let the configured origins call from browsers, per route group
+	mux.Use(corsMiddleware(cfg.CORS))
 
-	// use cors
-	mux.Use(cors.Default())
+	// limit how often each client calls, after CORS so preflights are free;
+	// probes are never limited
+	if ratelimit.Default != nil {
+		fallback, routeRates := cfg.RateLimit.Rates()
+		rates := map[string]config.Rate{"GET /healthz": {}, "GET /readyz": {}}
+		for route, rate := range routeRates {
+			rates[route] = rate
+		}
+		id := ratelimit.Identity{Keys: cfg.RateLimit.Key, APIKeys: cfg.RateLimit.APIKeys, TokenSecret: cfg.Tenant.TokenSecret}
+		mux.Use(ratelimit.Middleware(ratelimit.Default, id, fallback, rates))
+	}
+
+	// reject request bodies that don't match the API document, which is
+	// built once every route is registered
+	var spec openapi.Document
+	mux.Use(openapi.ValidateRequests(&spec, cfg.Server.MaxBodyBytes))
 
 	// ROUTES
+	// HEALTHZ and READYZ, probes for orchestrators
+	checks := healthChecks()
+	mux.GET("/healthz", handlers.Healthz)
+	mux.GET("/readyz", func(c *gin.Context) {
+		handlers.Readyz(c, checks, draining.Err() != nil)
+	})
+
+	// GRAPHQL, the users of the caller's organization
+	graphql := func(c *gin.Context) {
+		handlers.GraphQL(c, requestDB(c))
+	}
+	mux.GET("/graphql", tenant.Middleware(db.DB, cfg.Tenant), graphql)
+	mux.POST("/graphql", tenant.Middleware(db.DB, cfg.Tenant), graphql)
+
 	// API group (v1)
 	api := mux.Group("/api")
 
-	// API/USERS group
-	users := api.Group("/users")
+	// API/OPENAPI.JSON and API/DOCS, the API document and its Swagger UI
+	api.GET("/openapi.json", openapi.Handler(&spec))
+	api.GET("/docs", openapi.UI("/api/openapi.json"))
+
+	// API/ORGANIZATIONS group, for operators holding the admin token
+	orgs := api.Group("/organizations", tenant.AdminMiddleware(cfg.Tenant))
+
+	orgs.POST("/", func(c *gin.Context) {
+		handlers.CreateOrganization(c, requestDB(c))
+	})
+	orgs.GET("/", func(c *gin.Context) {
+		handlers.GetOrganizations(c, requestDB(c))
+	})
+
+	// API/ATTRIBUTES group, custom profile fields of the caller's
+	// organization, which only operators holding the admin token define
+	attributes := api.Group("/attributes")
+	attributesAdmin := tenant.OrganizationAdminMiddleware(db.DB, cfg.Tenant)
+
+	attributes.POST("/", attributesAdmin, func(c *gin.Context) {
+		handlers.CreateAttributeDefinition(c, requestDB(c))
+	})
+	attributes.GET("/", tenant.Middleware(db.DB, cfg.Tenant), func(c *gin.Context) {
+		handlers.GetAttributeDefinitions(c, requestDB(c))
+	})
+	attributes.DELETE("/:name", attributesAdmin, func(c *gin.Context) {
+		handlers.DeleteAttributeDefinition(c, requestDB(c))
+	})
+
+	// API/PREFERENCES, the schema shared by every user's preferences
+	api.GET("/preferences", handlers.GetPreferenceSchema)
+
+	// API/AUDIT, the security log of the caller's organization
+	api.GET("/audit", tenant.Middleware(db.DB, cfg.Tenant), func(c *gin.Context) {
+		handlers.GetAuditEntries(c, requestDB(c))
+	})
+
+	// API/WEBHOOKS group, the caller's organization's event subscriptions
+	webhooks := api.Group("/webhooks", tenant.Middleware(db.DB, cfg.Tenant))
+
+	webhooks.POST("/", func(c *gin.Context) {
+		handlers.CreateWebhook(c, requestDB(c))
+	})
+	webhooks.GET("/", func(c *gin.Context) {
+		handlers.GetWebhooks(c, requestDB(c))
+	})
+	webhooks.DELETE("/:webhookID", func(c *gin.Context) {
+		handlers.DeleteWebhook(c, requestDB(c))
+	})
+	webhooks.GET("/:webhookID/deliveries", func(c *gin.Context) {
+		handlers.GetWebhookDeliveries(c, requestDB(c))
+	})
+	webhooks.POST("/:webhookID/deliveries/:deliveryID/redeliver", func(c *gin.Context) {
+		handlers.RedeliverWebhookDelivery(c, requestDB(c))
+	})
+
+	// API/USERS group, scoped to the caller's organization
+	users := api.Group("/users", tenant.Middleware(db.DB, cfg.Tenant))
 
 	users.POST("/", func(c *gin.Context) {
-		handlers.CreateUser(c, db.DB)
+		handlers.CreateUser(c, requestDB(c))
 	})
 
 	users.GET("/", func(c *gin.Context) {
-		handlers.GetAll(c, db.DB)
+		handlers.GetAll(c, requestDB(c))
 	})
 	users.GET("/:userID", func(c *gin.Context) {
-		handlers.GetUserByID(c, db.DB)
+		handlers.GetUserByID(c, requestDB(c))
 	})
+	users.GET("/events", func(c *gin.Context) {
+		// streams end when shutdown starts
+		ctx, cancel := untilDraining(c.Request.Context())
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
 
-	users.PUT("/", handlers.UpdateUser)
-	users.PUT("/:userID", handlers.UpdateUser)
+		handlers.StreamUserEvents(c, requestDB(c))
+	})
+
+	users.PUT("/", func(c *gin.Context) {
+		handlers.UpdateUser(c, requestDB(c))
+	})
+	users.PUT("/:userID", func(c *gin.Context) {
+		handlers.UpdateUser(c, requestDB(c))
+	})
 
 	users.DELETE("/", func(c *gin.Context) {
-		handlers.DeleteUserByUsername(c, db.DB)
+		handlers.DeleteUserByUsername(c, requestDB(c))
 	})
 	users.DELETE("/:userID", func(c *gin.Context) {
-		handlers.DeleteUserByID(c, db.DB)
+		handlers.DeleteUserByID(c, requestDB(c))
+	})
+
+	// user change history
+	users.GET("/:userID/history", func(c *gin.Context) {
+		handlers.GetUserHistory(c, requestDB(c))
+	})
+
+	// user status lifecycle
+	users.POST("/:userID/suspend", func(c *gin.Context) {
+		handlers.SuspendUser(c, requestDB(c))
+	})
+	users.POST("/:userID/lock", func(c *gin.Context) {
+		handlers.LockUser(c, requestDB(c))
+	})
+	users.POST("/:userID/deactivate", func(c *gin.Context) {
+		handlers.DeactivateUser(c, requestDB(c))
+	})
+	users.POST("/:userID/reactivate", func(c *gin.Context) {
+		handlers.ReactivateUser(c, requestDB(c))
+	})
+	users.GET("/:userID/status-history", func(c *gin.Context) {
+		handlers.GetUserStatusHistory(c, requestDB(c))
+	})
+
+	// user preferences
+	users.GET("/:userID/preferences", func(c *gin.Context) {
+		handlers.GetPreferences(c, requestDB(c))
+	})
+	users.PUT("/:userID/preferences", func(c *gin.Context) {
+		handlers.UpdatePreferences(c, requestDB(c))
+	})
+	users.GET("/:userID/preferences/:namespace", func(c *gin.Context) {
+		handlers.GetPreferences(c, requestDB(c))
+	})
+	users.PUT("/:userID/preferences/:namespace", func(c *gin.Context) {
+		handlers.UpdatePreferences(c, requestDB(c))
+	})
+
+	// user avatars
+	users.PUT("/:userID/avatar", func(c *gin.Context) {
+		handlers.UploadAvatar(c, requestDB(c), storage.Avatars, cfg.Avatars.MaxBytes)
+	})
+	users.GET("/:userID/avatar", func(c *gin.Context) {
+		handlers.GetAvatar(c, requestDB(c), storage.Avatars)
+	})
+	users.DELETE("/:userID/avatar", func(c *gin.Context) {
+		handlers.DeleteAvatar(c, requestDB(c), storage.Avatars)
+	})
+
+	spec = *handlers.OpenAPI(mux.Routes())
+
+	return mux
+}
+
+// adminRouter serves operators on the admin port, away from the public API:
+// metrics and the details of every dependency, errors and pool included.
+func adminRouter() *gin.Engine {
+	mux := gin.New()
+	mux.Use(logging.Recovery())
+
+	// METRICS, for Prometheus
+	mux.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// HEALTH/DETAILS
+	checks := healthChecks()
+	mux.GET("/health/details", func(c *gin.Context) {
+		handlers.HealthDetails(c, checks, draining.Err() != nil, db.RawDB().Stats())
 	})
 
 	return mux
 }
+
+// healthChecks probes the database, its schema and, when they can be
+// probed, avatar storage and the event broker. Only the database is
+// critical; uploads and events wait for theirs to come back.
+func healthChecks() []health.Check {
+	checks := []health.Check{
+		{Name: "database", Critical: true, Probe: func(ctx context.Context) error {
+			return db.RawDB().PingContext(ctx)
+		}},
+		// the schema only changes on deploys
+		{Name: "migrations", Critical: true, Probe: health.Cached(time.Minute, db.CheckSchema)},
+	}
+	if avatars, ok := storage.Avatars.(health.Pinger); ok {
+		checks = append(checks, health.Check{Name: "avatars", Probe: avatars.Ping})
+	}
+	if publisher, ok := broker.Default.(health.Pinger); ok {
+		checks = append(checks, health.Check{Name: "broker", Probe: publisher.Ping})
+	}
+	if limits, ok := ratelimit.Default.(health.Pinger); ok {
+		checks = append(checks, health.Check{Name: "rate_limit", Probe: limits.Ping})
+	}
+
+	return checks
+}
+
+// requestDB returns the shared connection bound to the request context, which
+// carries the tenant resolved by tenant.Middleware.
+func requestDB(c *gin.Context) *gorm.DB {
+	return db.DB.WithContext(c.Request.Context())
+}
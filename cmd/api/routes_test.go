@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/handlers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPI(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	mux := router(config.Default())
+
+	// every API route is documented, and nothing else is
+	routes := map[string]bool{}
+	for _, route := range mux.Routes() {
+		if strings.HasPrefix(route.Path, "/api/") {
+			routes[route.Method+" "+route.Path] = true
+			assert.Contains(t, handlers.Operations, route.Method+" "+route.Path)
+		}
+	}
+	for op := range handlers.Operations {
+		assert.True(t, routes[op], "%s is documented but not routed", op)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Unable to decode the document, %v", err)
+	}
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Contains(t, doc.Paths, "/api/users/{userID}")
+	assert.Contains(t, doc.Paths["/api/users"], "post")
+}
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	cfg := config.Default()
+	cfg.CORS.AllowOrigins = []string{"https://app.example.com", "https://*.example.com"}
+	cfg.CORS.AllowCredentials = true
+	cfg.CORS.Groups = []string{"/api/audit=origins:https://admin.example.com;credentials:false;max_age:1m"}
+	mux := router(cfg)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		origin         string
+		requestHeaders string
+		status         int
+		allowOrigin    string
+		credentials    string
+		maxAge         string
+		allowHeaders   string
+	}{
+		{name: "preflight from an allowed origin", method: http.MethodOptions, url: "/api/users/", origin: "https://app.example.com", status: http.StatusNoContent, allowOrigin: "https://app.example.com", credentials: "true", maxAge: "43200"},
+		{name: "preflight from a subdomain", method: http.MethodOptions, url: "/api/users/1", origin: "https://eu.example.com", status: http.StatusNoContent, allowOrigin: "https://eu.example.com", credentials: "true", maxAge: "43200"},
+		{name: "preflight with tenant headers", method: http.MethodOptions, url: "/api/users/", origin: "https://app.example.com", requestHeaders: "Authorization, X-Organization, X-Request-ID", status: http.StatusNoContent, allowHeaders: "Origin,Content-Length,Content-Type,Authorization,X-Organization,X-Request-Id", allowOrigin: "https://app.example.com", credentials: "true", maxAge: "43200"},
+		{name: "preflight from another origin", method: http.MethodOptions, url: "/api/users/", origin: "https://example.org", status: http.StatusForbidden},
+		{name: "lookalike origin", method: http.MethodOptions, url: "/api/users/", origin: "https://example.com.evil.org", status: http.StatusForbidden},
+		{name: "group override", method: http.MethodOptions, url: "/api/audit", origin: "https://admin.example.com", status: http.StatusNoContent, allowOrigin: "https://admin.example.com", maxAge: "60"},
+		{name: "group replaces the default origins", method: http.MethodOptions, url: "/api/audit", origin: "https://app.example.com", status: http.StatusForbidden},
+		{name: "simple request", method: http.MethodGet, url: "/healthz", origin: "https://app.example.com", status: http.StatusOK, allowOrigin: "https://app.example.com", credentials: "true"},
+		{name: "same-origin request", method: http.MethodGet, url: "/healthz", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			if tt.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.allowOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.credentials, w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Equal(t, tt.maxAge, w.Header().Get("Access-Control-Max-Age"))
+			if tt.allowHeaders != "" {
+				assert.Equal(t, tt.allowHeaders, w.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
+
+func TestCORSAllowsNoOriginByDefault(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	mux := router(config.Default())
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
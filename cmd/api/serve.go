@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/broker"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/db"
+	"github.com/obimadu/ipc3-stage-2/internals/jobs"
+	"github.com/obimadu/ipc3-stage-2/internals/metrics"
+	"github.com/obimadu/ipc3-stage-2/internals/ratelimit"
+	"github.com/obimadu/ipc3-stage-2/internals/rpc"
+	"github.com/obimadu/ipc3-stage-2/internals/tracing"
+	"github.com/obimadu/ipc3-stage-2/internals/webhooks"
+	"google.golang.org/grpc"
+)
+
+// draining is done once shutdown starts. /readyz fails from then on, and
+// event streams end, as they would otherwise hold shutdown up until the
+// deadline.
+var draining, startDraining = context.WithCancel(context.Background())
+
+// serve runs the HTTP and gRPC servers and the background workers until ctx
+// is done or a server fails, then shuts down within
+// cfg.Server.ShutdownTimeout: the listeners close, in-flight requests and
+// calls finish, the workers stop and flush what the last requests wrote,
+// and the database pool closes.
+func serve(ctx context.Context, cfg *config.Config) error {
+	shutdownTracing, err := tracing.Init(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+
+	// Background workers
+	workers, stopWorkers := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	start := func(run func(ctx context.Context)) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			run(workers)
+		}()
+	}
+
+	start(func(ctx context.Context) {
+		jobs.ReactivateSuspendedUsers(ctx, db.DB, cfg.Jobs.ReactivationInterval)
+	})
+	dispatcher := webhooks.NewDispatcher(db.DB)
+	start(func(ctx context.Context) {
+		dispatcher.Run(ctx, cfg.Jobs.WebhookInterval)
+	})
+	var relay *broker.Relay
+	if broker.Default != nil {
+		relay = broker.NewRelay(db.DB, broker.Default)
+		start(func(ctx context.Context) {
+			relay.Run(ctx, cfg.Jobs.BrokerInterval)
+		})
+	}
+
+	// Servers; the first to fail shuts the rest down
+	failed := make(chan error, 3)
+
+	// the admin server is kept apart from the public API
+	if err := metrics.RegisterDB(db.DB); err != nil {
+		stopWorkers()
+		return fmt.Errorf("unable to register database metrics %w", err)
+	}
+	adminServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Server.AdminPort),
+		Handler: adminRouter(),
+	}
+	go func() {
+		if err := adminServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- fmt.Errorf("admin server stopped %w", err)
+		}
+	}()
+
+	grpcAddr := fmt.Sprintf(":%d", cfg.Server.GRPCPort)
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		stopWorkers()
+		return fmt.Errorf("unable to listen on %s %w", grpcAddr, err)
+	}
+	grpcServer, healthServer := rpc.NewServer(db.DB, cfg.Tenant)
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			failed <- fmt.Errorf("gRPC server stopped %w", err)
+		}
+	}()
+
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler: router(cfg),
+	}
+	go func() {
+		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- fmt.Errorf("HTTP server stopped %w", err)
+		}
+	}()
+	slog.Info("Serving", "http", httpServer.Addr, "grpc", grpcAddr, "metrics", adminServer.Addr)
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down, draining in-flight requests ...")
+	case serveErr = <-failed:
+		slog.Error("Shutting down", "error", serveErr)
+	}
+
+	// Fail readiness, then give load balancers time to notice before the
+	// listeners close
+	startDraining()
+	if cfg.Server.DrainDelay > 0 {
+		slog.Info("Draining before closing listeners ...", "delay", cfg.Server.DrainDelay.String())
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting and drain both servers at once
+	healthServer.Shutdown()
+	grpcDrained := make(chan struct{})
+	go func() {
+		stopGRPC(shutdownCtx, grpcServer)
+		close(grpcDrained)
+	}()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Unable to drain HTTP requests, closing them", "error", err)
+		httpServer.Close()
+	}
+	<-grpcDrained
+
+	// Flush what the last requests wrote to the outbox
+	stopWorkers()
+	running.Wait()
+	if err := dispatcher.Flush(shutdownCtx); err != nil {
+		slog.Warn("Unable to flush webhook deliveries", "error", err)
+	}
+	if relay != nil {
+		if err := relay.Flush(shutdownCtx); err != nil {
+			slog.Warn("Unable to flush events", "error", err)
+		}
+		broker.Default.Close()
+	}
+	if limits, ok := ratelimit.Default.(io.Closer); ok {
+		limits.Close()
+	}
+
+	// export the spans of the last requests
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Unable to flush traces", "error", err)
+	}
+
+	// metrics stay up until the end, for the drain to be observed
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		adminServer.Close()
+	}
+
+	if err := db.RawDB().Close(); err != nil {
+		slog.Warn("Unable to close database connections", "error", err)
+	}
+	slog.Info("Shut down.")
+
+	return serveErr
+}
+
+// stopGRPC lets in-flight calls finish, cancelling them once ctx is done.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Warn("Unable to drain gRPC calls, cancelling them")
+		server.Stop()
+		<-stopped
+	}
+}
+
+// untilDraining ends the request's context when shutdown starts.
+func untilDraining(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(draining, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
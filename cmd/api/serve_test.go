@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/db"
+	"github.com/obimadu/ipc3-stage-2/internals/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	cfg := config.Default()
+	cfg.Server.Port = freePort(t)
+	cfg.Server.GRPCPort = freePort(t)
+	cfg.Server.AdminPort = freePort(t)
+	cfg.Server.ShutdownTimeout = 10 * time.Second
+	cfg.Server.DrainDelay = time.Second
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.SqlitePath = filepath.Join(t.TempDir(), "users.db")
+	cfg.Avatars.DiskPath = t.TempDir()
+	db.InitDB(cfg.Database)
+	storage.InitAvatars(cfg.Avatars)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, cfg)
+	}()
+
+	base := fmt.Sprintf("http://127.0.0.1:%d", cfg.Server.Port)
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(base + "/api/openapi.json")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 20*time.Millisecond)
+
+	readyz := func() int {
+		resp, err := http.Get(base + "/readyz")
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, readyz())
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", cfg.Server.AdminPort))
+	if err != nil {
+		t.Fatalf("Unable to scrape metrics %s", err.Error())
+	}
+	scraped, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, metric := range []string{
+		`users_api_http_requests_total{method="GET",route="/readyz",status="200"} 1`,
+		`users_api_db_query_duration_seconds_count{operation="row"}`,
+		`users_api_users{status="active"} 0`,
+		`users_api_organizations 1`,
+		`go_sql_max_open_connections{db_name="users"} 100`,
+	} {
+		assert.Contains(t, string(scraped), metric)
+	}
+
+	// an open event stream must not hold shutdown up until the deadline
+	req, _ := http.NewRequest(http.MethodGet, base+"/api/users/events", nil)
+	req.Header.Set("X-Organization", "default")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unable to open the event stream %s", err.Error())
+	}
+	defer stream.Body.Close()
+	assert.Equal(t, http.StatusOK, stream.StatusCode)
+
+	started := time.Now()
+	stop()
+
+	// readiness fails while draining, before the listeners close
+	assert.Eventually(t, func() bool {
+		return readyz() == http.StatusServiceUnavailable
+	}, cfg.Server.DrainDelay, 20*time.Millisecond)
+	select {
+	case err := <-served:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return")
+	}
+	assert.Less(t, time.Since(started), cfg.Server.ShutdownTimeout)
+
+	_, err = io.ReadAll(stream.Body)
+	assert.NoError(t, err)
+
+	_, err = http.Get(base + "/api/openapi.json")
+	assert.Error(t, err)
+	assert.EqualError(t, db.RawDB().Ping(), "sql: database is closed")
+}
+
+func freePort(t *testing.T) int {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to find a free port %s", err.Error())
+	}
+	defer lis.Close()
+
+	return lis.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/obimadu/ipc3-stage-2/client"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/db"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"gorm.io/gorm"
+)
+
+// backend is where usersctl reads and writes users. Both implementations
+// report a missing user as client.ErrNotFound and a duplicate as
+// client.ErrUsernameTaken or client.ErrEmailTaken.
+type backend interface {
+	List(ctx context.Context, filter listFilter) ([]client.User, error)
+	Get(ctx context.Context, id uint) (*client.User, error)
+	GetByUsername(ctx context.Context, username string) (*client.User, error)
+	Create(ctx context.Context, user client.User) (*client.User, error)
+	Update(ctx context.Context, id uint, update client.User) error
+	Delete(ctx context.Context, id uint) error
+	// Export lists users like List, for taking them out of the
+	// organization, which the database backend records in the audit log.
+	Export(ctx context.Context, filter listFilter) ([]client.User, error)
+}
+
+type listFilter struct {
+	Status     string
+	Attributes map[string]string
+}
+
+func openBackend(a *app) (backend, error) {
+	if a.api != "" {
+		c := client.New(a.api)
+		c.Organization = a.org
+		c.Token = a.token
+		c.Actor = a.actor
+		return &apiBackend{client: c}, nil
+	}
+
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		return nil, err
+	}
+	// the API migrates the database; an older usersctl must not change it
+	db.Open(cfg.Database)
+	if err := db.CheckSchema(context.Background()); err != nil {
+		return nil, fmt.Errorf("database schema is not current, start the API to migrate it: %w", err)
+	}
+
+	org, err := models.GetOrganizationBySlug(db.DB, a.org)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("organization %q does not exist", a.org)
+		}
+		return nil, err
+	}
+
+	return &dbBackend{db: db.DB, orgID: org.ID, actor: a.actor}, nil
+}
+
+// apiBackend calls the HTTP API.
+type apiBackend struct {
+	client *client.Client
+}
+
+func (b *apiBackend) List(ctx context.Context, filter listFilter) ([]client.User, error) {
+	it := b.client.ListUsers(ctx, client.ListOptions{Status: filter.Status, Attributes: filter.Attributes, PageSize: 100})
+	users := []client.User{}
+	for it.Next() {
+		users = append(users, it.User())
+	}
+
+	return users, it.Err()
+}
+
+// Export lists users through the API, which has no export of its own.
+func (b *apiBackend) Export(ctx context.Context, filter listFilter) ([]client.User, error) {
+	return b.List(ctx, filter)
+}
+
+func (b *apiBackend) Get(ctx context.Context, id uint) (*client.User, error) {
+	return b.client.GetUser(ctx, id)
+}
+
+func (b *apiBackend) GetByUsername(ctx context.Context, username string) (*client.User, error) {
+	return b.client.GetUserByUsername(ctx, username)
+}
+
+func (b *apiBackend) Create(ctx context.Context, user client.User) (*client.User, error) {
+	return b.client.CreateUser(ctx, user)
+}
+
+func (b *apiBackend) Update(ctx context.Context, id uint, update client.User) error {
+	return b.client.UpdateUser(ctx, id, update)
+}
+
+func (b *apiBackend) Delete(ctx context.Context, id uint) error {
+	return b.client.DeleteUser(ctx, id)
+}
+
+// dbBackend works on the database through models, scoped to one
+// organization and with the same validation as the API.
+type dbBackend struct {
+	db    *gorm.DB
+	orgID uint
+	actor string
+}
+
+// scope returns ctx scoped to the organization, with the actor for the
+// audit log. Whoever can reach the database directly is trusted to name
+// themselves.
+func (b *dbBackend) scope(ctx context.Context) context.Context {
+	ctx = tenant.NewContext(ctx, b.orgID)
+	if b.actor != "" {
+		ctx = requestinfo.WithVerifiedActor(ctx, b.actor)
+	}
+
+	return ctx
+}
+
+func (b *dbBackend) conn(ctx context.Context) *gorm.DB {
+	return b.db.WithContext(b.scope(ctx))
+}
+
+func (b *dbBackend) List(ctx context.Context, filter listFilter) ([]client.User, error) {
+	conn := b.conn(ctx)
+	f, err := userFilter(conn, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := models.GetAll(conn, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return toClients(users), nil
+}
+
+func (b *dbBackend) Export(ctx context.Context, filter listFilter) ([]client.User, error) {
+	conn := b.conn(ctx)
+	f, err := userFilter(conn, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := models.ExportUsers(conn, b.orgID, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return toClients(users), nil
+}
+
+// userFilter checks filter against the organization's attribute
+// definitions.
+func userFilter(conn *gorm.DB, filter listFilter) (models.UserFilter, error) {
+	f := models.UserFilter{Status: filter.Status}
+	if filter.Status != "" && !models.ValidStatus(filter.Status) {
+		return f, fmt.Errorf("status %q not valid", filter.Status)
+	}
+	if len(filter.Attributes) > 0 {
+		defs, err := models.GetAttributeDefinitions(conn)
+		if err != nil {
+			return f, err
+		}
+		f.Attributes, err = models.ParseAttributeFilters(defs, filter.Attributes)
+		if err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
+
+func (b *dbBackend) Get(ctx context.Context, id uint) (*client.User, error) {
+	user, err := models.GetUserByID(b.conn(ctx), id)
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	return toClient(user), nil
+}
+
+func (b *dbBackend) GetByUsername(ctx context.Context, username string) (*client.User, error) {
+	user, err := models.GetUserByUsername(b.conn(ctx), username)
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	return toClient(user), nil
+}
+
+func (b *dbBackend) Create(ctx context.Context, user client.User) (*client.User, error) {
+	conn := b.conn(ctx)
+	if user.Username == "" || user.Email == "" {
+		return nil, errors.New("a user needs both a username and an email")
+	}
+
+	// status only changes through the lifecycle endpoints
+	record := models.Users{
+		Username:   user.Username,
+		Email:      user.Email,
+		Fullname:   user.Fullname,
+		Attributes: user.Attributes,
+	}
+	if err := validateAttributes(conn, record.Attributes); err != nil {
+		return nil, err
+	}
+	if err := models.CreateUser(conn, &record); err != nil {
+		return nil, dbError(err)
+	}
+
+	return toClient(&record), nil
+}
+
+func (b *dbBackend) Update(ctx context.Context, id uint, update client.User) error {
+	conn := b.conn(ctx)
+	// attributes sent on update replace the whole set
+	if update.Attributes != nil {
+		if err := validateAttributes(conn, update.Attributes); err != nil {
+			return err
+		}
+	}
+
+	err := models.UpdateUserByID(conn, id, models.Users{
+		Username:   update.Username,
+		Email:      update.Email,
+		Fullname:   update.Fullname,
+		Attributes: update.Attributes,
+	})
+
+	return dbError(err)
+}
+
+func (b *dbBackend) Delete(ctx context.Context, id uint) error {
+	return dbError(models.DeleteUserByID(b.conn(ctx), id))
+}
+
+func validateAttributes(conn *gorm.DB, attrs models.Attributes) error {
+	defs, err := models.GetAttributeDefinitions(conn)
+	if err != nil {
+		return err
+	}
+
+	return models.ValidateAttributes(defs, attrs)
+}
+
+// dbError reports model errors as the client package's errors, so commands
+// handle both backends alike.
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return client.ErrNotFound
+	}
+
+	switch models.UniqueViolation(err) {
+	case "email":
+		return client.ErrEmailTaken
+	case "username":
+		return client.ErrUsernameTaken
+	}
+
+	return err
+}
+
+func toClients(users []models.Users) []client.User {
+	out := make([]client.User, len(users))
+	for i := range users {
+		out[i] = *toClient(&users[i])
+	}
+
+	return out
+}
+
+func toClient(user *models.Users) *client.User {
+	return &client.User{
+		ID:             user.ID,
+		Username:       user.Username,
+		Email:          user.Email,
+		Fullname:       user.Fullname,
+		Status:         user.Status,
+		SuspendedUntil: user.SuspendedUntil,
+		Attributes:     user.Attributes,
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/obimadu/ipc3-stage-2/client"
+	"gopkg.in/yaml.v3"
+)
+
+var listCommand = command{
+	usage:   "list [-status status] [-attr name=value]...",
+	summary: "List users, optionally filtered by status and custom attributes.",
+	flags: func(fs *flag.FlagSet) func(ctx context.Context, a *app, args []string) error {
+		filter := filterFlags(fs)
+
+		return func(ctx context.Context, a *app, args []string) error {
+			b, err := a.open()
+			if err != nil {
+				return err
+			}
+			users, err := b.List(ctx, *filter)
+			if err != nil {
+				return err
+			}
+
+			return printUsers(a.stdout, a.output, users)
+		}
+	},
+}
+
+var getCommand = command{
+	usage:   "get <id|@username>",
+	summary: "Show a user.",
+	flags: func(fs *flag.FlagSet) func(ctx context.Context, a *app, args []string) error {
+		return func(ctx context.Context, a *app, args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: get <id|@username>")
+			}
+			b, err := a.open()
+			if err != nil {
+				return err
+			}
+			user, err := resolve(ctx, b, args[0])
+			if err != nil {
+				return err
+			}
+
+			return printUser(a.stdout, a.output, user)
+		}
+	},
+}
+
+var createCommand = command{
+	usage:   "create -username name -email address [-fullname name] [-attributes json]",
+	summary: "Create a user.",
+	flags: func(fs *flag.FlagSet) func(ctx context.Context, a *app, args []string) error {
+		user := userFlags(fs)
+
+		return func(ctx context.Context, a *app, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("unexpected arguments %s", strings.Join(args, " "))
+			}
+			b, err := a.open()
+			if err != nil {
+				return err
+			}
+			created, err := b.Create(ctx, *user)
+			if err != nil {
+				return err
+			}
+
+			return printUser(a.stdout, a.output, created)
+		}
+	},
+}
+
+var updateCommand = command{
+	usage:   "update <id|@username> [-username name] [-email address] [-fullname name] [-attributes json]",
+	summary: "Change the given fields of a user. -attributes replaces the whole set.",
+	flags: func(fs *flag.FlagSet) func(ctx context.Context, a *app, args []string) error {
+		update := userFlags(fs)
+
+		return func(ctx context.Context, a *app, args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: update <id|@username> [flags]")
+			}
+			if update.Username == "" && update.Email == "" && update.Fullname == "" && update.Attributes == nil {
+				return errors.New("nothing to update, set at least one of -username, -email, -fullname or -attributes")
+			}
+			b, err := a.open()
+			if err != nil {
+				return err
+			}
+			user, err := resolve(ctx, b, args[0])
+			if err != nil {
+				return err
+			}
+			if err := b.Update(ctx, user.ID, *update); err != nil {
+				return err
+			}
+
+			user, err = b.Get(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+
+			return printUser(a.stdout, a.output, user)
+		}
+	},
+}
+
+var deleteCommand = command{
+	usage:   "delete <id|@username>",
+	summary: "Delete a user.",
+	flags: func(fs *flag.FlagSet) func(ctx context.Context, a *app, args []string) error {
+		return func(ctx context.Context, a *app, args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: delete <id|@username>")
+			}
+			b, err := a.open()
+			if err != nil {
+				return err
+			}
+			user, err := resolve(ctx, b, args[0])
+			if err != nil {
+				return err
+			}
+			if err := b.Delete(ctx, user.ID); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(a.stdout, "Deleted user %d (%s).\n", user.ID, user.Username)
+			return nil
+		}
+	},
+}
+
+var exportCommand = command{
+	usage:   "export [-status status] [-attr name=value]...",
+	summary: "Write users as a JSON array, or YAML with -o yaml, that import reads back.",
+	flags: func(fs *flag.FlagSet) func(ctx context.Context, a *app, args []string) error {
+		filter := filterFlags(fs)
+
+		return func(ctx context.Context, a *app, args []string) error {
+			b, err := a.open()
+			if err != nil {
+				return err
+			}
+			users, err := b.Export(ctx, *filter)
+			if err != nil {
+				return err
+			}
+
+			format := a.output
+			if format == "table" {
+				format = "json"
+			}
+			return printUsers(a.stdout, format, users)
+		}
+	},
+}
+
+var importCommand = command{
+	usage:   "import -f file [-upsert]",
+	summary: "Create the users in a JSON or YAML array, e.g. from export. IDs and statuses in the file are ignored.",
+	flags: func(fs *flag.FlagSet) func(ctx context.Context, a *app, args []string) error {
+		file := fs.String("f", "-", "file to read, - for stdin")
+		upsert := fs.Bool("upsert", false, "update users whose username already exists instead of failing")
+
+		return func(ctx context.Context, a *app, args []string) error {
+			users, err := readUsers(a.stdin, *file)
+			if err != nil {
+				return err
+			}
+			b, err := a.open()
+			if err != nil {
+				return err
+			}
+
+			created, updated, failed := 0, 0, 0
+			for _, user := range users {
+				err := importUser(ctx, b, user, *upsert)
+				switch {
+				case errors.Is(err, errUpdated):
+					updated++
+				case err != nil:
+					failed++
+					fmt.Fprintf(a.stdout, "%s: %v\n", user.Username, err)
+				default:
+					created++
+				}
+			}
+
+			fmt.Fprintf(a.stdout, "Created %d, updated %d, failed %d.\n", created, updated, failed)
+			if failed > 0 {
+				return fmt.Errorf("%d of %d users failed to import", failed, len(users))
+			}
+			return nil
+		}
+	},
+}
+
+// errUpdated is importUser's report that the user existed and was updated.
+var errUpdated = errors.New("updated")
+
+func importUser(ctx context.Context, b backend, user client.User, upsert bool) error {
+	_, err := b.Create(ctx, user)
+	if !upsert || !errors.Is(err, client.ErrUsernameTaken) {
+		return err
+	}
+
+	existing, err := b.GetByUsername(ctx, user.Username)
+	if err != nil {
+		return err
+	}
+	if err := b.Update(ctx, existing.ID, client.User{Email: user.Email, Fullname: user.Fullname, Attributes: user.Attributes}); err != nil {
+		return err
+	}
+
+	return errUpdated
+}
+
+// readUsers reads a JSON or YAML array of users from path, or from stdin
+// for "-". YAML is decoded through JSON so both use the API's field names.
+func readUsers(stdin io.Reader, path string) ([]client.User, error) {
+	var raw []byte
+	var err error
+	if path == "-" {
+		raw, err = io.ReadAll(stdin)
+	} else {
+		raw, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON or YAML: %w", path, err)
+	}
+	asJSON, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []client.User
+	if err := json.Unmarshal(asJSON, &users); err != nil {
+		return nil, fmt.Errorf("%s must hold an array of users: %w", path, err)
+	}
+
+	return users, nil
+}
+
+// resolve looks a user up by username when ref is @username, or by ID.
+// Usernames are never guessed at, so a mistyped ID can't name another user.
+func resolve(ctx context.Context, b backend, ref string) (*client.User, error) {
+	if username, ok := strings.CutPrefix(ref, "@"); ok {
+		return b.GetByUsername(ctx, username)
+	}
+
+	id, err := strconv.ParseUint(ref, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a user ID, name users by username as @%s", ref, ref)
+	}
+
+	return b.Get(ctx, uint(id))
+}
+
+func filterFlags(fs *flag.FlagSet) *listFilter {
+	filter := &listFilter{Attributes: map[string]string{}}
+	fs.StringVar(&filter.Status, "status", "", "only users with this status: active, suspended, locked or deactivated")
+	fs.Func("attr", "only users whose custom attribute matches, as name=value; repeatable", func(v string) error {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return errors.New("must be name=value")
+		}
+		filter.Attributes[name] = value
+		return nil
+	})
+
+	return filter
+}
+
+func userFlags(fs *flag.FlagSet) *client.User {
+	user := &client.User{}
+	fs.StringVar(&user.Username, "username", "", "username, unique in the organization")
+	fs.StringVar(&user.Email, "email", "", "email address, unique in the organization")
+	fs.StringVar(&user.Fullname, "fullname", "", "full name")
+	fs.Func("attributes", `custom attributes as a JSON object, e.g. {"department":"eng"}`, func(v string) error {
+		return json.Unmarshal([]byte(v), &user.Attributes)
+	})
+
+	return user
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var completionCommand = command{
+	usage:   "completion bash|zsh|fish",
+	summary: "Print a shell completion script, e.g. source <(usersctl completion bash).",
+	flags: func(fs *flag.FlagSet) func(ctx context.Context, a *app, args []string) error {
+		return func(ctx context.Context, a *app, args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: completion bash|zsh|fish")
+			}
+
+			switch args[0] {
+			case "bash":
+				writeBashCompletion(a.stdout)
+			case "zsh":
+				// zsh runs the bash script through bashcompinit
+				fmt.Fprintln(a.stdout, "autoload -U +X bashcompinit && bashcompinit")
+				writeBashCompletion(a.stdout)
+			case "fish":
+				writeFishCompletion(a.stdout)
+			default:
+				return fmt.Errorf("unknown shell %q, use bash, zsh or fish", args[0])
+			}
+			return nil
+		}
+	},
+}
+
+// completionFlag is a flag as completion scripts see it.
+type completionFlag struct {
+	name    string
+	usage   string
+	isValue bool
+}
+
+func flagsOf(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		isBool := false
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			isBool = b.IsBoolFlag()
+		}
+		flags = append(flags, completionFlag{name: f.Name, usage: f.Usage, isValue: !isBool})
+	})
+
+	return flags
+}
+
+func globalFlags() []completionFlag {
+	return flagsOf(globalFlagSet(&app{}))
+}
+
+func commandFlags(name string) []completionFlag {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	commands[name].flags(fs)
+
+	return flagsOf(fs)
+}
+
+func dashed(flags []completionFlag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.name
+	}
+
+	return strings.Join(names, " ")
+}
+
+func writeBashCompletion(w io.Writer) {
+	global := globalFlags()
+	var valueFlags []string
+	for _, f := range global {
+		if f.isValue {
+			valueFlags = append(valueFlags, "-"+f.name)
+		}
+	}
+
+	fmt.Fprintln(w, "# bash completion for usersctl")
+	fmt.Fprintln(w, "_usersctl() {")
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" cmd="" i`)
+	fmt.Fprintln(w, "	for ((i = 1; i < COMP_CWORD; i++)); do")
+	fmt.Fprintln(w, `		case "${COMP_WORDS[i]}" in`)
+	fmt.Fprintln(w, "		-*) ;;")
+	fmt.Fprintln(w, "		*)")
+	fmt.Fprintln(w, `			case "${COMP_WORDS[i-1]}" in`)
+	fmt.Fprintf(w, "			%s) ;;\n", strings.Join(valueFlags, "|"))
+	fmt.Fprintln(w, `			*) cmd="${COMP_WORDS[i]}"; break ;;`)
+	fmt.Fprintln(w, "			esac")
+	fmt.Fprintln(w, "			;;")
+	fmt.Fprintln(w, "		esac")
+	fmt.Fprintln(w, "	done")
+	fmt.Fprintln(w, `	if [[ "$prev" == "-o" ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(formats, " "))
+	fmt.Fprintln(w, "		return")
+	fmt.Fprintln(w, "	fi")
+	fmt.Fprintln(w, `	case "$cmd" in`)
+	fmt.Fprintf(w, "\t\"\") COMPREPLY=($(compgen -W \"%s %s\" -- \"$cur\")) ;;\n", dashed(global), strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, `	completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;`)
+	for _, name := range commandNames() {
+		if flags := commandFlags(name); len(flags) > 0 {
+			fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", name, dashed(flags))
+		}
+	}
+	fmt.Fprintln(w, "	esac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _usersctl usersctl")
+}
+
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for usersctl")
+	for _, f := range globalFlags() {
+		value := " -r"
+		if f.name == "o" {
+			value = " -x -a '" + strings.Join(formats, " ") + "'"
+		}
+		fmt.Fprintf(w, "complete -c usersctl -n __fish_use_subcommand -o %s%s -d %s\n", f.name, value, fishQuote(f.usage))
+	}
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "complete -c usersctl -f -n __fish_use_subcommand -a %s -d %s\n", name, fishQuote(commands[name].summary))
+		for _, f := range commandFlags(name) {
+			value := ""
+			if f.isValue {
+				value = " -r"
+			}
+			fmt.Fprintf(w, "complete -c usersctl -n '__fish_seen_subcommand_from %s' -o %s%s -d %s\n", name, f.name, value, fishQuote(f.usage))
+		}
+	}
+	fmt.Fprintln(w, "complete -c usersctl -f -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'")
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
@@ -0,0 +1,185 @@
+// Command usersctl manages users from the terminal, either directly against
+// the database or remotely against the HTTP API.
+//
+//	usersctl -org acme list -status suspended
+//	usersctl -api https://ips2.obi.ninja/api -org acme -o yaml get @ada
+//	usersctl -org acme export > users.json
+//	usersctl -org acme import -f users.json -upsert
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// command is a usersctl subcommand. flags declares its flags, so help and
+// shell completion see the same set run parses.
+type command struct {
+	usage   string
+	summary string
+	flags   func(fs *flag.FlagSet) func(ctx context.Context, app *app, args []string) error
+}
+
+var commands = map[string]command{
+	"list":   listCommand,
+	"get":    getCommand,
+	"create": createCommand,
+	"update": updateCommand,
+	"delete": deleteCommand,
+	"import": importCommand,
+	"export": exportCommand,
+}
+
+func init() {
+	// completion lists the other commands, so it is added after them
+	commands["completion"] = completionCommand
+}
+
+// app is what every subcommand runs with: the parsed global flags and
+// where to send output.
+type app struct {
+	api     string
+	org     string
+	token   string
+	actor   string
+	output  string
+	timeout time.Duration
+
+	stdin  io.Reader
+	stdout io.Writer
+
+	// backend is opened on first use, so completion and usage errors
+	// don't need a database.
+	backend     backend
+	openBackend func(a *app) (backend, error)
+}
+
+func main() {
+	a := &app{stdin: os.Stdin, stdout: os.Stdout, openBackend: openBackend}
+	if err := run(a, os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "usersctl:", err)
+		os.Exit(1)
+	}
+}
+
+// globalFlagSet declares the flags that come before the command.
+func globalFlagSet(a *app) *flag.FlagSet {
+	global := flag.NewFlagSet("usersctl", flag.ContinueOnError)
+	global.StringVar(&a.api, "api", os.Getenv("USERSCTL_API"), "base URL of the HTTP API, e.g. https://ips2.obi.ninja/api; the database is used when empty")
+	global.StringVar(&a.org, "org", envOr("USERSCTL_ORG", "default"), "organization slug")
+	global.StringVar(&a.token, "token", os.Getenv("USERSCTL_TOKEN"), "bearer token for the HTTP API, instead of -org")
+	global.StringVar(&a.actor, "actor", envOr("USERSCTL_ACTOR", os.Getenv("USER")), "operator recorded in the audit log")
+	global.StringVar(&a.output, "o", "table", "output format: table, json or yaml")
+	global.DurationVar(&a.timeout, "timeout", 30*time.Second, "timeout of the whole command")
+	global.Usage = func() { usage(global) }
+
+	return global
+}
+
+func run(a *app, args []string) error {
+	global := globalFlagSet(a)
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if !validFormat(a.output) {
+		return fmt.Errorf("unknown output format %q, use table, json or yaml", a.output)
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return flag.ErrHelp
+	}
+
+	name := global.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q, available commands: %s", name, strings.Join(commandNames(), ", "))
+	}
+
+	fs := flag.NewFlagSet("usersctl "+name, flag.ContinueOnError)
+	runCmd := cmd.flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: usersctl [global flags] %s\n\n%s\n\n", cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	cmdArgs, err := parseInterspersed(fs, global.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	return runCmd(ctx, a, cmdArgs)
+}
+
+// parseInterspersed parses flags that may come after positional arguments,
+// as in `update @ada -email ada@example.com`, and returns the positional
+// ones.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// open returns the backend, opening it on first use.
+func (a *app) open() (backend, error) {
+	if a.backend == nil {
+		b, err := a.openBackend(a)
+		if err != nil {
+			return nil, err
+		}
+		a.backend = b
+	}
+
+	return a.backend, nil
+}
+
+func usage(global *flag.FlagSet) {
+	out := global.Output()
+	fmt.Fprintln(out, "Usage: usersctl [global flags] <command> [flags] [args]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Commands:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(out, "  %-11s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Global flags:")
+	global.PrintDefaults()
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
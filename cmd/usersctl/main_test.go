@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/obimadu/ipc3-stage-2/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryBackend keeps users in memory in ID order.
+type memoryBackend struct {
+	users   []client.User
+	nextID  uint
+	exports int
+}
+
+func (b *memoryBackend) List(ctx context.Context, filter listFilter) ([]client.User, error) {
+	var out []client.User
+	for _, user := range b.users {
+		if filter.Status == "" || user.Status == filter.Status {
+			out = append(out, user)
+		}
+	}
+	return out, nil
+}
+
+func (b *memoryBackend) Export(ctx context.Context, filter listFilter) ([]client.User, error) {
+	b.exports++
+	return b.List(ctx, filter)
+}
+
+func (b *memoryBackend) Get(ctx context.Context, id uint) (*client.User, error) {
+	for i := range b.users {
+		if b.users[i].ID == id {
+			user := b.users[i]
+			return &user, nil
+		}
+	}
+	return nil, client.ErrNotFound
+}
+
+func (b *memoryBackend) GetByUsername(ctx context.Context, username string) (*client.User, error) {
+	for i := range b.users {
+		if b.users[i].Username == username {
+			user := b.users[i]
+			return &user, nil
+		}
+	}
+	return nil, client.ErrNotFound
+}
+
+func (b *memoryBackend) Create(ctx context.Context, user client.User) (*client.User, error) {
+	if _, err := b.GetByUsername(ctx, user.Username); err == nil {
+		return nil, client.ErrUsernameTaken
+	}
+	b.nextID++
+	user.ID, user.Status = b.nextID, "active"
+	b.users = append(b.users, user)
+	return &user, nil
+}
+
+func (b *memoryBackend) Update(ctx context.Context, id uint, update client.User) error {
+	for i := range b.users {
+		if b.users[i].ID == id {
+			if update.Email != "" {
+				b.users[i].Email = update.Email
+			}
+			if update.Fullname != "" {
+				b.users[i].Fullname = update.Fullname
+			}
+			return nil
+		}
+	}
+	return client.ErrNotFound
+}
+
+func (b *memoryBackend) Delete(ctx context.Context, id uint) error {
+	for i := range b.users {
+		if b.users[i].ID == id {
+			b.users = append(b.users[:i], b.users[i+1:]...)
+			return nil
+		}
+	}
+	return client.ErrNotFound
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "List as a table",
+			args: []string{"list"},
+			want: "ID  USERNAME  EMAIL             FULLNAME      STATUS  ATTRIBUTES\n" +
+				"1   ada       ada@example.com   Ada Lovelace  active  {\"team\":\"eng\"}\n" +
+				"2   alan      alan@example.com                active  \n",
+		},
+		{
+			name: "Get by username as YAML",
+			args: []string{"-o", "yaml", "get", "@ada"},
+			want: "attributes:\n  team: eng\nemail: ada@example.com\nfullname: Ada Lovelace\nid: 1\nstatus: active\nusername: ada\n",
+		},
+		{
+			name:    "Get by bare username",
+			args:    []string{"get", "ada"},
+			wantErr: `"ada" is not a user ID, name users by username as @ada`,
+		},
+		{
+			name:    "Get a missing user",
+			args:    []string{"get", "9"},
+			wantErr: "client: user does not exist",
+		},
+		{
+			name: "Create as JSON",
+			args: []string{"-o", "json", "create", "-username", "grace", "-email", "grace@example.com", "-attributes", `{"team":"ops"}`},
+			want: "{\n  \"id\": 3,\n  \"username\": \"grace\",\n  \"email\": \"grace@example.com\",\n  \"status\": \"active\",\n  \"attributes\": {\n    \"team\": \"ops\"\n  }\n}\n",
+		},
+		{
+			name: "Update by ID",
+			args: []string{"-o", "json", "update", "2", "-fullname", "Alan Turing"},
+			want: "{\n  \"id\": 2,\n  \"username\": \"alan\",\n  \"email\": \"alan@example.com\",\n  \"fullname\": \"Alan Turing\",\n  \"status\": \"active\"\n}\n",
+		},
+		{
+			name:    "Update without fields",
+			args:    []string{"update", "2"},
+			wantErr: "nothing to update, set at least one of -username, -email, -fullname or -attributes",
+		},
+		{
+			name: "Delete by username",
+			args: []string{"delete", "@alan"},
+			want: "Deleted user 2 (alan).\n",
+		},
+		{
+			name:  "Import YAML with upsert",
+			args:  []string{"import", "-upsert"},
+			stdin: "- username: ada\n  email: ada@new.example.com\n- username: grace\n  email: grace@example.com\n",
+			want:  "Created 1, updated 1, failed 0.\n",
+		},
+		{
+			name:    "Import without upsert",
+			args:    []string{"import"},
+			stdin:   `[{"username":"ada","email":"ada@example.com"}]`,
+			want:    "ada: client: username has been taken\nCreated 0, updated 0, failed 1.\n",
+			wantErr: "1 of 1 users failed to import",
+		},
+		{
+			name:    "Unknown command",
+			args:    []string{"purge"},
+			wantErr: `unknown command "purge", available commands: completion, create, delete, export, get, import, list, update`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &memoryBackend{}
+			b.Create(context.Background(), client.User{Username: "ada", Email: "ada@example.com", Fullname: "Ada Lovelace", Attributes: map[string]any{"team": "eng"}})
+			b.Create(context.Background(), client.User{Username: "alan", Email: "alan@example.com"})
+
+			var stdout bytes.Buffer
+			a := &app{
+				stdin:       strings.NewReader(test.stdin),
+				stdout:      &stdout,
+				openBackend: func(*app) (backend, error) { return b, nil },
+			}
+
+			err := run(a, test.args)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, stdout.String())
+		})
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := &memoryBackend{}
+	src.Create(context.Background(), client.User{Username: "ada", Email: "ada@example.com", Attributes: map[string]any{"level": 3.0}})
+
+	var exported bytes.Buffer
+	err := run(&app{stdout: &exported, openBackend: func(*app) (backend, error) { return src, nil }}, []string{"-o", "yaml", "export"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, src.exports)
+
+	dst := &memoryBackend{nextID: 10}
+	err = run(&app{stdin: &exported, stdout: &bytes.Buffer{}, openBackend: func(*app) (backend, error) { return dst, nil }}, []string{"import"})
+	assert.NoError(t, err)
+	assert.Equal(t, []client.User{{ID: 11, Username: "ada", Email: "ada@example.com", Status: "active", Attributes: map[string]any{"level": 3.0}}}, dst.users)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/client"
+	"gopkg.in/yaml.v3"
+)
+
+var formats = []string{"table", "json", "yaml"}
+
+func validFormat(format string) bool {
+	return slices.Contains(formats, format)
+}
+
+func printUser(w io.Writer, format string, user *client.User) error {
+	if format == "table" {
+		return printTable(w, []client.User{*user})
+	}
+
+	return printData(w, format, user)
+}
+
+func printUsers(w io.Writer, format string, users []client.User) error {
+	if format == "table" {
+		return printTable(w, users)
+	}
+	if users == nil {
+		users = []client.User{}
+	}
+
+	return printData(w, format, users)
+}
+
+// printData writes v as JSON or YAML. YAML goes through JSON, so both use
+// the API's field names.
+func printData(w io.Writer, format string, v any) error {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		_, err = fmt.Fprintf(w, "%s\n", raw)
+		return err
+	}
+
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+func printTable(w io.Writer, users []client.User) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSERNAME\tEMAIL\tFULLNAME\tSTATUS\tATTRIBUTES")
+	for _, user := range users {
+		status := user.Status
+		if user.SuspendedUntil != nil {
+			status += " until " + user.SuspendedUntil.Format(time.RFC3339)
+		}
+		attributes := ""
+		if len(user.Attributes) > 0 {
+			raw, err := json.Marshal(user.Attributes)
+			if err != nil {
+				return err
+			}
+			attributes = string(raw)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", user.ID, user.Username, user.Email, user.Fullname, status, attributes)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"gorm.io/gorm"
+)
+
+// Filter narrows the entries returned by Find. Zero values match everything.
+type Filter struct {
+	Actor  string
+	Action string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// Find returns the entries of the organization in db's context matching
+// filter, newest first.
+func Find(db *gorm.DB, filter Filter) ([]models.AuditEntries, error) {
+	if filter.Actor != "" {
+		db = db.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		db = db.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		db = db.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		db = db.Where("created_at < ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+
+	var entries []models.AuditEntries
+	if err := db.Order("seq DESC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
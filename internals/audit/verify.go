@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"gorm.io/gorm"
+)
+
+// verifyBatchSize is how many entries Verify reads at a time.
+const verifyBatchSize = 500
+
+// Broken describes the first entry at which a chain fails verification.
+type Broken struct {
+	OrganizationID uint
+	Seq            uint64
+	Reason         string
+}
+
+func (b *Broken) Error() string {
+	return fmt.Sprintf("audit chain of organization %d broken at seq %d: %s", b.OrganizationID, b.Seq, b.Reason)
+}
+
+// Verify walks every organization's chain and returns the number of entries
+// checked. It returns a *Broken error at the first entry that was altered,
+// removed or inserted out of order, or when a chain doesn't end at its head
+// in audit_chains.
+func Verify(ctx context.Context, db *gorm.DB) (int, error) {
+	db = db.WithContext(tenant.WithoutScope(ctx))
+
+	// a chain whose entries were all removed still has its head
+	var entryOrgIDs, chainOrgIDs []uint
+	if err := db.Model(&models.AuditEntries{}).Distinct().Pluck("organization_id", &entryOrgIDs).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Model(&models.AuditChains{}).Pluck("organization_id", &chainOrgIDs).Error; err != nil {
+		return 0, err
+	}
+	orgIDs := append(entryOrgIDs, chainOrgIDs...)
+	slices.Sort(orgIDs)
+	orgIDs = slices.Compact(orgIDs)
+
+	checked := 0
+	for _, orgID := range orgIDs {
+		n, err := verifyChain(db, orgID)
+		checked += n
+		if err != nil {
+			return checked, err
+		}
+	}
+
+	return checked, nil
+}
+
+func verifyChain(db *gorm.DB, orgID uint) (int, error) {
+	var head models.AuditChains
+	if err := db.Where("organization_id = ?", orgID).Limit(1).Find(&head).Error; err != nil {
+		return 0, err
+	}
+
+	var prev models.AuditEntries
+	checked := 0
+	for {
+		var batch []models.AuditEntries
+		err := db.Where("organization_id = ? AND seq > ?", orgID, prev.Seq).
+			Order("seq").
+			Limit(verifyBatchSize).
+			Find(&batch).Error
+		if err != nil {
+			return checked, err
+		}
+		if len(batch) == 0 {
+			return checked, checkHead(orgID, prev, head)
+		}
+
+		for _, entry := range batch {
+			if err := checkLink(prev, entry); err != nil {
+				return checked, err
+			}
+
+			prev = entry
+			checked++
+		}
+	}
+}
+
+// checkHead verifies that last, the last entry of the organization's chain,
+// is the head recorded in audit_chains, so entries removed from the end are
+// noticed too.
+func checkHead(orgID uint, last models.AuditEntries, head models.AuditChains) error {
+	switch {
+	case last.Seq < head.Seq:
+		return &Broken{OrganizationID: orgID, Seq: last.Seq + 1, Reason: "entries missing at the tail"}
+	case last.Seq > head.Seq:
+		return &Broken{OrganizationID: orgID, Seq: head.Seq + 1, Reason: "entries after the chain head"}
+	case last.Hash != head.Hash:
+		return &Broken{OrganizationID: orgID, Seq: last.Seq, Reason: "hash does not match the chain head"}
+	}
+
+	return nil
+}
+
+// checkLink verifies that entry directly follows prev, the zero entry for
+// the first entry of a chain.
+func checkLink(prev, entry models.AuditEntries) error {
+	if entry.Seq != prev.Seq+1 {
+		return &Broken{OrganizationID: entry.OrganizationID, Seq: prev.Seq + 1, Reason: "entry missing"}
+	}
+	if entry.PrevHash != prev.Hash {
+		return &Broken{OrganizationID: entry.OrganizationID, Seq: entry.Seq, Reason: "previous hash does not match"}
+	}
+
+	hash, err := entry.ChainHash()
+	if err != nil {
+		return err
+	}
+	if hash != entry.Hash {
+		return &Broken{OrganizationID: entry.OrganizationID, Seq: entry.Seq, Reason: "entry was modified"}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func chain(t *testing.T, n int) []models.AuditEntries {
+	var entries []models.AuditEntries
+	prev := models.AuditEntries{}
+	for i := 0; i < n; i++ {
+		entry := models.AuditEntries{
+			OrganizationID: 1,
+			Seq:            prev.Seq + 1,
+			Actor:          "obi",
+			Action:         models.AuditUserDeleted,
+			TargetType:     "user",
+			TargetID:       "7",
+			Details:        models.Attributes{"username": "marry"},
+			CreatedAt:      time.Date(2024, 6, 1, 12, 0, i, 1000, time.UTC),
+			PrevHash:       prev.Hash,
+		}
+		hash, err := entry.ChainHash()
+		if err != nil {
+			t.Fatalf("Unable to hash entry %v", err)
+		}
+		entry.Hash = hash
+
+		entries = append(entries, entry)
+		prev = entry
+	}
+
+	return entries
+}
+
+// head is the audit_chains row that n entries of chain leave behind.
+func head(t *testing.T, n int) models.AuditChains {
+	last := chain(t, n)[n-1]
+	return models.AuditChains{OrganizationID: 1, Seq: last.Seq, Hash: last.Hash}
+}
+
+func verifyEntries(entries []models.AuditEntries, head models.AuditChains) error {
+	prev := models.AuditEntries{}
+	for _, entry := range entries {
+		if err := checkLink(prev, entry); err != nil {
+			return err
+		}
+		prev = entry
+	}
+
+	return checkHead(1, prev, head)
+}
+
+func TestVerifyIntactChain(t *testing.T) {
+	assert.NoError(t, verifyEntries(chain(t, 5), head(t, 5)))
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	modified := chain(t, 5)
+	modified[2].Actor = "someone-else"
+	assert.EqualError(t, verifyEntries(modified, head(t, 5)), "audit chain of organization 1 broken at seq 3: entry was modified")
+
+	removed := chain(t, 5)
+	removed = append(removed[:2], removed[3:]...)
+	assert.EqualError(t, verifyEntries(removed, head(t, 5)), "audit chain of organization 1 broken at seq 3: entry missing")
+
+	// rewriting an entry and its own hash still breaks the next link
+	rehashed := chain(t, 5)
+	rehashed[1].Details = models.Attributes{"username": "obi"}
+	rehashed[1].Hash, _ = rehashed[1].ChainHash()
+	assert.EqualError(t, verifyEntries(rehashed, head(t, 5)), "audit chain of organization 1 broken at seq 3: previous hash does not match")
+
+	// removing the newest entries leaves an intact but short chain
+	truncated := chain(t, 5)[:3]
+	assert.EqualError(t, verifyEntries(truncated, head(t, 5)), "audit chain of organization 1 broken at seq 4: entries missing at the tail")
+
+	// so does rewriting the newest entry with a fresh hash
+	replaced := chain(t, 5)
+	replaced[4].Actor = "someone-else"
+	replaced[4].Hash, _ = replaced[4].ChainHash()
+	assert.EqualError(t, verifyEntries(replaced, head(t, 5)), "audit chain of organization 1 broken at seq 5: hash does not match the chain head")
+}
+
+func TestVerify(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Unable to open sqlite %s", err.Error())
+	}
+	if err := db.AutoMigrate(&models.AuditEntries{}, &models.AuditChains{}); err != nil {
+		t.Fatalf("Unable to migrate %s", err.Error())
+	}
+
+	assert.NoError(t, db.Create(chain(t, 3)).Error)
+	assert.NoError(t, db.Create(&models.AuditChains{OrganizationID: 1, Seq: 3, Hash: head(t, 3).Hash}).Error)
+	// every entry of organization 2 was removed
+	assert.NoError(t, db.Create(&models.AuditChains{OrganizationID: 2, Seq: 1, Hash: "x"}).Error)
+
+	checked, err := Verify(context.Background(), db)
+	assert.Equal(t, 3, checked)
+	assert.EqualError(t, err, "audit chain of organization 2 broken at seq 1: entries missing at the tail")
+}
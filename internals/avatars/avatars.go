@@ -0,0 +1,107 @@
+package avatars
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+
+	// register decoders for the accepted upload formats
+	_ "image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Sizes are the square thumbnail edges, in pixels, generated for every
+// upload.
+var Sizes = []int{64, 128, 256}
+
+// DefaultSize is served when no size is requested.
+const DefaultSize = 128
+
+// ContentType of every generated thumbnail.
+const ContentType = "image/png"
+
+// MaxPixels bounds the width × height of an upload, as decoding allocates
+// memory for every pixel however small the compressed file is.
+const MaxPixels = 16 << 20
+
+var (
+	// ErrUnsupportedType is returned for uploads that are not PNG, JPEG or
+	// WebP.
+	ErrUnsupportedType = errors.New("avatar must be a PNG, JPEG or WebP image")
+	// ErrTooManyPixels is returned for uploads larger than MaxPixels.
+	ErrTooManyPixels = errors.New("avatar must not have more than 16 megapixels")
+)
+
+var acceptedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+}
+
+// Thumbnails validates an uploaded image by sniffing it and checking its
+// dimensions before decoding it, then returns a center-cropped square PNG
+// for each of Sizes, keyed by size, and a hash identifying the upload.
+func Thumbnails(data []byte) (map[int][]byte, string, error) {
+	if !acceptedTypes[http.DetectContentType(data)] {
+		return nil, "", ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedType
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, "", ErrTooManyPixels
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedType
+	}
+
+	square := cropSquare(src)
+	thumbs := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), square, square.Bounds(), draw.Src, nil)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, "", err
+		}
+		thumbs[size] = buf.Bytes()
+	}
+
+	sum := sha256.Sum256(data)
+	return thumbs, hex.EncodeToString(sum[:8]), nil
+}
+
+// ValidSize reports whether size is one of the generated thumbnail sizes.
+func ValidSize(size int) bool {
+	for _, s := range Sizes {
+		if s == size {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cropSquare(src image.Image) image.Image {
+	b := src.Bounds()
+	edge := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-edge)/2
+	y := b.Min.Y + (b.Dy()-edge)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, edge, edge))
+	draw.Draw(dst, dst.Bounds(), src, image.Pt(x, y), draw.Src)
+
+	return dst
+}
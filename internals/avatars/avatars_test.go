@@ -0,0 +1,81 @@
+package avatars
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnails(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for x := 0; x < 300; x++ {
+		for y := 0; y < 200; y++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 0xff})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatalf("Unable to encode test image %v", err)
+	}
+
+	thumbs, hash, err := Thumbnails(buf.Bytes())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, hash)
+	assert.Len(t, thumbs, len(Sizes))
+
+	for _, size := range Sizes {
+		img, err := png.Decode(bytes.NewReader(thumbs[size]))
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, size, size), img.Bounds())
+	}
+}
+
+func TestThumbnailsRejectsOtherContent(t *testing.T) {
+	tests := map[string][]byte{
+		"text":      []byte("definitely not an image"),
+		"gif":       []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"),
+		"truncated": []byte("\x89PNG\r\n\x1a\n\x00\x00"),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := Thumbnails(data)
+			assert.ErrorIs(t, err, ErrUnsupportedType)
+		})
+	}
+}
+
+func TestThumbnailsRejectsTooManyPixels(t *testing.T) {
+	// a PNG header claiming 65535×65535 pixels decodes to 16 GiB
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("Unable to encode test image %v", err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 0xffff)
+	binary.BigEndian.PutUint32(data[20:], 0xffff)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	_, _, err := Thumbnails(data)
+	assert.ErrorIs(t, err, ErrTooManyPixels)
+}
+
+func TestIdenticonIsStable(t *testing.T) {
+	a, err := Identicon("1/obi", 64)
+	assert.NoError(t, err)
+	b, err := Identicon("1/obi", 64)
+	assert.NoError(t, err)
+	c, err := Identicon("1/marry", 64)
+	assert.NoError(t, err)
+
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
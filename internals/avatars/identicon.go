@@ -0,0 +1,47 @@
+package avatars
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// identiconGrid is the number of cells along each edge of an identicon.
+const identiconGrid = 5
+
+// Identicon renders a size x size PNG derived from seed: a horizontally
+// mirrored 5x5 grid of cells coloured from the seed's hash, so each user gets
+// a stable placeholder.
+func Identicon(seed string, size int) ([]byte, error) {
+	sum := sha256.Sum256([]byte(seed))
+	fg := color.RGBA{R: sum[0], G: sum[1], B: sum[2], A: 0xff}
+	bg := color.RGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 0xff}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	cell := float64(size) / identiconGrid
+	for y := 0; y < size; y++ {
+		row := int(float64(y) / cell)
+		for x := 0; x < size; x++ {
+			col := int(float64(x) / cell)
+			// mirror the right half onto the left
+			if col > identiconGrid/2 {
+				col = identiconGrid - 1 - col
+			}
+
+			c := bg
+			if sum[3+row*3+col]%2 == 0 {
+				c = fg
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,49 @@
+// Package broker publishes user events to a message broker. Events are read
+// from the outbox the models write in the same transaction as each user
+// change, wrapped in CloudEvents 1.0 envelopes and handed to a Publisher.
+package broker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+)
+
+// ErrClosed is returned when publishing to a closed Publisher.
+var ErrClosed = errors.New("broker: publisher closed")
+
+// Publisher sends events to a broker. Publish returns only once the broker
+// has accepted the event, so a nil error means it will not be lost.
+type Publisher interface {
+	Publish(ctx context.Context, event CloudEvent) error
+	Close() error
+}
+
+// Default is the publisher configured by Init, nil when publishing is off.
+var Default Publisher
+
+// Init sets up Default from cfg.Broker ("nats", "kafka" or empty to
+// disable publishing).
+func Init(cfg config.Events) {
+	switch cfg.Broker {
+	case "":
+		return
+	case "nats":
+		publisher, err := DialNATS(cfg.NATSURL, cfg.NATSSubjectPrefix, cfg.NATSJetStream)
+		if err != nil {
+			slog.Error("Unable to connect to NATS", "error", err)
+			os.Exit(1)
+		}
+		Default = publisher
+		slog.Info("Publishing events to NATS")
+	case "kafka":
+		Default = NewKafka(cfg.KafkaBrokers, cfg.KafkaTopic)
+		slog.Info("Publishing events to Kafka")
+	default:
+		slog.Error("EVENT_BROKER must be nats or kafka", "broker", cfg.Broker)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,185 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var testEvent = models.Events{
+	ID:             7,
+	OrganizationID: 2,
+	Type:           models.EventUserUpdated,
+	UserID:         3,
+	Data:           models.Attributes{"actor": "obi"},
+	CreatedAt:      time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestNewCloudEvent(t *testing.T) {
+	body, err := json.Marshal(NewCloudEvent(testEvent))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"specversion": "1.0",
+		"id": "7",
+		"source": "/users-api/organizations/2",
+		"type": "user.updated",
+		"subject": "users/3",
+		"time": "2024-06-01T12:00:00Z",
+		"datacontenttype": "application/json",
+		"data": {"actor": "obi"}
+	}`, string(body))
+}
+
+func TestNATSPublish(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	server := natsserver.RunServer(&opts)
+	defer server.Shutdown()
+
+	publisher, err := DialNATS(server.ClientURL(), "users", false)
+	assert.NoError(t, err)
+	defer publisher.Close()
+
+	sub, err := publisher.Conn.SubscribeSync("users.>")
+	assert.NoError(t, err)
+
+	assert.NoError(t, publisher.Publish(context.Background(), NewCloudEvent(testEvent)))
+
+	msg, err := sub.NextMsg(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "users.user.updated", msg.Subject)
+	assert.Equal(t, ContentType, msg.Header.Get("Content-Type"))
+
+	var received CloudEvent
+	assert.NoError(t, json.Unmarshal(msg.Data, &received))
+	assert.Equal(t, "7", received.ID)
+	assert.Equal(t, "users/3", received.Subject)
+}
+
+func TestNATSJetStreamDeduplicates(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	server := natsserver.RunServer(&opts)
+	defer server.Shutdown()
+
+	publisher, err := DialNATS(server.ClientURL(), "users", true)
+	assert.NoError(t, err)
+	defer publisher.Close()
+
+	_, err = publisher.JetStream.AddStream(&nats.StreamConfig{Name: "USERS", Subjects: []string{"users.>"}})
+	assert.NoError(t, err)
+
+	// a redelivery after a crash publishes the same event again
+	assert.NoError(t, publisher.Publish(context.Background(), NewCloudEvent(testEvent)))
+	assert.NoError(t, publisher.Publish(context.Background(), NewCloudEvent(testEvent)))
+
+	info, err := publisher.JetStream.StreamInfo("USERS")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), info.State.Msgs)
+}
+
+// fakeKafka stands in for a Kafka cluster.
+type fakeKafka struct {
+	messages []kafka.Message
+	err      error
+}
+
+func (f *fakeKafka) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.messages = append(f.messages, msgs...)
+	return nil
+}
+
+func (f *fakeKafka) Close() error { return nil }
+
+func TestNewKafka(t *testing.T) {
+	writer := NewKafka([]string{"localhost:9092"}, "users").Writer.(*kafka.Writer)
+	assert.Equal(t, kafkaBatchTimeout, writer.BatchTimeout)
+	assert.Equal(t, kafka.RequireAll, writer.RequiredAcks)
+}
+
+func TestKafkaPublish(t *testing.T) {
+	writer := &fakeKafka{}
+	publisher := &Kafka{Writer: writer}
+
+	assert.NoError(t, publisher.Publish(context.Background(), NewCloudEvent(testEvent)))
+	assert.Len(t, writer.messages, 1)
+
+	msg := writer.messages[0]
+	assert.Equal(t, "/users-api/organizations/2/users/3", string(msg.Key))
+	assert.Equal(t, []kafka.Header{{Key: "content-type", Value: []byte(ContentType)}}, msg.Headers)
+
+	var received CloudEvent
+	assert.NoError(t, json.Unmarshal(msg.Value, &received))
+	assert.Equal(t, models.EventUserUpdated, received.Type)
+
+	writer.err = errors.New("kafka: leader not available")
+	assert.EqualError(t, publisher.Publish(context.Background(), NewCloudEvent(testEvent)), "kafka: leader not available")
+}
+
+func TestChannelPublish(t *testing.T) {
+	publisher := NewChannel(1)
+
+	assert.NoError(t, publisher.Publish(context.Background(), NewCloudEvent(testEvent)))
+
+	// the buffer is full, so this waits until the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, publisher.Publish(ctx, NewCloudEvent(testEvent)), context.DeadlineExceeded)
+
+	received := <-publisher.Events()
+	assert.Equal(t, "7", received.ID)
+
+	assert.NoError(t, publisher.Close())
+	assert.ErrorIs(t, publisher.Publish(context.Background(), NewCloudEvent(testEvent)), ErrClosed)
+	_, open := <-publisher.Events()
+	assert.False(t, open)
+}
+
+func TestRelayEventsCommittedOutOfOrder(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Unable to open sqlite %s", err.Error())
+	}
+	if err := db.AutoMigrate(&models.Events{}, &models.EventCursors{}); err != nil {
+		t.Fatalf("Unable to migrate %s", err.Error())
+	}
+
+	publisher := NewChannel(10)
+	relay := NewRelay(db, publisher)
+	commit := func(id uint) {
+		assert.NoError(t, db.Create(&models.Events{ID: id, OrganizationID: 1, Type: models.EventUserCreated, UserID: 1}).Error)
+	}
+	publish := func() []string {
+		n, err := relay.Publish(context.Background())
+		assert.NoError(t, err)
+		ids := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			ids = append(ids, (<-publisher.Events()).ID)
+		}
+		return ids
+	}
+	assert.Empty(t, publish())
+
+	// 2 gets its ID before 3 but commits after it
+	commit(1)
+	commit(3)
+	assert.Equal(t, []string{"1", "3"}, publish())
+	commit(2)
+	assert.Equal(t, []string{"2"}, publish())
+	assert.Empty(t, publish())
+}
@@ -0,0 +1,51 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// Channel publishes to an in-process channel, for consumers running inside
+// the API and for tests. Publish blocks while the buffer is full.
+type Channel struct {
+	events chan CloudEvent
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewChannel returns a Channel buffering up to size events.
+func NewChannel(size int) *Channel {
+	return &Channel{events: make(chan CloudEvent, size)}
+}
+
+// Events returns the channel published events are received from. It is
+// closed by Close.
+func (c *Channel) Events() <-chan CloudEvent {
+	return c.events
+}
+
+func (c *Channel) Publish(ctx context.Context, event CloudEvent) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	select {
+	case c.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Channel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.events)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package broker
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+)
+
+// ContentType is the media type of a CloudEvent in structured mode, where
+// the whole envelope is the message body.
+const ContentType = "application/cloudevents+json"
+
+// Source identifies this service as the CloudEvents source; the organization
+// is appended to it.
+var Source = "/users-api"
+
+// CloudEvent is a CloudEvents 1.0 envelope
+// (https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md).
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype,omitempty"`
+	Data            any       `json:"data,omitempty"`
+}
+
+// NewCloudEvent wraps an outbox event. Its ID is the outbox ID, so a
+// redelivered event keeps the ID consumers deduplicate on, and its subject
+// is the user it is about.
+func NewCloudEvent(event models.Events) CloudEvent {
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              strconv.FormatUint(uint64(event.ID), 10),
+		Source:          Source + "/organizations/" + strconv.FormatUint(uint64(event.OrganizationID), 10),
+		Type:            event.Type,
+		Subject:         "users/" + strconv.FormatUint(uint64(event.UserID), 10),
+		Time:            event.CreatedAt.UTC(),
+		DataContentType: "application/json",
+		Data:            event.Data,
+	}
+}
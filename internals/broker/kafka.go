@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaWriter is the part of *kafka.Writer Kafka uses, so tests can stand in
+// for a cluster.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Kafka publishes events to a topic in structured mode. Messages are keyed by
+// source and subject, so every event of a user lands on the same partition
+// and stays in order.
+type Kafka struct {
+	Writer kafkaWriter
+	// Brokers are dialed by Ping.
+	Brokers []string
+}
+
+// kafkaBatchTimeout is how long the writer waits for more messages before
+// sending a batch. The relay writes one event at a time and waits for it,
+// inside the transaction locking its cursor, so kafka-go's 1s default would
+// cap it at an event a second.
+const kafkaBatchTimeout = 5 * time.Millisecond
+
+// NewKafka returns a Kafka publisher that waits for every in-sync replica to
+// acknowledge each event.
+func NewKafka(brokers []string, topic string) *Kafka {
+	return &Kafka{
+		Writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: kafkaBatchTimeout,
+		},
+		Brokers: brokers,
+	}
+}
+
+func (k *Kafka) Publish(ctx context.Context, event CloudEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return k.Writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(strings.Join([]string{event.Source, event.Subject}, "/")),
+		Value: body,
+		Headers: []kafka.Header{
+			{Key: "content-type", Value: []byte(ContentType)},
+		},
+	})
+}
+
+// Ping succeeds once any broker accepts a connection.
+func (k *Kafka) Ping(ctx context.Context) error {
+	var err error
+	for _, broker := range k.Brokers {
+		var conn *kafka.Conn
+		conn, err = kafka.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn.Close()
+		}
+	}
+
+	return err
+}
+
+func (k *Kafka) Close() error {
+	return k.Writer.Close()
+}
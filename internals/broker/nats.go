@@ -0,0 +1,85 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS publishes each event to "<prefix>.<type>", e.g. "users.user.created".
+// Plain NATS only waits for the server to have received the message; with
+// JetStream it waits for the stream to store it, and the event ID is sent as
+// Nats-Msg-Id so the stream drops redelivered duplicates.
+type NATS struct {
+	Conn          *nats.Conn
+	SubjectPrefix string
+	// JetStream is nil for plain NATS.
+	JetStream nats.JetStreamContext
+}
+
+// natsTimeout bounds waiting for the server when ctx has no deadline.
+const natsTimeout = 10 * time.Second
+
+// DialNATS connects to url.
+func DialNATS(url, subjectPrefix string, jetStream bool) (*NATS, error) {
+	conn, err := nats.Connect(url, nats.Name("users-api"))
+	if err != nil {
+		return nil, err
+	}
+
+	n := &NATS{Conn: conn, SubjectPrefix: subjectPrefix}
+	if jetStream {
+		n.JetStream, err = conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+func (n *NATS) Publish(ctx context.Context, event CloudEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, natsTimeout)
+		defer cancel()
+	}
+
+	msg := nats.NewMsg(n.SubjectPrefix + "." + event.Type)
+	msg.Header.Set("Content-Type", ContentType)
+	msg.Data = body
+
+	if n.JetStream != nil {
+		msg.Header.Set(nats.MsgIdHdr, event.ID)
+		_, err := n.JetStream.PublishMsg(msg, nats.Context(ctx))
+		return err
+	}
+
+	if err := n.Conn.PublishMsg(msg); err != nil {
+		return err
+	}
+
+	return n.Conn.FlushWithContext(ctx)
+}
+
+// Ping fails while the connection is down, e.g. reconnecting.
+func (n *NATS) Ping(ctx context.Context) error {
+	if !n.Conn.IsConnected() {
+		return fmt.Errorf("broker: NATS connection is %s", n.Conn.Status())
+	}
+
+	return nil
+}
+
+func (n *NATS) Close() error {
+	return n.Conn.Drain()
+}
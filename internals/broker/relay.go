@@ -0,0 +1,96 @@
+package broker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"gorm.io/gorm"
+)
+
+// cursorName is the outbox consumer name of the relay.
+const cursorName = "broker"
+
+// Relay publishes outbox events by ID, except those committed late, which
+// are published once they appear. The outbox cursor only moves past an event
+// once the publisher has accepted it, so every event is delivered at least
+// once: a crash or broker outage means the unacknowledged events are
+// published again on the next pass, with the same CloudEvent ID.
+type Relay struct {
+	DB        *gorm.DB
+	Publisher Publisher
+	BatchSize int
+}
+
+func NewRelay(db *gorm.DB, publisher Publisher) *Relay {
+	return &Relay{DB: db, Publisher: publisher, BatchSize: 100}
+}
+
+// Run publishes new events every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Publish(ctx); err != nil {
+				slog.ErrorContext(ctx, "Unable to publish events", "error", err)
+			}
+		}
+	}
+}
+
+// Flush publishes every pending event, e.g. those written by the last
+// requests before shutdown, stopping early when ctx is done.
+func (r *Relay) Flush(ctx context.Context) error {
+	for ctx.Err() == nil {
+		n, err := r.Publish(ctx)
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Publish publishes one batch of new events and returns how many the
+// publisher accepted. On a publish error the cursor still advances past the
+// events before the failed one.
+func (r *Relay) Publish(ctx context.Context) (int, error) {
+	published := 0
+	var publishErr error
+	err := r.DB.WithContext(tenant.WithoutScope(ctx)).Transaction(func(tx *gorm.DB) error {
+		cursor, err := models.LockEventCursor(tx, cursorName)
+		if err != nil {
+			return err
+		}
+
+		events, err := models.GetPendingEvents(tx, cursor, r.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		for _, event := range events {
+			if publishErr = r.Publisher.Publish(ctx, NewCloudEvent(event)); publishErr != nil {
+				break
+			}
+			published++
+		}
+		if published == 0 {
+			return nil
+		}
+
+		cursor.Advance(models.EventIDs(events[:published]), time.Now())
+		return models.SaveEventCursor(tx, cursor)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return published, publishErr
+}
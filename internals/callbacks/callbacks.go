@@ -0,0 +1,43 @@
+// Package callbacks registers GORM callbacks around every operation, for
+// plugins that observe statements.
+package callbacks
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Hooks returns the callbacks to run before and after every other callback
+// of operation.
+type Hooks func(operation string) (before, after func(*gorm.DB))
+
+// Around registers the hooks of every operation, named prefix:before_create,
+// prefix:after_create and so on, so plugins can't miss one.
+func Around(db *gorm.DB, prefix string, hooks Hooks) error {
+	cb := db.Callback()
+
+	return errors.Join(
+		around(cb.Create().Before("*"), cb.Create().After("*"), prefix, "create", hooks),
+		around(cb.Query().Before("*"), cb.Query().After("*"), prefix, "query", hooks),
+		around(cb.Update().Before("*"), cb.Update().After("*"), prefix, "update", hooks),
+		around(cb.Delete().Before("*"), cb.Delete().After("*"), prefix, "delete", hooks),
+		around(cb.Row().Before("*"), cb.Row().After("*"), prefix, "row", hooks),
+		around(cb.Raw().Before("*"), cb.Raw().After("*"), prefix, "raw", hooks),
+	)
+}
+
+// registerer is a GORM callback placed before or after the others; GORM
+// doesn't export its type.
+type registerer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+func around(first, last registerer, prefix, operation string, hooks Hooks) error {
+	before, after := hooks(operation)
+	if err := first.Register(prefix+":before_"+operation, before); err != nil {
+		return err
+	}
+
+	return last.Register(prefix+":after_"+operation, after)
+}
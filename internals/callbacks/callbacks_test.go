@@ -0,0 +1,44 @@
+package callbacks
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestAround(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Unable to open sqlite %s", err.Error())
+	}
+
+	type item struct{ ID uint }
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatalf("Unable to migrate %s", err.Error())
+	}
+
+	var ran []string
+	err = Around(db, "test", func(operation string) (before, after func(*gorm.DB)) {
+		before = func(*gorm.DB) { ran = append(ran, "before "+operation) }
+		after = func(*gorm.DB) { ran = append(ran, "after "+operation) }
+		return before, after
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Create(&item{}).Error)
+	assert.NoError(t, db.Find(&[]item{}).Error)
+	assert.NoError(t, db.Model(&item{}).Where("id = ?", 1).Update("id", 2).Error)
+	assert.NoError(t, db.Delete(&item{}, 2).Error)
+	assert.NoError(t, db.Raw("SELECT 1").Row().Err())
+	assert.NoError(t, db.Exec("SELECT 1").Error)
+	assert.Equal(t, []string{
+		"before create", "after create",
+		"before query", "after query",
+		"before update", "after update",
+		"before delete", "after delete",
+		"before row", "after row",
+		"before raw", "after raw",
+	}, ran)
+}
@@ -1,19 +1,712 @@
+// Package config loads the API's settings. Every setting has a default and
+// may be overridden, in increasing order of precedence, by a YAML or TOML
+// file, an environment variable and a command-line flag.
 package config
 
 import (
-	"log"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/obimadu/ipc3-stage-2/internals/db"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
-func Config() {
+// Config holds every setting. The yaml tag is the key in config files and,
+// prefixed with its section, the flag name, e.g. -database.max_open_conns.
+// Fields tagged secret are redacted when the config is printed.
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Tenant    Tenant    `yaml:"tenant"`
+	Avatars   Avatars   `yaml:"avatars"`
+	Events    Events    `yaml:"events"`
+	Jobs      Jobs      `yaml:"jobs"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Log       Log       `yaml:"log"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	CORS      CORS      `yaml:"cors"`
+}
+
+type Server struct {
+	Port            int           `yaml:"port" env:"PORT" usage:"HTTP port"`
+	GRPCPort        int           `yaml:"grpc_port" env:"GRPC_PORT" usage:"gRPC port"`
+	AdminPort       int           `yaml:"admin_port" env:"ADMIN_PORT" usage:"port serving /metrics and /health/details"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"time allowed to drain requests and flush workers on shutdown"`
+	DrainDelay      time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY" usage:"time /readyz fails before the listeners close on shutdown"`
+	RequestTimeout  time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" usage:"time allowed to handle a request before answering 504, 0 for none"`
+	RouteTimeouts   []string      `yaml:"route_timeouts" env:"ROUTE_TIMEOUTS" usage:"comma-separated per-route overrides of request_timeout, e.g. PUT /api/users/:userID/avatar=1m"`
+	TrustedProxies  []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"comma-separated proxy IPs or CIDRs whose X-Forwarded-For names the client"`
+	MaxBodyBytes    int64         `yaml:"max_body_bytes" env:"MAX_BODY_BYTES" usage:"largest accepted JSON request body"`
+}
+
+// Timeouts returns the route_timeouts overrides by "METHOD /route". Validate
+// has checked them.
+func (s Server) Timeouts() map[string]time.Duration {
+	timeouts := make(map[string]time.Duration, len(s.RouteTimeouts))
+	for _, entry := range s.RouteTimeouts {
+		if route, timeout, err := parseRouteTimeout(entry); err == nil {
+			timeouts[route] = timeout
+		}
+	}
+
+	return timeouts
+}
+
+// parseRouteTimeout splits an entry like "GET /api/users/=10s".
+func parseRouteTimeout(entry string) (string, time.Duration, error) {
+	route, value, err := parseRouteEntry(entry, "timeout")
+	if err != nil {
+		return "", 0, err
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return "", 0, fmt.Errorf("%q must end with a duration, e.g. 1m", entry)
+	}
+
+	return route, timeout, nil
+}
+
+// parseRouteEntry splits a per-route setting like "get /api/users/=value"
+// into "GET /api/users/" and "value".
+func parseRouteEntry(entry, name string) (string, string, error) {
+	route, value, ok := strings.Cut(entry, "=")
+	method, path, _ := strings.Cut(strings.TrimSpace(route), " ")
+	if !ok || method == "" || !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("%q must look like METHOD /route=%s", entry, name)
+	}
+
+	return strings.ToUpper(method) + " " + path, strings.TrimSpace(value), nil
+}
+
+type Database struct {
+	Driver         string        `yaml:"driver" env:"DB_DRIVER" usage:"postgres, mysql or sqlite"`
+	PostgresDSN    string        `yaml:"postgres_dsn" env:"POSTGRES_DSN" secret:"true" usage:"DSN used with the postgres driver"`
+	MysqlDSN       string        `yaml:"mysql_dsn" env:"MYSQL_DSN" secret:"true" usage:"DSN used with the mysql driver"`
+	SqlitePath     string        `yaml:"sqlite_path" env:"SQLITE_PATH" usage:"database file used with the sqlite driver"`
+	MaxIdleConns   int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" usage:"idle connections kept in the pool"`
+	MaxOpenConns   int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" usage:"most connections open at once"`
+	ConnectRetries int           `yaml:"connect_retries" env:"DB_CONNECT_RETRIES" usage:"times to retry connecting at startup"`
+	ConnectBackoff time.Duration `yaml:"connect_backoff" env:"DB_CONNECT_BACKOFF" usage:"wait between connection attempts"`
+	SlowQuery      time.Duration `yaml:"slow_query" env:"DB_SLOW_QUERY" usage:"queries taking longer are logged as warnings"`
+}
+
+type Tenant struct {
+	BaseDomain  string `yaml:"base_domain" env:"TENANT_BASE_DOMAIN" usage:"base domain whose subdomains name organizations"`
+	TokenSecret string `yaml:"token_secret" env:"TENANT_TOKEN_SECRET" secret:"true" usage:"secret verifying bearer tokens with an org claim"`
+	AdminToken  string `yaml:"admin_token" env:"TENANT_ADMIN_TOKEN" secret:"true" usage:"bearer token allowed to manage organizations and their attribute definitions, empty disables them"`
+}
+
+type Avatars struct {
+	Storage     string `yaml:"storage" env:"AVATAR_STORAGE" usage:"disk or s3"`
+	DiskPath    string `yaml:"disk_path" env:"AVATAR_DISK_PATH" usage:"directory avatars are stored in with disk storage"`
+	MaxBytes    int64  `yaml:"max_bytes" env:"AVATAR_MAX_BYTES" usage:"largest accepted upload"`
+	S3Endpoint  string `yaml:"s3_endpoint" env:"S3_ENDPOINT" usage:"S3-compatible endpoint"`
+	S3Region    string `yaml:"s3_region" env:"S3_REGION" usage:"S3 region"`
+	S3Bucket    string `yaml:"s3_bucket" env:"S3_BUCKET" usage:"S3 bucket"`
+	S3AccessKey string `yaml:"s3_access_key" env:"S3_ACCESS_KEY" usage:"S3 access key"`
+	S3SecretKey string `yaml:"s3_secret_key" env:"S3_SECRET_KEY" secret:"true" usage:"S3 secret key"`
+}
+
+type Events struct {
+	Broker            string   `yaml:"broker" env:"EVENT_BROKER" usage:"nats or kafka to publish user events, empty for none"`
+	NATSURL           string   `yaml:"nats_url" env:"NATS_URL" usage:"NATS server"`
+	NATSSubjectPrefix string   `yaml:"nats_subject_prefix" env:"NATS_SUBJECT_PREFIX" usage:"prefix of NATS subjects"`
+	NATSJetStream     bool     `yaml:"nats_jetstream" env:"NATS_JETSTREAM" usage:"publish through JetStream"`
+	KafkaBrokers      []string `yaml:"kafka_brokers" env:"KAFKA_BROKERS" usage:"comma-separated Kafka brokers"`
+	KafkaTopic        string   `yaml:"kafka_topic" env:"KAFKA_TOPIC" usage:"Kafka topic"`
+}
+
+type Jobs struct {
+	ReactivationInterval time.Duration `yaml:"reactivation_interval" env:"REACTIVATION_INTERVAL" usage:"how often expired suspensions are lifted"`
+	WebhookInterval      time.Duration `yaml:"webhook_interval" env:"WEBHOOK_INTERVAL" usage:"how often webhook deliveries are sent"`
+	BrokerInterval       time.Duration `yaml:"broker_interval" env:"BROKER_INTERVAL" usage:"how often new events are published"`
+}
+
+type Tracing struct {
+	Exporter     string  `yaml:"exporter" env:"TRACING_EXPORTER" usage:"otlp or stdout to export traces, empty for none"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" env:"OTLP_ENDPOINT" usage:"OTLP gRPC collector host:port, empty for OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317"`
+	OTLPInsecure bool    `yaml:"otlp_insecure" env:"OTLP_INSECURE" usage:"connect to the collector without TLS"`
+	ServiceName  string  `yaml:"service_name" env:"OTEL_SERVICE_NAME" usage:"service name spans are reported under"`
+	SampleRatio  float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" usage:"share of new traces sampled, from 0 to 1"`
+}
+
+type Log struct {
+	Level     string   `yaml:"level" env:"LOG_LEVEL" usage:"debug, info, warn or error; debug logs every query"`
+	Format    string   `yaml:"format" env:"LOG_FORMAT" usage:"json or text"`
+	Redact    string   `yaml:"redact" env:"LOG_REDACT" usage:"mask, hash or off, how personal data is redacted from logs"`
+	PIIFields []string `yaml:"pii_fields" env:"LOG_PII_FIELDS" usage:"comma-separated log attributes holding personal data"`
+}
+
+type RateLimit struct {
+	Store    string   `yaml:"store" env:"RATE_LIMIT_STORE" usage:"memory or redis to rate limit requests, empty for none"`
+	RedisURL string   `yaml:"redis_url" env:"REDIS_URL" secret:"true" usage:"Redis server used with the redis store, e.g. redis://localhost:6379/0"`
+	Key      []string `yaml:"key" env:"RATE_LIMIT_KEY" usage:"comma-separated client identities, tried in order: api_key, user or ip"`
+	APIKeys  []string `yaml:"api_keys" env:"RATE_LIMIT_API_KEYS" usage:"comma-separated SHA-256 hex digests of the API keys clients are told apart by"`
+	Default  string   `yaml:"default" env:"RATE_LIMIT_DEFAULT" usage:"requests allowed per client on routes without their own limit, e.g. 600/m, empty for none"`
+	Routes   []string `yaml:"routes" env:"RATE_LIMIT_ROUTES" usage:"comma-separated per-route limits, e.g. POST /api/users/=30/m"`
+}
+
+// Rate is a number of requests allowed per period.
+type Rate struct {
+	Count  int
+	Period time.Duration
+}
+
+// Rates returns the default limit, zero for none, and the per-route limits
+// by "METHOD /route". Validate has checked them.
+func (r RateLimit) Rates() (Rate, map[string]Rate) {
+	fallback, _ := parseRate(r.Default)
+
+	routes := make(map[string]Rate, len(r.Routes))
+	for _, entry := range r.Routes {
+		if route, rate, err := parseRouteRate(entry); err == nil {
+			routes[route] = rate
+		}
+	}
+
+	return fallback, routes
+}
+
+// parseRate parses a limit like "30/m", "5/10s" or "1000/h"; "" is none.
+func parseRate(s string) (Rate, error) {
+	if s == "" {
+		return Rate{}, nil
+	}
+
+	count, per, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("%q must look like 30/m, requests per period", s)
+	}
+	per = strings.TrimSpace(per)
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per
+	}
+	period, err := time.ParseDuration(per)
+	if err != nil || period <= 0 {
+		return Rate{}, fmt.Errorf("%q must end with a period, e.g. s, m, h or 10s", s)
+	}
+
+	return Rate{Count: n, Period: period}, nil
+}
+
+// parseRouteRate splits an entry like "POST /api/users/=30/m".
+func parseRouteRate(entry string) (string, Rate, error) {
+	route, value, err := parseRouteEntry(entry, "limit")
+	if err != nil {
+		return "", Rate{}, err
+	}
+
+	rate, err := parseRate(value)
+	if err == nil && rate.Count == 0 {
+		err = fmt.Errorf("%q must end with a limit, e.g. 30/m", entry)
+	}
+	return route, rate, err
+}
+
+type CORS struct {
+	AllowOrigins     []string      `yaml:"allow_origins" env:"CORS_ALLOW_ORIGINS" usage:"comma-separated origins browsers may call the API from, e.g. https://app.example.com or https://*.example.com; * is any, empty is none"`
+	AllowMethods     []string      `yaml:"allow_methods" env:"CORS_ALLOW_METHODS" usage:"comma-separated methods cross-origin requests may use"`
+	AllowHeaders     []string      `yaml:"allow_headers" env:"CORS_ALLOW_HEADERS" usage:"comma-separated headers cross-origin requests may send"`
+	ExposeHeaders    []string      `yaml:"expose_headers" env:"CORS_EXPOSE_HEADERS" usage:"comma-separated response headers cross-origin callers may read"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" usage:"let cross-origin requests send cookies; not with * origins"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE" usage:"how long browsers may cache a preflight answer"`
+	Groups           []string      `yaml:"groups" env:"CORS_GROUPS" usage:"comma-separated per-route-group overrides, e.g. /api/audit=origins:https://admin.example.com|https://*.example.com;credentials:true"`
+}
+
+// CORSPolicy is which browser origins may call some routes, and how.
+type CORSPolicy struct {
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// Policy returns the policy of routes outside every group.
+func (c CORS) Policy() CORSPolicy {
+	return CORSPolicy{
+		AllowOrigins:     c.AllowOrigins,
+		AllowMethods:     c.AllowMethods,
+		AllowHeaders:     c.AllowHeaders,
+		ExposeHeaders:    c.ExposeHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+// GroupPolicies returns the policies of route groups by path prefix, e.g.
+// /api/audit, each the default policy with the group's overrides. Validate
+// has checked them.
+func (c CORS) GroupPolicies() map[string]CORSPolicy {
+	groups := make(map[string]CORSPolicy, len(c.Groups))
+	for _, entry := range c.Groups {
+		if group, policy, err := parseCORSGroup(entry, c.Policy()); err == nil {
+			groups[group] = policy
+		}
+	}
+
+	return groups
+}
+
+// parseCORSGroup applies an entry like
+// "/api/audit=origins:https://admin.example.com;credentials:true" to policy.
+// Lists are separated by |, as entries are by commas.
+func parseCORSGroup(entry string, policy CORSPolicy) (string, CORSPolicy, error) {
+	group, overrides, ok := strings.Cut(entry, "=")
+	group = strings.TrimSpace(group)
+	if !ok || !strings.HasPrefix(group, "/") {
+		return "", policy, fmt.Errorf("%q must look like /group=origins:https://app.example.com;credentials:true", entry)
+	}
+
+	for _, override := range strings.Split(overrides, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(override), ":")
+		value = strings.TrimSpace(value)
+		var list []string
+		for _, item := range strings.Split(value, "|") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+
+		var err error
+		switch name = strings.TrimSpace(name); {
+		case !ok:
+			err = fmt.Errorf("%q must look like name:value", override)
+		case name == "origins":
+			policy.AllowOrigins = list
+		case name == "methods":
+			policy.AllowMethods = list
+		case name == "headers":
+			policy.AllowHeaders = list
+		case name == "expose":
+			policy.ExposeHeaders = list
+		case name == "credentials":
+			policy.AllowCredentials, err = strconv.ParseBool(value)
+		case name == "max_age":
+			policy.MaxAge, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("%q must be origins, methods, headers, expose, credentials or max_age", name)
+		}
+		if err != nil {
+			return "", policy, fmt.Errorf("%s: %v", group, err)
+		}
+	}
+
+	if err := policy.validate(); err != nil {
+		return "", policy, fmt.Errorf("%s: %v", group, err)
+	}
+
+	return group, policy, nil
+}
+
+// validate rejects bad origins, and credentials with any origin, which
+// browsers refuse and would otherwise let every site call the API as its
+// visitors.
+func (p CORSPolicy) validate() error {
+	for _, origin := range p.AllowOrigins {
+		if err := checkOrigin(origin); err != nil {
+			return err
+		}
+	}
+	if p.AllowCredentials && slices.Contains(p.AllowOrigins, "*") {
+		return errors.New("* origins can't be allowed with credentials")
+	}
+	if p.MaxAge < 0 {
+		return errors.New("max_age must not be negative")
+	}
+
+	return nil
+}
+
+// checkOrigin accepts *, origins like https://app.example.com and wildcard
+// subdomains like https://*.example.com.
+func checkOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+
+	scheme, host, ok := strings.Cut(origin, "://")
+	host = strings.TrimPrefix(host, "*.")
+	if !ok || (scheme != "http" && scheme != "https") || host == "" || strings.ContainsAny(host, "*/?#") {
+		return fmt.Errorf("%q must look like https://app.example.com or https://*.example.com", origin)
+	}
+
+	return nil
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            8080,
+			GRPCPort:        9090,
+			AdminPort:       9100,
+			ShutdownTimeout: 20 * time.Second,
+			RequestTimeout:  30 * time.Second,
+			MaxBodyBytes:    1 << 20,
+		},
+		Database: Database{
+			Driver:         "postgres",
+			SqlitePath:     "users.db",
+			MaxIdleConns:   20,
+			MaxOpenConns:   100,
+			ConnectRetries: 10,
+			ConnectBackoff: 3 * time.Second,
+			SlowQuery:      200 * time.Millisecond,
+		},
+		Avatars: Avatars{
+			Storage:  "disk",
+			DiskPath: "data/avatars",
+			MaxBytes: 5 << 20,
+			S3Region: "us-east-1",
+		},
+		Events: Events{
+			NATSURL:           "nats://localhost:4222",
+			NATSSubjectPrefix: "users",
+			KafkaBrokers:      []string{"localhost:9092"},
+			KafkaTopic:        "users",
+		},
+		Jobs: Jobs{
+			ReactivationInterval: time.Minute,
+			WebhookInterval:      5 * time.Second,
+			BrokerInterval:       time.Second,
+		},
+		Tracing: Tracing{
+			ServiceName: "users-api",
+			SampleRatio: 1,
+		},
+		Log: Log{
+			Level:     "info",
+			Format:    "json",
+			Redact:    "mask",
+			PIIFields: []string{"email", "fullname"},
+		},
+		RateLimit: RateLimit{
+			Store:  "memory",
+			Key:    []string{"ip"},
+			Routes: []string{"POST /api/users/=60/m"},
+		},
+		CORS: CORS{
+			AllowOrigins: []string{},
+			AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+			AllowHeaders: []string{
+				"Origin", "Content-Length", "Content-Type",
+				"Authorization", "X-Organization", "X-Request-ID",
+			},
+			ExposeHeaders: []string{
+				"X-Request-ID", "Retry-After",
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+			},
+			MaxAge: 12 * time.Hour,
+		},
+	}
+}
+
+// Load builds the config from the defaults, the file named by -config or
+// CONFIG_FILE, the environment (including a .env file) and the flags in
+// args, then validates it. It returns the arguments left after the flags.
+func Load(args []string) (*Config, []string, error) {
 	// load .env
 	err := godotenv.Load()
 	if err != nil {
-		log.Printf("Could not load .env file %s\n", err.Error())
+		slog.Info("Could not load .env file", "error", err)
+	}
+
+	cfg := Default()
+
+	// flags are applied last, but -config is needed first
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config `file`")
+	var flagged []setting
+	for _, s := range cfg.settings() {
+		fs.Var(&flagValue{setting: s, flagged: &flagged}, s.key, s.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *file != "" {
+		if err := cfg.loadFile(*file); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// a variable set to nothing still overrides, to clear a setting
+	for _, s := range cfg.settings() {
+		if v, ok := os.LookupEnv(s.env); s.env != "" && ok {
+			if err := s.set(v); err != nil {
+				return nil, nil, fmt.Errorf("config: %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range flagged {
+		if err := s.set(s.raw); err != nil {
+			return nil, nil, fmt.Errorf("config: -%s: %w", s.key, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// loadFile applies a YAML or TOML file, chosen by its extension.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	var doc map[string]any
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("config: %s must be a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	settings := map[string]setting{}
+	for _, s := range c.settings() {
+		settings[s.key] = s
+	}
+
+	// unknown keys are errors, so a typo doesn't silently keep a default
+	values := map[string]any{}
+	for section, fields := range doc {
+		m, ok := fields.(map[string]any)
+		if !ok {
+			return fmt.Errorf("config: %s: %s must be a table of settings", path, section)
+		}
+		for name, value := range m {
+			values[section+"."+name] = value
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s, ok := settings[key]
+		if !ok {
+			return fmt.Errorf("config: %s: unknown setting %s", path, key)
+		}
+		if err := s.set(fileValue(values[key])); err != nil {
+			return fmt.Errorf("config: %s: %s: %w", path, key, err)
+		}
+	}
+
+	return nil
+}
+
+// fileValue spells a decoded file value the way it would be written in an
+// environment variable.
+func fileValue(v any) string {
+	list, ok := v.([]any)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// Validate reports every setting that is out of range or missing.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("config: "+format, args...))
+		}
+	}
+
+	check(validPort(c.Server.Port), "server.port must be between 1 and 65535")
+	check(validPort(c.Server.GRPCPort), "server.grpc_port must be between 1 and 65535")
+	check(validPort(c.Server.AdminPort), "server.admin_port must be between 1 and 65535")
+	check(c.Server.Port != c.Server.GRPCPort && c.Server.Port != c.Server.AdminPort && c.Server.GRPCPort != c.Server.AdminPort,
+		"server.port, server.grpc_port and server.admin_port must differ")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+	check(c.Server.RequestTimeout >= 0, "server.request_timeout must not be negative")
+	check(c.Server.MaxBodyBytes > 0, "server.max_body_bytes must be positive")
+	for _, entry := range c.Server.RouteTimeouts {
+		_, _, err := parseRouteTimeout(entry)
+		check(err == nil, "server.route_timeouts: %v", err)
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		check(err == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies: %q is not an IP or CIDR", proxy)
+	}
+
+	switch c.Database.Driver {
+	case "postgres":
+		check(c.Database.PostgresDSN != "", "database.postgres_dsn is required with the postgres driver")
+	case "mysql":
+		check(c.Database.MysqlDSN != "", "database.mysql_dsn is required with the mysql driver")
+	case "sqlite":
+		check(c.Database.SqlitePath != "", "database.sqlite_path is required with the sqlite driver")
+	default:
+		check(false, "database.driver must be postgres, mysql or sqlite, got %q", c.Database.Driver)
+	}
+	check(c.Database.MaxOpenConns > 0, "database.max_open_conns must be positive")
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns, "database.max_idle_conns must be between 0 and database.max_open_conns")
+	check(c.Database.ConnectRetries >= 0, "database.connect_retries must not be negative")
+	check(c.Database.ConnectBackoff > 0, "database.connect_backoff must be positive")
+	check(c.Database.SlowQuery > 0, "database.slow_query must be positive")
+
+	switch c.Avatars.Storage {
+	case "disk":
+		check(c.Avatars.DiskPath != "", "avatars.disk_path is required with disk storage")
+	case "s3":
+		check(c.Avatars.S3Endpoint != "" && c.Avatars.S3Bucket != "", "avatars.s3_endpoint and avatars.s3_bucket are required with s3 storage")
+	default:
+		check(false, "avatars.storage must be disk or s3, got %q", c.Avatars.Storage)
+	}
+	check(c.Avatars.MaxBytes > 0, "avatars.max_bytes must be positive")
+
+	switch c.Events.Broker {
+	case "":
+	case "nats":
+		check(c.Events.NATSURL != "", "events.nats_url is required with the nats broker")
+	case "kafka":
+		check(len(c.Events.KafkaBrokers) > 0 && c.Events.KafkaTopic != "", "events.kafka_brokers and events.kafka_topic are required with the kafka broker")
+	default:
+		check(false, "events.broker must be nats, kafka or empty, got %q", c.Events.Broker)
+	}
+
+	check(c.Jobs.ReactivationInterval > 0, "jobs.reactivation_interval must be positive")
+	check(c.Jobs.WebhookInterval > 0, "jobs.webhook_interval must be positive")
+	check(c.Jobs.BrokerInterval > 0, "jobs.broker_interval must be positive")
+
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		check(false, "tracing.exporter must be otlp, stdout or empty, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text, got %q", c.Log.Format)
+	switch c.Log.Redact {
+	case "mask", "hash", "off":
+	default:
+		check(false, "log.redact must be mask, hash or off, got %q", c.Log.Redact)
+	}
+
+	switch c.RateLimit.Store {
+	case "":
+	case "memory":
+	case "redis":
+		check(c.RateLimit.RedisURL != "", "rate_limit.redis_url is required with the redis store")
+	default:
+		check(false, "rate_limit.store must be memory, redis or empty, got %q", c.RateLimit.Store)
+	}
+	check(c.RateLimit.Store == "" || len(c.RateLimit.Key) > 0, "rate_limit.key is required to rate limit")
+	for _, key := range c.RateLimit.Key {
+		check(key == "api_key" || key == "user" || key == "ip", "rate_limit.key must list api_key, user or ip, got %q", key)
+	}
+	check(!slices.Contains(c.RateLimit.Key, "user") || c.Tenant.TokenSecret != "",
+		"rate_limit.key user needs tenant.token_secret to verify users")
+	for _, digest := range c.RateLimit.APIKeys {
+		_, err := hex.DecodeString(digest)
+		check(err == nil && len(digest) == sha256.Size*2, "rate_limit.api_keys: %q is not a SHA-256 hex digest", digest)
+	}
+	_, err := parseRate(c.RateLimit.Default)
+	check(err == nil, "rate_limit.default: %v", err)
+	for _, entry := range c.RateLimit.Routes {
+		_, _, err := parseRouteRate(entry)
+		check(err == nil, "rate_limit.routes: %v", err)
+	}
+
+	for _, origin := range c.CORS.AllowOrigins {
+		err := checkOrigin(origin)
+		check(err == nil, "cors.allow_origins: %v", err)
+	}
+	check(!c.CORS.AllowCredentials || !slices.Contains(c.CORS.AllowOrigins, "*"),
+		"cors.allow_origins can't include * with cors.allow_credentials, list the origins instead")
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+	for _, entry := range c.CORS.Groups {
+		_, _, err := parseCORSGroup(entry, c.CORS.Policy())
+		check(err == nil, "cors.groups: %v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// Redacted returns a copy with every set secret replaced, safe to print.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	for _, s := range redacted.settings() {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString("[redacted]")
+		}
+	}
+
+	return &redacted
+}
+
+// LogValue logs the config as a group per section, with secrets redacted.
+func (c *Config) LogValue() slog.Value {
+	var sections []slog.Attr
+	var fields []any
+	section := ""
+	for _, s := range c.Redacted().settings() {
+		name, field, _ := strings.Cut(s.key, ".")
+		if name != section && section != "" {
+			sections = append(sections, slog.Group(section, fields...))
+			fields = nil
+		}
+		section = name
+		fields = append(fields, slog.String(field, (&flagValue{setting: s}).String()))
+	}
+	sections = append(sections, slog.Group(section, fields...))
+
+	return slog.GroupValue(sections...)
+}
+
+// String is the config as YAML, with secrets redacted.
+func (c *Config) String() string {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err.Error()
 	}
 
-	// init db
-	db.InitDB()
+	return string(data)
 }
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  port: 8000
+database:
+  driver: sqlite
+  max_open_conns: 50
+  connect_backoff: 1s
+events:
+  kafka_brokers: [a:9092, b:9092]
+`)
+	tomlFile := writeFile(t, "config.toml", `
+[server]
+port = 8000
+
+[database]
+driver = "sqlite"
+max_open_conns = 50
+connect_backoff = "1s"
+
+[events]
+kafka_brokers = ["a:9092", "b:9092"]
+`)
+	typoFile := writeFile(t, "typo.yaml", "database:\n  max_open_con: 5\n")
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		check   func(t *testing.T, cfg *Config)
+		rest    []string
+		wantErr string
+	}{
+		{
+			name: "Defaults",
+			env:  map[string]string{"POSTGRES_DSN": "host=db"},
+			check: func(t *testing.T, cfg *Config) {
+				want := Default()
+				want.Database.PostgresDSN = "host=db"
+				assert.Equal(t, want, cfg)
+			},
+		},
+		{
+			name: "YAML file",
+			args: []string{"-config", yamlFile},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 8000, cfg.Server.Port)
+				assert.Equal(t, 50, cfg.Database.MaxOpenConns)
+				assert.Equal(t, time.Second, cfg.Database.ConnectBackoff)
+				assert.Equal(t, []string{"a:9092", "b:9092"}, cfg.Events.KafkaBrokers)
+				assert.Equal(t, 20, cfg.Database.MaxIdleConns)
+			},
+		},
+		{
+			name: "TOML file from CONFIG_FILE",
+			env:  map[string]string{"CONFIG_FILE": tomlFile},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 8000, cfg.Server.Port)
+				assert.Equal(t, 50, cfg.Database.MaxOpenConns)
+				assert.Equal(t, time.Second, cfg.Database.ConnectBackoff)
+				assert.Equal(t, []string{"a:9092", "b:9092"}, cfg.Events.KafkaBrokers)
+			},
+		},
+		{
+			name: "Environment overrides the file and flags override both",
+			args: []string{"-config", yamlFile, "-database.max_open_conns", "70", "-events.nats_jetstream", "seed", "-count", "5"},
+			env:  map[string]string{"PORT": "8001", "DB_MAX_OPEN_CONNS": "60", "KAFKA_BROKERS": "c:9092"},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 8001, cfg.Server.Port)
+				assert.Equal(t, 70, cfg.Database.MaxOpenConns)
+				assert.Equal(t, []string{"c:9092"}, cfg.Events.KafkaBrokers)
+				assert.True(t, cfg.Events.NATSJetStream)
+			},
+			rest: []string{"seed", "-count", "5"},
+		},
+		{
+			name: "Empty environment values clear settings",
+			args: []string{"-config", yamlFile},
+			env:  map[string]string{"RATE_LIMIT_STORE": "", "REQUEST_TIMEOUT": "", "KAFKA_BROKERS": ""},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "", cfg.RateLimit.Store)
+				assert.Equal(t, time.Duration(0), cfg.Server.RequestTimeout)
+				assert.Nil(t, cfg.Events.KafkaBrokers)
+			},
+		},
+		{
+			name:    "Unknown file setting",
+			args:    []string{"-config", typoFile},
+			wantErr: "config: " + typoFile + ": unknown setting database.max_open_con",
+		},
+		{
+			name:    "Bad environment value",
+			env:     map[string]string{"DB_DRIVER": "sqlite", "DB_CONNECT_BACKOFF": "3"},
+			wantErr: `config: DB_CONNECT_BACKOFF: "3" is not a duration, e.g. 3s or 1m30s`,
+		},
+		{
+			name: "Tracing",
+			env:  map[string]string{"DB_DRIVER": "sqlite", "TRACING_EXPORTER": "stdout", "TRACING_SAMPLE_RATIO": "0.25"},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "stdout", cfg.Tracing.Exporter)
+				assert.Equal(t, 0.25, cfg.Tracing.SampleRatio)
+			},
+		},
+		{
+			name:    "Bad sample ratio",
+			env:     map[string]string{"DB_DRIVER": "sqlite", "TRACING_SAMPLE_RATIO": "2"},
+			wantErr: "config: tracing.sample_ratio must be between 0 and 1",
+		},
+		{
+			name: "Route timeouts",
+			env: map[string]string{
+				"DB_DRIVER":       "sqlite",
+				"REQUEST_TIMEOUT": "10s",
+				"ROUTE_TIMEOUTS":  "put /api/users/:userID/avatar=1m, GET /api/users/=0s",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 10*time.Second, cfg.Server.RequestTimeout)
+				assert.Equal(t, map[string]time.Duration{
+					"PUT /api/users/:userID/avatar": time.Minute,
+					"GET /api/users/":               0,
+				}, cfg.Server.Timeouts())
+			},
+		},
+		{
+			name: "Bad route timeout",
+			env:  map[string]string{"DB_DRIVER": "sqlite", "ROUTE_TIMEOUTS": "/api/users/=1m,GET /api/users/=soon"},
+			wantErr: "config: server.route_timeouts: \"/api/users/=1m\" must look like METHOD /route=timeout\n" +
+				"config: server.route_timeouts: \"GET /api/users/=soon\" must end with a duration, e.g. 1m",
+		},
+		{
+			name: "Rate limits",
+			env: map[string]string{
+				"DB_DRIVER":           "sqlite",
+				"TRUSTED_PROXIES":     "10.0.0.0/8, 192.168.1.1",
+				"RATE_LIMIT_STORE":    "redis",
+				"REDIS_URL":           "redis://localhost:6379/0",
+				"RATE_LIMIT_KEY":      "api_key,ip",
+				"RATE_LIMIT_API_KEYS": "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+				"RATE_LIMIT_DEFAULT":  "600/m",
+				"RATE_LIMIT_ROUTES":   "post /api/users/=5/10s, PUT /api/users/:userID=1000/h",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.1"}, cfg.Server.TrustedProxies)
+				assert.Equal(t, []string{"api_key", "ip"}, cfg.RateLimit.Key)
+				fallback, routes := cfg.RateLimit.Rates()
+				assert.Equal(t, Rate{Count: 600, Period: time.Minute}, fallback)
+				assert.Equal(t, map[string]Rate{
+					"POST /api/users/":       {Count: 5, Period: 10 * time.Second},
+					"PUT /api/users/:userID": {Count: 1000, Period: time.Hour},
+				}, routes)
+			},
+		},
+		{
+			name: "Bad rate limits",
+			env: map[string]string{
+				"DB_DRIVER":           "sqlite",
+				"TRUSTED_PROXIES":     "proxy.local",
+				"RATE_LIMIT_STORE":    "redis",
+				"RATE_LIMIT_KEY":      "cookie,user",
+				"RATE_LIMIT_API_KEYS": "secret",
+				"RATE_LIMIT_DEFAULT":  "lots",
+				"RATE_LIMIT_ROUTES":   "POST /api/users/=30/fortnight",
+			},
+			wantErr: "config: server.trusted_proxies: \"proxy.local\" is not an IP or CIDR\n" +
+				"config: rate_limit.redis_url is required with the redis store\n" +
+				"config: rate_limit.key must list api_key, user or ip, got \"cookie\"\n" +
+				"config: rate_limit.key user needs tenant.token_secret to verify users\n" +
+				"config: rate_limit.api_keys: \"secret\" is not a SHA-256 hex digest\n" +
+				"config: rate_limit.default: \"lots\" must look like 30/m, requests per period\n" +
+				"config: rate_limit.routes: \"30/fortnight\" must end with a period, e.g. s, m, h or 10s",
+		},
+		{
+			name: "CORS",
+			env: map[string]string{
+				"DB_DRIVER":              "sqlite",
+				"CORS_ALLOW_ORIGINS":     "https://app.example.com,https://*.example.com",
+				"CORS_ALLOW_CREDENTIALS": "true",
+				"CORS_GROUPS":            "/api/audit=origins:https://admin.example.com|https://*.ops.example.com;credentials:false, /api/webhooks/=methods:GET|POST;max_age:1m",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				policy := cfg.CORS.Policy()
+				assert.Equal(t, []string{"https://app.example.com", "https://*.example.com"}, policy.AllowOrigins)
+				assert.True(t, policy.AllowCredentials)
+				assert.Equal(t, 12*time.Hour, policy.MaxAge)
+
+				groups := cfg.CORS.GroupPolicies()
+				audit, webhooks := policy, policy
+				audit.AllowOrigins = []string{"https://admin.example.com", "https://*.ops.example.com"}
+				audit.AllowCredentials = false
+				webhooks.AllowMethods = []string{"GET", "POST"}
+				webhooks.MaxAge = time.Minute
+				assert.Equal(t, map[string]CORSPolicy{"/api/audit": audit, "/api/webhooks/": webhooks}, groups)
+			},
+		},
+		{
+			name: "Bad CORS",
+			env: map[string]string{
+				"DB_DRIVER":              "sqlite",
+				"CORS_ALLOW_ORIGINS":     "*,app.example.com,https://*.example.*",
+				"CORS_ALLOW_CREDENTIALS": "true",
+				"CORS_GROUPS":            "api/audit=origins:*,/api/webhooks=origins:*;credentials:true,/api/users=age:1m",
+			},
+			wantErr: "config: cors.allow_origins: \"app.example.com\" must look like https://app.example.com or https://*.example.com\n" +
+				"config: cors.allow_origins: \"https://*.example.*\" must look like https://app.example.com or https://*.example.com\n" +
+				"config: cors.allow_origins can't include * with cors.allow_credentials, list the origins instead\n" +
+				"config: cors.groups: \"api/audit=origins:*\" must look like /group=origins:https://app.example.com;credentials:true\n" +
+				"config: cors.groups: /api/webhooks: * origins can't be allowed with credentials\n" +
+				"config: cors.groups: /api/users: \"age\" must be origins, methods, headers, expose, credentials or max_age",
+		},
+		{
+			name:    "Bad redaction policy",
+			env:     map[string]string{"DB_DRIVER": "sqlite", "LOG_REDACT": "blur"},
+			wantErr: `config: log.redact must be mask, hash or off, got "blur"`,
+		},
+		{
+			name:    "Bad flag value",
+			args:    []string{"-database.driver", "sqlite", "-server.port", "http"},
+			wantErr: `config: -server.port: "http" is not an integer`,
+		},
+		{
+			name: "Every invalid setting is reported",
+			args: []string{"-server.grpc_port", "8080", "-database.max_idle_conns", "200", "-avatars.storage", "s3"},
+			wantErr: "config: server.port, server.grpc_port and server.admin_port must differ\n" +
+				"config: database.postgres_dsn is required with the postgres driver\n" +
+				"config: database.max_idle_conns must be between 0 and database.max_open_conns\n" +
+				"config: avatars.s3_endpoint and avatars.s3_bucket are required with s3 storage",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, rest, err := Load(test.args)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			if test.rest == nil {
+				assert.Empty(t, rest)
+			} else {
+				assert.Equal(t, test.rest, rest)
+			}
+			test.check(t, cfg)
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.PostgresDSN = "host=db password=hunter2"
+	cfg.Tenant.TokenSecret = "s3cret"
+
+	redacted := cfg.Redacted()
+	assert.Equal(t, "[redacted]", redacted.Database.PostgresDSN)
+	assert.Equal(t, "[redacted]", redacted.Tenant.TokenSecret)
+	assert.Equal(t, "", redacted.Avatars.S3SecretKey)
+	assert.Equal(t, "host=db password=hunter2", cfg.Database.PostgresDSN)
+
+	assert.NotContains(t, cfg.String(), "hunter2")
+	assert.Contains(t, cfg.String(), "connect_backoff: 3s")
+}
+
+func TestLogValue(t *testing.T) {
+	cfg := Default()
+	cfg.Tenant.TokenSecret = "s3cret"
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("Effective config", "config", cfg)
+
+	assert.Contains(t, buf.String(), "config.database.connect_backoff=3s")
+	assert.Contains(t, buf.String(), "config.events.kafka_brokers=localhost:9092")
+	assert.Contains(t, buf.String(), "config.tenant.token_secret=[redacted]")
+	assert.NotContains(t, buf.String(), "s3cret")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unable to write %s %s", name, err.Error())
+	}
+
+	return path
+}
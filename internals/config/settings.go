@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is one field of a Config section, found through its tags.
+type setting struct {
+	key    string // section.name, e.g. database.max_open_conns
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+	// raw is the value given on the command line
+	raw string
+}
+
+func (c *Config) settings() []setting {
+	var settings []setting
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		prefix := sections.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			settings = append(settings, setting{
+				key:    prefix + "." + field.Tag.Get("yaml"),
+				env:    field.Tag.Get("env"),
+				usage:  field.Tag.Get("usage"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+
+	return settings
+}
+
+// set parses v into the setting. Lists are comma-separated, and an empty
+// value clears any setting, e.g. RATE_LIMIT_STORE= turns rate limiting off.
+func (s setting) set(v string) error {
+	if v == "" {
+		s.value.Set(reflect.Zero(s.value.Type()))
+		return nil
+	}
+
+	switch p := s.value.Addr().Interface().(type) {
+	case *string:
+		*p = v
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", v)
+		}
+		*p = b
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		*p = n
+	case *int64:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		*p = n
+	case *float64:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*p = f
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration, e.g. 3s or 1m30s", v)
+		}
+		*p = d
+	case *[]string:
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*p = list
+	default:
+		panic(fmt.Sprintf("config: %s has unsupported type %s", s.key, s.value.Type()))
+	}
+
+	return nil
+}
+
+// flagValue records a flag so Load can apply it after the file and
+// environment.
+type flagValue struct {
+	setting
+	flagged *[]setting
+}
+
+// String shows the default in -h.
+func (f *flagValue) String() string {
+	if f == nil || !f.value.IsValid() {
+		return ""
+	}
+	if list, ok := f.value.Interface().([]string); ok {
+		return strings.Join(list, ",")
+	}
+
+	return fmt.Sprint(f.value.Interface())
+}
+
+func (f *flagValue) Set(v string) error {
+	s := f.setting
+	s.raw = v
+	*f.flagged = append(*f.flagged, s)
+
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given as just -name.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.value.Kind() == reflect.Bool
+}
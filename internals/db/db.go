@@ -1,107 +1,206 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/logging"
+	"github.com/obimadu/ipc3-stage-2/internals/metrics"
 	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"github.com/obimadu/ipc3-stage-2/internals/tracing"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var counts int
 var DB *gorm.DB
 
-func InitDB() {
+// InitDB connects to the database and migrates the models, for the API.
+func InitDB(cfg config.Database) {
+	Open(cfg)
+
+	// migrate models
+	err := migrate()
+	if err != nil {
+		slog.Error("Unable to migrate models", "error", err)
+		panic(err)
+	}
+	slog.Info("Successfully Migrated Models.")
+}
+
+// Open connects to the database without migrating it, for tools that must
+// not change the schema of a database the API owns.
+func Open(cfg config.Database) {
 	// new db
-	db := connectToPostgres()
+	db := connect(cfg)
+
+	// statements are logged at debug level, slow ones as warnings
+	db.Logger = logging.NewGormLogger(cfg.SlowQuery)
+
+	// scope tenant-owned models to the request's organization
+	err := db.Use(tenant.Plugin{})
+	if err != nil {
+		slog.Error("Unable to register tenant plugin", "error", err)
+		panic(err)
+	}
+
+	// time every statement
+	err = db.Use(metrics.Plugin{})
+	if err != nil {
+		slog.Error("Unable to register metrics plugin", "error", err)
+		panic(err)
+	}
 
-	if gin.Mode() == gin.ReleaseMode {
-		db.Logger.LogMode(0)
+	// trace every statement under the request's span
+	err = db.Use(tracing.Plugin{})
+	if err != nil {
+		slog.Error("Unable to register tracing plugin", "error", err)
+		panic(err)
 	}
 
 	DB = db
 
 	rawDB := RawDB()
 
-	rawDB.SetMaxIdleConns(20)
-	rawDB.SetMaxOpenConns(100)
+	rawDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	rawDB.SetMaxOpenConns(cfg.MaxOpenConns)
+}
 
-	// migrate models
-	err := migrate()
-	if err != nil {
-		log.Panicf("Unable to migrate models %s\n", err.Error())
-	}
-	log.Println("Successfully Migrated Models.")
+// tables are migrated in order.
+var tables = []any{
+	&models.Organizations{},
+	&models.Users{},
+	&models.UserStatusTransitions{},
+	&models.AttributeDefinitions{},
+	&models.UserPreferences{},
+	&models.UserChanges{},
+	&models.AuditEntries{},
+	&models.AuditChains{},
+	&models.Events{},
+	&models.EventCursors{},
+	&models.Webhooks{},
+	&models.WebhookDeliveries{},
 }
 
 func migrate() error {
-	err := DB.AutoMigrate(&models.Users{})
+	// migrations touch every tenant
+	db := DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	err := db.AutoMigrate(tables...)
+	if err != nil {
+		return err
+	}
+
+	// users created before organizations existed belong to the default one
+	org := models.Organizations{Name: "Default", Slug: models.DefaultOrganizationSlug}
+	err = db.Where(models.Organizations{Slug: org.Slug}).FirstOrCreate(&org).Error
 	if err != nil {
 		return err
 	}
 
+	return db.Model(&models.Users{}).
+		Where("organization_id IS NULL OR organization_id = 0").
+		Update("organization_id", org.ID).Error
+}
+
+// CheckSchema reports the first table or column of the models missing from
+// the database, i.e. whether migrations are current.
+func CheckSchema(ctx context.Context) error {
+	db := DB.WithContext(tenant.WithoutScope(ctx))
+	migrator := db.Migrator()
+
+	for _, table := range tables {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(table); err != nil {
+			return err
+		}
+		if !migrator.HasTable(table) {
+			return fmt.Errorf("table %s is missing", stmt.Schema.Table)
+		}
+
+		columns, err := migrator.ColumnTypes(table)
+		if err != nil {
+			return err
+		}
+		have := make(map[string]bool, len(columns))
+		for _, column := range columns {
+			have[column.Name()] = true
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !have[field.DBName] {
+				return fmt.Errorf("column %s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+
 	return nil
 }
 
 func RawDB() *sql.DB {
 	rawDB, err := DB.DB()
 	if err != nil {
-		log.Panicf("Unable to get raw sql.DB %s\n", err.Error())
+		slog.Error("Unable to get raw sql.DB", "error", err)
+		panic(err)
 	}
 
 	return rawDB
 }
 
-func connectToPostgres() *gorm.DB {
-	dsn := os.Getenv("POSTGRES_DSN")
+// connect opens the database named by cfg.Driver, which Validate has
+// checked.
+func connect(cfg config.Database) *gorm.DB {
+	switch cfg.Driver {
+	case "mysql":
+		return connectWithRetry(cfg, "MySQL", func() (*gorm.DB, error) {
+			return openMysql(cfg.MysqlDSN)
+		})
+	case "sqlite":
+		return connectToSqlite(cfg.SqlitePath)
+	default:
+		return connectWithRetry(cfg, "Postgres", func() (*gorm.DB, error) {
+			return openPostgres(cfg.PostgresDSN)
+		})
+	}
+}
 
-	for {
-		connection, err := openPostgres(dsn)
-		if err != nil {
-			log.Println("Postgres not yet ready ...")
-			counts++
-		} else {
-			log.Println("Connected to Postgres")
+// connectWithRetry waits for a database server that may still be starting,
+// e.g. alongside the API in Docker Compose.
+func connectWithRetry(cfg config.Database, name string, open func() (*gorm.DB, error)) *gorm.DB {
+	for attempt := 0; ; attempt++ {
+		connection, err := open()
+		if err == nil {
+			slog.Info("Connected to " + name)
 			return connection
 		}
+		slog.Warn(name+" not yet ready ...", "error", err)
 
-		if counts > 10 {
-			log.Fatal(err)
+		if attempt >= cfg.ConnectRetries {
+			slog.Error("Unable to connect to "+name, "error", err)
+			os.Exit(1)
 		}
 
-		log.Println("Backing off for three seconds....")
-		time.Sleep(3 * time.Second)
-		continue
+		slog.Info("Backing off ....", "backoff", cfg.ConnectBackoff.String())
+		time.Sleep(cfg.ConnectBackoff)
 	}
 }
 
-func connectToMysql() *gorm.DB {
-	dsn := os.Getenv("MYSQL_DSN")
-
-	for {
-		connection, err := openMysql(dsn)
-		if err != nil {
-			log.Println("MySQL not yet ready ...")
-			counts++
-		} else {
-			log.Println("Connected to MySQL")
-			return connection
-		}
-
-		if counts > 10 {
-			log.Fatal(err)
-		}
-
-		log.Println("Backing off for three seconds....")
-		time.Sleep(3 * time.Second)
-		continue
+func connectToSqlite(path string) *gorm.DB {
+	connection, err := openSqlite(path)
+	if err != nil {
+		slog.Error("Unable to open SQLite", "error", err)
+		os.Exit(1)
 	}
+	slog.Info("Connected to SQLite")
+
+	return connection
 }
 
 func openPostgres(dsn string) (*gorm.DB, error) {
@@ -145,3 +244,11 @@ func openMysql(dsn string) (*gorm.DB, error) {
 
 	return db, nil
 }
+
+func openSqlite(path string) (*gorm.DB, error) {
+	// SQLite allows one writer at a time; others wait for the lock
+	// instead of failing
+	dsn := path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+
+	return gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+}
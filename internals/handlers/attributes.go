@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"gorm.io/gorm"
+)
+
+// attributeQueryPrefix marks GET /users query parameters that filter on a
+// custom attribute, e.g. ?attr.department=eng.
+const attributeQueryPrefix = "attr."
+
+func CreateAttributeDefinition(c *gin.Context, db *gorm.DB) {
+	var def models.AttributeDefinitions
+
+	err := c.ShouldBindBodyWithJSON(&def)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Request body not valid.",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	def.ID = 0
+	err = def.Validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Attribute definition not valid.",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	err = models.CreateAttributeDefinition(db, &def)
+	if err != nil {
+		if models.IsUniqueViolation(err) {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "Attribute has already been defined!",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Attribute operation failed",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Attribute defined successfully.",
+		Data: gin.H{
+			"attribute": def,
+		},
+	})
+}
+
+func GetAttributeDefinitions(c *gin.Context, db *gorm.DB) {
+	defs, err := models.GetAttributeDefinitions(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve attributes.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Retrieved all attributes.",
+		Data: gin.H{
+			"attributes": defs,
+		},
+	})
+}
+
+func DeleteAttributeDefinition(c *gin.Context, db *gorm.DB) {
+	err := models.DeleteAttributeDefinition(db, c.Param("name"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "Attribute does not exist.",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Attribute operation failed",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Attribute deleted successfully.",
+	})
+}
+
+// validateAttributes checks attrs against the organization's definitions and
+// writes the error response if they do not match. It reports whether the
+// request may continue.
+func validateAttributes(c *gin.Context, db *gorm.DB, attrs models.Attributes) bool {
+	if err := attributesError(db, attrs); err != nil {
+		err.respond(c)
+		return false
+	}
+
+	return true
+}
+
+// attributesError validates attrs against the organization's definitions.
+func attributesError(db *gorm.DB, attrs models.Attributes) *requestError {
+	defs, err := models.GetAttributeDefinitions(db)
+	if err != nil {
+		return &requestError{Status: http.StatusInternalServerError, Message: "Failed to retrieve attributes.", Err: err}
+	}
+
+	err = models.ValidateAttributes(defs, attrs)
+	if err != nil {
+		return &requestError{Status: http.StatusBadRequest, Message: "Attributes not valid.", Err: err}
+	}
+
+	return nil
+}
+
+// attributeFilters parses the attr.* query parameters into typed filter
+// values and writes the error response if they do not match the
+// organization's definitions. It reports whether the request may continue.
+func attributeFilters(c *gin.Context, db *gorm.DB) (map[string]any, bool) {
+	raw := map[string]string{}
+	for key, values := range c.Request.URL.Query() {
+		if name, ok := strings.CutPrefix(key, attributeQueryPrefix); ok && len(values) > 0 {
+			raw[name] = values[0]
+		}
+	}
+
+	filters, err := parseAttributeFilters(db, raw)
+	if err != nil {
+		err.respond(c)
+		return nil, false
+	}
+
+	return filters, true
+}
+
+// parseAttributeFilters types raw attribute filter values by their
+// definitions.
+func parseAttributeFilters(db *gorm.DB, raw map[string]string) (map[string]any, *requestError) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	defs, err := models.GetAttributeDefinitions(db)
+	if err != nil {
+		return nil, &requestError{Status: http.StatusInternalServerError, Message: "Failed to retrieve attributes.", Err: err}
+	}
+
+	filters, err := models.ParseAttributeFilters(defs, raw)
+	if err != nil {
+		return nil, &requestError{Status: http.StatusBadRequest, Message: "Attribute filter not valid.", Err: err}
+	}
+
+	return filters, nil
+}
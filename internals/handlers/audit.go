@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/audit"
+	"gorm.io/gorm"
+)
+
+// defaultAuditLimit and maxAuditLimit bound GET /audit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func GetAuditEntries(c *gin.Context, db *gorm.DB) {
+	filter := audit.Filter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Limit:  defaultAuditLimit,
+	}
+
+	for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: param + " must be an RFC 3339 timestamp.",
+			})
+			return
+		}
+		*t = parsed
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "limit must be a number from 1 to " + strconv.Itoa(maxAuditLimit) + ".",
+			})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := audit.Find(db, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve audit log.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Retrieved audit log.",
+		Data: gin.H{
+			"entries": entries,
+		},
+	})
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/avatars"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/storage"
+	"gorm.io/gorm"
+)
+
+// avatarCacheControl lets clients and shared caches reuse an avatar for an
+// hour before revalidating it against its ETag.
+const avatarCacheControl = "public, max-age=3600"
+
+func UploadAvatar(c *gin.Context, db *gorm.DB, blobs storage.Blobs, maxBytes int64) {
+	user, ok := pathUser(c, db)
+	if !ok {
+		return
+	}
+
+	data, err := readAvatar(c, maxBytes)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, jsonResponse{
+				Status:  "error",
+				Message: fmt.Sprintf("Avatar must not be larger than %d bytes.", maxBytes),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Request body not valid.",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	thumbs, hash, err := avatars.Thumbnails(data)
+	if errors.Is(err, avatars.ErrTooManyPixels) {
+		c.JSON(http.StatusRequestEntityTooLarge, jsonResponse{
+			Status:  "error",
+			Message: "Avatar must not have more than 16 megapixels.",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, jsonResponse{
+			Status:  "error",
+			Message: "Avatar must be a PNG, JPEG or WebP image.",
+		})
+		return
+	}
+
+	for size, thumb := range thumbs {
+		err = blobs.Put(c.Request.Context(), avatarKey(user, hash, size), thumb, avatars.ContentType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, jsonResponse{
+				Status:  "error",
+				Message: "Failed to store avatar.",
+				Error: gin.H{
+					"error": err.Error(),
+				},
+			})
+			return
+		}
+	}
+
+	err = models.SetUserAvatar(db, user.ID, hash)
+	if err != nil {
+		checkRecordExists(c, err)
+		return
+	}
+
+	// the previous upload is unreachable now
+	if user.AvatarHash != "" && user.AvatarHash != hash {
+		deleteAvatarBlobs(c, blobs, user)
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Avatar uploaded successfully.",
+	})
+}
+
+func GetAvatar(c *gin.Context, db *gorm.DB, blobs storage.Blobs) {
+	size := avatars.DefaultSize
+	if s := c.Query("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || !avatars.ValidSize(n) {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: fmt.Sprintf("Size must be one of %v.", avatars.Sizes),
+			})
+			return
+		}
+		size = n
+	}
+
+	user, ok := pathUser(c, db)
+	if !ok {
+		return
+	}
+
+	var etag string
+	if user.AvatarHash != "" {
+		etag = fmt.Sprintf(`"%s-%d"`, user.AvatarHash, size)
+	} else {
+		etag = fmt.Sprintf(`"identicon-%d"`, size)
+	}
+
+	c.Header("Cache-Control", avatarCacheControl)
+	c.Header("Vary", "Authorization, X-Organization")
+	c.Header("ETag", etag)
+	if strings.Contains(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if user.AvatarHash == "" {
+		data, err := avatars.Identicon(fmt.Sprintf("%d/%s", user.OrganizationID, user.Username), size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, jsonResponse{
+				Status:  "error",
+				Message: "Failed to generate avatar.",
+				Error: gin.H{
+					"error": err.Error(),
+				},
+			})
+			return
+		}
+		c.Data(http.StatusOK, avatars.ContentType, data)
+		return
+	}
+
+	data, contentType, err := blobs.Get(c.Request.Context(), avatarKey(user, user.AvatarHash, size))
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve avatar.",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, data)
+}
+
+func DeleteAvatar(c *gin.Context, db *gorm.DB, blobs storage.Blobs) {
+	user, ok := pathUser(c, db)
+	if !ok {
+		return
+	}
+
+	err := models.SetUserAvatar(db, user.ID, "")
+	if err != nil {
+		checkRecordExists(c, err)
+		return
+	}
+	deleteAvatarBlobs(c, blobs, user)
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Avatar deleted successfully.",
+	})
+}
+
+// readAvatar reads the upload from the "avatar" field of a multipart form, or
+// from the raw request body otherwise, refusing uploads over maxBytes.
+func readAvatar(c *gin.Context, maxBytes int64) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		return io.ReadAll(c.Request.Body)
+	}
+
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		return nil, err
+	}
+	if header.Size > maxBytes {
+		return nil, &http.MaxBytesError{Limit: maxBytes}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+func deleteAvatarBlobs(c *gin.Context, blobs storage.Blobs, user *models.Users) {
+	for _, size := range avatars.Sizes {
+		// leftovers are harmless, so a failed delete does not fail the request
+		_ = blobs.Delete(c.Request.Context(), avatarKey(user, user.AvatarHash, size))
+	}
+}
+
+func avatarKey(user *models.Users, hash string, size int) string {
+	return fmt.Sprintf("avatars/%d/%d/%s/%d.png", user.OrganizationID, user.ID, hash, size)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"gorm.io/gorm"
+)
+
+// Stream tuning, variables so tests can speed them up.
+var (
+	// eventPollInterval is how often the event log is checked for new events.
+	eventPollInterval = time.Second
+	// eventKeepAlive is how long a quiet stream waits before sending a
+	// comment to keep proxies from closing it.
+	eventKeepAlive = 15 * time.Second
+)
+
+// eventBatchSize bounds the events read from the log per poll.
+const eventBatchSize = 100
+
+// StreamUserEvents streams user events of the caller's organization as
+// Server-Sent Events. Each event's SSE id is its ID in the event log, so a
+// reconnecting client's Last-Event-ID resumes right after the last event it
+// saw; without one the stream starts with the next new event. Events
+// committed out of ID order are still sent, after newer ones, while the
+// stream stays connected. ?types= limits the stream to a comma-separated
+// list of event types.
+func StreamUserEvents(c *gin.Context, db *gorm.DB) {
+	var types []string
+	if v := c.Query("types"); v != "" {
+		types = strings.Split(v, ",")
+		for _, t := range types {
+			if !slices.Contains(models.EventTypes, t) {
+				c.JSON(http.StatusBadRequest, jsonResponse{
+					Status:  "error",
+					Message: "Unknown event type " + t + ".",
+				})
+				return
+			}
+		}
+	}
+
+	var lastID uint
+	if v := c.GetHeader("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "Last-Event-ID must be a positive interger.",
+			})
+			return
+		}
+		lastID = uint(id)
+	} else {
+		id, err := models.GetLastEventID(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, jsonResponse{
+				Status:  "error",
+				Message: "Failed to retrieve events.",
+				Error: gin.H{
+					"error": err.Error(),
+				}})
+			return
+		}
+		lastID = id
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// stop nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Flush()
+
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+
+	// the cursor also covers other organizations' and types' events, so
+	// only IDs that really were skipped are looked for again
+	cursor := &models.EventCursors{LastEventID: lastID}
+	unscoped := db.WithContext(tenant.WithoutScope(c.Request.Context()))
+
+	for {
+		ids, err := models.GetPendingEventIDs(unscoped, cursor, eventBatchSize)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Unable to read events for stream", "error", err)
+			return
+		}
+
+		query := db
+		if len(types) > 0 {
+			query = query.Where("type IN ?", types)
+		}
+		events, err := models.GetEventsByID(query, ids)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Unable to read events for stream", "error", err)
+			return
+		}
+		cursor.Advance(ids, time.Now())
+
+		for _, event := range events {
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatUint(uint64(event.ID), 10),
+				Event: event.Type,
+				Data:  event,
+			})
+		}
+		if len(events) > 0 {
+			c.Writer.Flush()
+			lastWrite = time.Now()
+		}
+		// more may be waiting
+		if len(ids) == eventBatchSize {
+			continue
+		}
+		if len(events) == 0 && time.Since(lastWrite) >= eventKeepAlive {
+			c.Writer.WriteString(": keep-alive\n\n")
+			c.Writer.Flush()
+			lastWrite = time.Now()
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-poll.C:
+		}
+	}
+}
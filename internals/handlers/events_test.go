@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamUserEvents(t *testing.T) {
+	eventPollInterval = time.Millisecond
+
+	tests := []struct {
+		name        string
+		url         string
+		lastEventID string
+		expect      func(mock sqlmock.Sqlmock)
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:        "Resume after Last-Event-ID",
+			url:         "/events",
+			lastEventID: "4",
+			expect: func(mock sqlmock.Sqlmock) {
+				// the first poll returns two events, the next one fails and
+				// ends the stream
+				mock.ExpectQuery(`SELECT "id" FROM "events" WHERE id > \$1 ORDER BY id LIMIT \$2`).WithArgs(4, eventBatchSize).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+				mock.ExpectQuery(`SELECT \* FROM "events" WHERE id IN \(\$1,\$2\) ORDER BY id`).WithArgs(5, 6).
+					WillReturnRows(eventRows(5, 6))
+			},
+			wantCode: http.StatusOK,
+			wantBody: eventBody(5) + eventBody(6),
+		},
+		{
+			name:        "Send events committed out of order",
+			url:         "/events",
+			lastEventID: "4",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT "id" FROM "events" WHERE id > \$1 ORDER BY id LIMIT \$2`).WithArgs(4, eventBatchSize).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(7))
+				mock.ExpectQuery(`SELECT \* FROM "events" WHERE id IN \(\$1,\$2\) ORDER BY id`).WithArgs(5, 7).
+					WillReturnRows(eventRows(5, 7))
+				// 6 was skipped, so it's looked for again
+				mock.ExpectQuery(`SELECT "id" FROM "events" WHERE id > \$1 OR id IN \(\$2\) ORDER BY id LIMIT \$3`).WithArgs(7, 6, eventBatchSize).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(6))
+				mock.ExpectQuery(`SELECT \* FROM "events" WHERE id IN \(\$1\) ORDER BY id`).WithArgs(6).
+					WillReturnRows(eventRows(6))
+			},
+			wantCode: http.StatusOK,
+			wantBody: eventBody(5) + eventBody(7) + eventBody(6),
+		},
+		{
+			name:        "Skip other types",
+			url:         "/events?types=user.deleted",
+			lastEventID: "4",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT "id" FROM "events" WHERE id > \$1 ORDER BY id LIMIT \$2`).WithArgs(4, eventBatchSize).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+				mock.ExpectQuery(`SELECT \* FROM "events" WHERE type IN \(\$1\) AND id IN \(\$2,\$3\) ORDER BY id`).WithArgs("user.deleted", 5, 6).
+					WillReturnRows(eventRows(6))
+				// nothing was skipped
+				mock.ExpectQuery(`SELECT "id" FROM "events" WHERE id > \$1 ORDER BY id LIMIT \$2`).WithArgs(6, eventBatchSize).
+					WillReturnError(sql.ErrConnDone)
+			},
+			wantCode: http.StatusOK,
+			wantBody: eventBody(6),
+		},
+		{
+			name:     "Reject unknown event type",
+			url:      "/events?types=user.created,user.renamed",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","message":"Unknown event type user.renamed.","data":null}`,
+		},
+		{
+			name:        "Reject malformed Last-Event-ID",
+			url:         "/events",
+			lastEventID: "five",
+			wantCode:    http.StatusBadRequest,
+			wantBody:    `{"status":"error","message":"Last-Event-ID must be a positive interger.","data":null}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock := InitDB(t)
+			rawDB, err := db.DB()
+			if err != nil {
+				t.Fatalf("Unable to get sql.DB from gorm.DB, %v", err)
+			}
+			defer rawDB.Close()
+
+			if test.expect != nil {
+				test.expect(mock)
+			}
+
+			gin.SetMode(gin.ReleaseMode)
+			r := gin.New()
+			r.GET("/events", func(c *gin.Context) {
+				StreamUserEvents(c, db)
+			})
+
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request %v", err)
+			}
+			if test.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", test.lastEventID)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, test.wantCode, w.Code)
+			assert.Equal(t, test.wantBody, w.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// testEvent returns the type and data of the test event with the given ID:
+// odd ones are creations, even ones deletions.
+func testEvent(id int) (string, string) {
+	if id%2 == 0 {
+		return "user.deleted", `{"user":null}`
+	}
+	return "user.created", `{"user":{"id":1}}`
+}
+
+func eventRows(ids ...int) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "type", "user_id", "data", "created_at"})
+	for _, id := range ids {
+		typ, data := testEvent(id)
+		rows.AddRow(id, typ, 1, data, time.Date(2024, 6, 1, 12, id, 0, 0, time.UTC))
+	}
+	return rows
+}
+
+func eventBody(id int) string {
+	typ, data := testEvent(id)
+	return fmt.Sprintf("id:%d\nevent:%s\ndata:{\"id\":%d,\"type\":%q,\"user_id\":1,\"data\":%s,\"created_at\":\"2024-06-01T12:%02d:00Z\"}\n\n", id, typ, id, typ, data, id)
+}
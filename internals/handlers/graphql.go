@@ -0,0 +1,560 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"gorm.io/gorm"
+)
+
+// graphqlMaxPage is the largest page the users query returns.
+const graphqlMaxPage = 100
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphqlContext is the request state resolvers share.
+type graphqlContext struct {
+	c             *gin.Context
+	db            *gorm.DB
+	statusHistory *batchLoader[uint, []models.UserStatusTransitions]
+}
+
+type graphqlContextKey struct{}
+
+func requestGraphQLContext(p graphql.ResolveParams) *graphqlContext {
+	return p.Context.Value(graphqlContextKey{}).(*graphqlContext)
+}
+
+// GraphQL runs a GraphQL request against the user schema. Queries may be
+// sent with GET or POST, mutations only with POST. Responses follow the
+// GraphQL spec rather than the REST envelope; resolver errors carry the
+// status the REST API would have answered with in their extensions.
+func GraphQL(c *gin.Context, db *gorm.DB) {
+	var req graphqlRequest
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if v := c.Query("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				graphqlError(c, http.StatusBadRequest, "Variables not valid.")
+				return
+			}
+		}
+	} else if err := c.ShouldBindBodyWithJSON(&req); err != nil {
+		graphqlError(c, http.StatusBadRequest, "Request body not valid.")
+		return
+	}
+
+	if req.Query == "" {
+		graphqlError(c, http.StatusBadRequest, "You must specify a query.")
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	validation := graphql.ValidateDocument(&userSchema, doc, nil)
+	if !validation.IsValid {
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: validation.Errors})
+		return
+	}
+
+	operation := graphqlOperation(doc, req.OperationName)
+	if operation == nil {
+		graphqlError(c, http.StatusBadRequest, "Operation not found.")
+		return
+	}
+	if operation.Operation == ast.OperationTypeMutation && c.Request.Method != http.MethodPost {
+		graphqlError(c, http.StatusMethodNotAllowed, "Mutations must be sent with POST.")
+		return
+	}
+
+	if err := checkComplexity(doc, operation, req.Variables); err != nil {
+		graphqlError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), graphqlContextKey{}, &graphqlContext{
+		c:  c,
+		db: db,
+		statusHistory: newBatchLoader(func(ids []uint) (map[uint][]models.UserStatusTransitions, error) {
+			return models.GetStatusTransitionsByUserIDs(db, ids)
+		}),
+	})
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        userSchema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+
+	c.JSON(http.StatusOK, result)
+}
+
+func graphqlError(c *gin.Context, status int, message string) {
+	c.JSON(status, graphql.Result{Errors: gqlerrors.FormatErrors(gqlerrors.NewFormattedError(message))})
+}
+
+// graphqlOperation returns the operation named name, or the only operation
+// when name is empty.
+func graphqlOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op
+		}
+	}
+
+	return found
+}
+
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Any JSON value.",
+	Serialize: func(value any) any {
+		return value
+	},
+	ParseValue: func(value any) any {
+		return value
+	},
+	ParseLiteral: jsonLiteral,
+})
+
+// jsonLiteral converts an inline GraphQL value to what encoding/json would
+// decode it to, so attributes validate the same as in REST requests.
+func jsonLiteral(value ast.Value) any {
+	switch value := value.(type) {
+	case *ast.StringValue:
+		return value.Value
+	case *ast.EnumValue:
+		return value.Value
+	case *ast.BooleanValue:
+		return value.Value
+	case *ast.IntValue:
+		n, _ := strconv.ParseFloat(value.Value, 64)
+		return n
+	case *ast.FloatValue:
+		n, _ := strconv.ParseFloat(value.Value, 64)
+		return n
+	case *ast.ListValue:
+		list := make([]any, 0, len(value.Values))
+		for _, item := range value.Values {
+			list = append(list, jsonLiteral(item))
+		}
+		return list
+	case *ast.ObjectValue:
+		object := make(map[string]any, len(value.Fields))
+		for _, field := range value.Fields {
+			object[field.Name.Value] = jsonLiteral(field.Value)
+		}
+		return object
+	}
+
+	return nil
+}
+
+// userField resolves a User field from the *models.Users source.
+func userField(get func(user *models.Users) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(*models.Users)), nil
+	}
+}
+
+func transitionField(get func(transition models.UserStatusTransitions) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(models.UserStatusTransitions)), nil
+	}
+}
+
+// optional turns empty strings into null, as omitempty does in REST
+// responses.
+func optional(s string) any {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
+
+var statusTransitionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "StatusTransition",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: transitionField(func(t models.UserStatusTransitions) any {
+				return strconv.FormatUint(uint64(t.ID), 10)
+			}),
+		},
+		"fromStatus": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: transitionField(func(t models.UserStatusTransitions) any { return t.FromStatus }),
+		},
+		"toStatus": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: transitionField(func(t models.UserStatusTransitions) any { return t.ToStatus }),
+		},
+		"reason": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: transitionField(func(t models.UserStatusTransitions) any { return optional(t.Reason) }),
+		},
+		"actor": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: transitionField(func(t models.UserStatusTransitions) any { return t.Actor }),
+		},
+		"createdAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: transitionField(func(t models.UserStatusTransitions) any { return t.CreatedAt }),
+		},
+	},
+})
+
+// userType mirrors models.Users.
+var userType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: userField(func(u *models.Users) any {
+				return strconv.FormatUint(uint64(u.ID), 10)
+			}),
+		},
+		"username": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: userField(func(u *models.Users) any { return u.Username }),
+		},
+		"email": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: userField(func(u *models.Users) any { return u.Email }),
+		},
+		"fullname": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: userField(func(u *models.Users) any { return optional(u.Fullname) }),
+		},
+		"status": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: userField(func(u *models.Users) any { return u.Status }),
+		},
+		"suspendedUntil": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: userField(func(u *models.Users) any { return u.SuspendedUntil }),
+		},
+		"attributes": &graphql.Field{
+			Type:    jsonScalar,
+			Resolve: userField(func(u *models.Users) any { return u.Attributes }),
+		},
+		"statusHistory": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(statusTransitionType))),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				user := p.Source.(*models.Users)
+				return requestGraphQLContext(p).statusHistory.load(user.ID), nil
+			},
+		},
+	},
+})
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"endCursor":   &graphql.Field{Type: graphql.String},
+	},
+})
+
+var userConnectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserConnection",
+	Fields: graphql.Fields{
+		"nodes":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType)))},
+		"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+	},
+})
+
+var attributeFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "AttributeFilter",
+	Description: "Matches users whose custom attribute equals value, typed by the attribute's definition.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"value": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var createUserInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateUserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"username":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"email":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"fullname":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"attributes": &graphql.InputObjectFieldConfig{Type: jsonScalar},
+	},
+})
+
+var updateUserInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "UpdateUserInput",
+	Description: "Fields left out are not changed; attributes replace the whole set.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"username":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"email":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"fullname":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"attributes": &graphql.InputObjectFieldConfig{Type: jsonScalar},
+	},
+})
+
+var userSchema = mustUserSchema()
+
+func mustUserSchema() graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"user": &graphql.Field{
+					Type:    userType,
+					Args:    graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+					Resolve: resolveUser,
+				},
+				"userByUsername": &graphql.Field{
+					Type:    userType,
+					Args:    graphql.FieldConfigArgument{"username": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+					Resolve: resolveUserByUsername,
+				},
+				"users": &graphql.Field{
+					Type: graphql.NewNonNull(userConnectionType),
+					Args: graphql.FieldConfigArgument{
+						"first":      &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 20},
+						"after":      &graphql.ArgumentConfig{Type: graphql.String},
+						"status":     &graphql.ArgumentConfig{Type: graphql.String},
+						"attributes": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(attributeFilterInput))},
+					},
+					Resolve: resolveUsers,
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Mutation",
+			Fields: graphql.Fields{
+				"createUser": &graphql.Field{
+					Type:    graphql.NewNonNull(userType),
+					Args:    graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createUserInput)}},
+					Resolve: resolveCreateUser,
+				},
+				"updateUser": &graphql.Field{
+					Type: graphql.NewNonNull(userType),
+					Args: graphql.FieldConfigArgument{
+						"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+						"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateUserInput)},
+					},
+					Resolve: resolveUpdateUser,
+				},
+				"deleteUser": &graphql.Field{
+					Type:    graphql.NewNonNull(graphql.ID),
+					Args:    graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+					Resolve: resolveDeleteUser,
+				},
+			},
+		}),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return schema
+}
+
+func graphqlUserID(p graphql.ResolveParams) (uint, error) {
+	id, err := strconv.ParseUint(p.Args["id"].(string), 10, 32)
+	if err != nil {
+		return 0, &requestError{Status: http.StatusBadRequest, Message: "UserID must be a positive interger."}
+	}
+
+	return uint(id), nil
+}
+
+// userInput reads a CreateUserInput or UpdateUserInput.
+func userInput(p graphql.ResolveParams) models.Users {
+	input := p.Args["input"].(map[string]any)
+
+	var user models.Users
+	user.Username, _ = input["username"].(string)
+	user.Email, _ = input["email"].(string)
+	user.Fullname, _ = input["fullname"].(string)
+	if attrs, ok := input["attributes"].(map[string]any); ok {
+		user.Attributes = attrs
+	}
+
+	return user
+}
+
+func resolveUser(p graphql.ResolveParams) (any, error) {
+	id, err := graphqlUserID(p)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := models.GetUserByID(requestGraphQLContext(p).db, id)
+	if err != nil {
+		return nil, recordExistsError(err)
+	}
+
+	return user, nil
+}
+
+func resolveUserByUsername(p graphql.ResolveParams) (any, error) {
+	user, err := models.GetUserByUsername(requestGraphQLContext(p).db, p.Args["username"].(string))
+	if err != nil {
+		return nil, recordExistsError(err)
+	}
+
+	return user, nil
+}
+
+// resolveUsers pages through users in ID order. Cursors are opaque to
+// clients.
+func resolveUsers(p graphql.ResolveParams) (any, error) {
+	db := requestGraphQLContext(p).db
+
+	first := p.Args["first"].(int)
+	if first < 1 || first > graphqlMaxPage {
+		return nil, &requestError{Status: http.StatusBadRequest, Message: "first must be between 1 and " + strconv.Itoa(graphqlMaxPage) + "."}
+	}
+	filter := models.UserFilter{Limit: first + 1}
+
+	if after, ok := p.Args["after"].(string); ok {
+		id, err := models.DecodeUserCursor(after)
+		if err != nil {
+			return nil, &requestError{Status: http.StatusBadRequest, Message: "Cursor not valid."}
+		}
+		filter.AfterID = id
+	}
+
+	if status, ok := p.Args["status"].(string); ok {
+		if !models.ValidStatus(status) {
+			return nil, &requestError{Status: http.StatusBadRequest, Message: "Status filter not valid."}
+		}
+		filter.Status = status
+	}
+
+	if list, ok := p.Args["attributes"].([]any); ok {
+		raw := make(map[string]string, len(list))
+		for _, item := range list {
+			f := item.(map[string]any)
+			raw[f["name"].(string)] = f["value"].(string)
+		}
+		attributes, err := parseAttributeFilters(db, raw)
+		if err != nil {
+			return nil, err
+		}
+		filter.Attributes = attributes
+	}
+
+	users, err := models.GetAll(db, filter)
+	if err != nil {
+		return nil, &requestError{Status: http.StatusInternalServerError, Message: "Failed to retrieve users.", Err: err}
+	}
+
+	hasNextPage := len(users) > first
+	if hasNextPage {
+		users = users[:first]
+	}
+
+	nodes := make([]*models.Users, len(users))
+	var endCursor any
+	for i := range users {
+		nodes[i] = &users[i]
+		endCursor = models.EncodeUserCursor(users[i].ID)
+	}
+
+	return map[string]any{
+		"nodes": nodes,
+		"pageInfo": map[string]any{
+			"hasNextPage": hasNextPage,
+			"endCursor":   endCursor,
+		},
+	}, nil
+}
+
+func resolveCreateUser(p graphql.ResolveParams) (any, error) {
+	db := requestGraphQLContext(p).db
+	user := userInput(p)
+
+	if user.Username == "" || user.Email == "" {
+		return nil, &requestError{Status: http.StatusBadRequest, Message: "You must specify both a username and an email."}
+	}
+
+	if err := attributesError(db, user.Attributes); err != nil {
+		return nil, err
+	}
+
+	if err := models.CreateUser(db, &user); err != nil {
+		return nil, uniqueError(err)
+	}
+
+	return &user, nil
+}
+
+func resolveUpdateUser(p graphql.ResolveParams) (any, error) {
+	db := requestGraphQLContext(p).db
+	id, err := graphqlUserID(p)
+	if err != nil {
+		return nil, err
+	}
+	user := userInput(p)
+
+	// attributes sent on update replace the whole set
+	if user.Attributes != nil {
+		if err := attributesError(db, user.Attributes); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := models.UpdateUserByID(db, id, user); err != nil {
+		return nil, userWriteError(err)
+	}
+
+	updated, err := models.GetUserByID(db, id)
+	if err != nil {
+		return nil, recordExistsError(err)
+	}
+
+	return updated, nil
+}
+
+func resolveDeleteUser(p graphql.ResolveParams) (any, error) {
+	gql := requestGraphQLContext(p)
+	id, err := graphqlUserID(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.DeleteUserByID(gql.db, id); err != nil {
+		return nil, recordExistsError(err)
+	}
+
+	return p.Args["id"], nil
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits on a GraphQL operation, checked before it runs.
+const (
+	// graphqlMaxComplexity bounds the estimated number of fields an
+	// operation resolves.
+	graphqlMaxComplexity = 5000
+	// graphqlMaxDepth bounds how deeply selections nest.
+	graphqlMaxDepth = 10
+	// graphqlListEstimate is the assumed length of lists that have no
+	// first argument, e.g. a user's status history.
+	graphqlListEstimate = 10
+)
+
+// checkComplexity estimates the cost of op and rejects it if it is over
+// the limits. Every field costs one, and the selections under a field are
+// counted once per item it may return: its first argument, clamped to
+// [1, graphqlMaxPage], or graphqlListEstimate for other lists. Introspection
+// is free.
+func checkComplexity(doc *ast.Document, op *ast.OperationDefinition, variables map[string]any) error {
+	w := &complexityWalker{
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+	}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			w.fragments[frag.Name.Value] = frag
+		}
+	}
+
+	root := userSchema.QueryType()
+	if op.Operation == ast.OperationTypeMutation {
+		root = userSchema.MutationType()
+	}
+
+	cost, err := w.selectionSet(op.SelectionSet, root, 1)
+	if err != nil {
+		return err
+	}
+	if cost > graphqlMaxComplexity {
+		return fmt.Errorf("Query complexity %d exceeds the maximum of %d.", cost, graphqlMaxComplexity)
+	}
+
+	return nil
+}
+
+type complexityWalker struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+func (w *complexityWalker) selectionSet(set *ast.SelectionSet, parent *graphql.Object, depth int) (int, error) {
+	if set == nil {
+		return 0, nil
+	}
+	if depth > graphqlMaxDepth {
+		return 0, fmt.Errorf("Query depth exceeds the maximum of %d.", graphqlMaxDepth)
+	}
+
+	total := 0
+	for _, selection := range set.Selections {
+		var cost int
+		var err error
+		switch selection := selection.(type) {
+		case *ast.Field:
+			cost, err = w.field(selection, parent, depth)
+		case *ast.InlineFragment:
+			cost, err = w.selectionSet(selection.SelectionSet, parent, depth)
+		case *ast.FragmentSpread:
+			if frag := w.fragments[selection.Name.Value]; frag != nil {
+				cost, err = w.selectionSet(frag.SelectionSet, parent, depth)
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += cost
+	}
+
+	return total, nil
+}
+
+func (w *complexityWalker) field(field *ast.Field, parent *graphql.Object, depth int) (int, error) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, nil
+	}
+	def := parent.Fields()[field.Name.Value]
+	if def == nil || field.SelectionSet == nil {
+		return 1, nil
+	}
+
+	child, isList := unwrapObject(def.Type)
+	if child == nil {
+		return 1, nil
+	}
+	children, err := w.selectionSet(field.SelectionSet, child, depth+1)
+	if err != nil {
+		return 0, err
+	}
+
+	items := 1
+	if first, ok := w.first(field, def); ok {
+		// out of range values fail when resolved, but must not make the
+		// cost negative or overflow it first
+		items = min(max(first, 1), graphqlMaxPage)
+	} else if isList && !strings.HasSuffix(parent.Name(), "Connection") {
+		// a connection's nodes were already counted by its first argument
+		items = graphqlListEstimate
+	}
+
+	return 1 + items*children, nil
+}
+
+// first returns the value of the field's first argument, falling back to
+// its default.
+func (w *complexityWalker) first(field *ast.Field, def *graphql.FieldDefinition) (int, bool) {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			n, err := strconv.Atoi(value.Value)
+			return n, err == nil
+		case *ast.Variable:
+			switch n := w.variables[value.Name.Value].(type) {
+			case float64:
+				return int(n), true
+			case int:
+				return n, true
+			}
+		}
+	}
+
+	for _, arg := range def.Args {
+		if arg.Name() == "first" {
+			n, ok := arg.DefaultValue.(int)
+			return n, ok
+		}
+	}
+
+	return 0, false
+}
+
+// unwrapObject returns the object type inside t's non-null and list
+// wrappers, and whether t is a list.
+func unwrapObject(t graphql.Type) (*graphql.Object, bool) {
+	isList := false
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		case *graphql.List:
+			isList = true
+			t = wrapped.OfType
+		case *graphql.Object:
+			return wrapped, isList
+		default:
+			return nil, isList
+		}
+	}
+}
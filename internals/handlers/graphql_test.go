@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		mockSQL  func(mock sqlmock.Sqlmock)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:  "List users with batched status history",
+			query: `{ users(first: 2) { nodes { id username statusHistory { toStatus } } pageInfo { hasNextPage endCursor } } }`,
+			mockSQL: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "users" ORDER BY id LIMIT \$1`).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "status"}).
+						AddRow(1, "obi", "obi@example.com", "active").
+						AddRow(2, "ada", "ada@example.com", "suspended").
+						AddRow(3, "tolu", "tolu@example.com", "active"))
+				// one query for the status history of every user on the page
+				mock.ExpectQuery(`SELECT \* FROM "user_status_transitions" WHERE user_id IN \(\$1,\$2\) ORDER BY id`).WithArgs(1, 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "from_status", "to_status", "actor", "created_at"}).
+						AddRow(1, 2, "active", "suspended", "admin", time.Now()))
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":{"users":{"nodes":[` +
+				`{"id":"1","username":"obi","statusHistory":[]},` +
+				`{"id":"2","username":"ada","statusHistory":[{"toStatus":"suspended"}]}` +
+				`],"pageInfo":{"endCursor":"dXNlcjoy","hasNextPage":true}}}}`,
+		},
+		{
+			name:     "Create user shares REST validation",
+			query:    `mutation { createUser(input: {username: "", email: "obi@example.com"}) { id } }`,
+			wantCode: http.StatusOK,
+			wantBody: `{"data":null,"errors":[{"message":"You must specify both a username and an email.","locations":[{"line":1,"column":12}],"path":["createUser"],"extensions":{"status":400}}]}`,
+		},
+		{
+			name:     "Reject unknown field",
+			query:    `{ users { nodes { password } } }`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"data":null,"errors":[{"message":"Cannot query field \"password\" on type \"User\".","locations":[{"line":1,"column":19}]}]}`,
+		},
+		{
+			name:     "Reject complex query",
+			query:    `{ users(first: 100) { nodes { statusHistory { id actor fromStatus toStatus reason createdAt } } } }`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"data":null,"errors":[{"message":"Query complexity 6201 exceeds the maximum of 5000.","locations":[]}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock := InitDB(t)
+			rawDB, err := db.DB()
+			if err != nil {
+				t.Fatalf("Unable to get sql.DB from gorm.DB, %v", err)
+			}
+			defer rawDB.Close()
+
+			if test.mockSQL != nil {
+				test.mockSQL(mock)
+			}
+
+			gin.SetMode(gin.ReleaseMode)
+			r := gin.New()
+			r.POST("/graphql", func(c *gin.Context) {
+				GraphQL(c, db)
+			})
+
+			body, _ := json.Marshal(map[string]any{"query": test.query})
+			req, err := http.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to create request %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, test.wantCode, w.Code)
+			assert.JSONEq(t, test.wantBody, w.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCheckComplexity(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		vars    map[string]any
+		wantErr string
+	}{
+		{name: "Single user", query: `{ user(id: 1) { id username statusHistory { toStatus } } }`},
+		{name: "Default page", query: `{ users { nodes { id statusHistory { toStatus actor } } } }`},
+		{name: "Introspection is free", query: `{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name ofType { name } } } } } } } } }`},
+		{
+			name:    "Page size from variables",
+			query:   `query ($n: Int) { users(first: $n) { nodes { statusHistory { id actor fromStatus toStatus reason createdAt } } } }`,
+			vars:    map[string]any{"n": 100.0},
+			wantErr: "Query complexity 6201 exceeds the maximum of 5000.",
+		},
+		{
+			name:    "Fragments are counted",
+			query:   `{ users(first: 100) { nodes { ...history } } } fragment history on User { statusHistory { id actor fromStatus toStatus reason createdAt } }`,
+			wantErr: "Query complexity 6201 exceeds the maximum of 5000.",
+		},
+		{
+			name:    "Negative page sizes don't offset others",
+			query:   `{ a: users(first: -1000000) { nodes { ...history } } b: users(first: 100) { nodes { ...history } } } fragment history on User { statusHistory { id actor fromStatus toStatus reason createdAt } }`,
+			wantErr: "Query complexity 6264 exceeds the maximum of 5000.",
+		},
+		{
+			name:    "Page sizes over the maximum count as the maximum",
+			query:   `query ($n: Int) { users(first: $n) { nodes { statusHistory { id actor fromStatus toStatus reason createdAt } } } }`,
+			vars:    map[string]any{"n": 1e12},
+			wantErr: "Query complexity 6201 exceeds the maximum of 5000.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: test.query})
+			assert.NoError(t, err)
+
+			err = checkComplexity(doc, doc.Definitions[0].(*ast.OperationDefinition), test.vars)
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.wantErr)
+			}
+		})
+	}
+}
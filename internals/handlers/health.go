@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/health"
+)
+
+// Healthz reports that the process is alive. It never touches a dependency,
+// so a database outage doesn't get the process restarted.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Alive.",
+	})
+}
+
+// Readyz reports whether the API should get traffic: it is not shutting
+// down and every critical dependency is up. It is public, so only up or down
+// is reported per check and errors, which name hosts and drivers, are
+// logged instead.
+func Readyz(c *gin.Context, checks []health.Check, draining bool) {
+	if draining {
+		c.JSON(http.StatusServiceUnavailable, jsonResponse{
+			Status:  "error",
+			Message: "Shutting down.",
+			Data:    gin.H{"draining": true},
+		})
+		return
+	}
+
+	ready, results := health.Run(c.Request.Context(), health.Critical(checks))
+	for name, result := range results {
+		if result.Error != "" {
+			slog.WarnContext(c.Request.Context(), "Dependency not ready", "check", name, "error", result.Error)
+			result.Error = ""
+			results[name] = result
+		}
+	}
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, jsonResponse{
+			Status:  "error",
+			Message: "Not ready.",
+			Data:    gin.H{"checks": results},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Ready.",
+		Data:    gin.H{"checks": results},
+	})
+}
+
+// HealthDetails reports every dependency's status, latency and error and
+// the database pool's stats, for operators on the admin port. It fails like
+// Readyz.
+func HealthDetails(c *gin.Context, checks []health.Check, draining bool, pool sql.DBStats) {
+	ready, results := health.Run(c.Request.Context(), checks)
+	ready = ready && !draining
+
+	data := gin.H{
+		"ready":    ready,
+		"draining": draining,
+		"checks":   results,
+		"pool":     health.PoolStats(pool),
+	}
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, jsonResponse{
+			Status:  "error",
+			Message: "Not ready.",
+			Data:    data,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Ready.",
+		Data:    data,
+	})
+}
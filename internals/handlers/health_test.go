@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name     string
+		url      string
+		checks   []health.Check
+		draining bool
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Alive while the database is down",
+			url:      "/healthz",
+			checks:   []health.Check{{Name: "database", Critical: true, Probe: down}},
+			wantCode: http.StatusOK,
+			wantBody: `{"status":"success","message":"Alive.","data":null}`,
+		},
+		{
+			name:     "Ready",
+			url:      "/readyz",
+			checks:   []health.Check{{Name: "database", Critical: true, Probe: up}, {Name: "broker", Probe: down}},
+			wantCode: http.StatusOK,
+			wantBody: `{"status":"success","message":"Ready.","data":{"checks":{"database":{"status":"up","latency_ms":0}}}}`,
+		},
+		{
+			name:     "Not ready when the database is down, without saying why",
+			url:      "/readyz",
+			checks:   []health.Check{{Name: "database", Critical: true, Probe: down}},
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: `{"status":"error","message":"Not ready.","data":{"checks":{"database":{"status":"down","latency_ms":0}}}}`,
+		},
+		{
+			name:     "Not ready while draining",
+			url:      "/readyz",
+			checks:   []health.Check{{Name: "database", Critical: true, Probe: up}},
+			draining: true,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: `{"status":"error","message":"Shutting down.","data":{"draining":true}}`,
+		},
+		{
+			name:     "Details report optional dependencies and the pool",
+			url:      "/health/details",
+			checks:   []health.Check{{Name: "database", Critical: true, Probe: up}, {Name: "broker", Probe: down}},
+			wantCode: http.StatusOK,
+			wantBody: `{"status":"success","message":"Ready.","data":{"checks":{"broker":{"status":"down","latency_ms":0,"error":"connection refused"},"database":{"status":"up","latency_ms":0}},"draining":false,"pool":{"max_open_connections":100,"open_connections":3,"in_use":1,"idle":2,"wait_count":0,"wait_duration_ms":0,"max_idle_closed":0},"ready":true}}`,
+		},
+		{
+			name:     "Details while draining",
+			url:      "/health/details",
+			checks:   []health.Check{{Name: "database", Critical: true, Probe: up}},
+			draining: true,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: `{"status":"error","message":"Not ready.","data":{"checks":{"database":{"status":"up","latency_ms":0}},"draining":true,"pool":{"max_open_connections":100,"open_connections":3,"in_use":1,"idle":2,"wait_count":0,"wait_duration_ms":0,"max_idle_closed":0},"ready":false}}`,
+		},
+	}
+
+	// latencies vary from run to run
+	latency := regexp.MustCompile(`"latency_ms":[0-9.e-]+`)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := gin.Default()
+			r.GET("/healthz", Healthz)
+			r.GET("/readyz", func(c *gin.Context) {
+				Readyz(c, test.checks, test.draining)
+			})
+			r.GET("/health/details", func(c *gin.Context) {
+				HealthDetails(c, test.checks, test.draining, sql.DBStats{MaxOpenConnections: 100, OpenConnections: 3, InUse: 1, Idle: 2})
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, test.wantCode, w.Code)
+			assert.Equal(t, test.wantBody, latency.ReplaceAllString(w.Body.String(), `"latency_ms":0`))
+		})
+	}
+}
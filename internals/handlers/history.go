@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"gorm.io/gorm"
+)
+
+// GetUserHistory lists every recorded change of a user, oldest first. It
+// also works for deleted users, so it does not require the user to exist.
+func GetUserHistory(c *gin.Context, db *gorm.DB) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	changes, err := models.GetUserChanges(db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve user history.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+	if len(changes) == 0 {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "User does not exist.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Retrieved user history.",
+		Data: gin.H{
+			"history": changes,
+		},
+	})
+}
+
+// getUserAsOf responds with the user as it was at the RFC 3339 time asOf.
+func getUserAsOf(c *gin.Context, db *gorm.DB, id uint, asOf string) {
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "as_of must be an RFC 3339 timestamp.",
+		})
+		return
+	}
+
+	user, err := models.GetUserAsOf(db, id, at)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// not yet created, or already deleted
+		c.JSON(http.StatusNotFound, jsonResponse{
+			Status:  "error",
+			Message: "User did not exist at that time.",
+		})
+		return
+	}
+	if err != nil {
+		checkRecordExists(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "User retrieved successfully.",
+		Data: gin.H{
+			"user":  user,
+			"as_of": at,
+		},
+	})
+}
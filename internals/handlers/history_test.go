@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserHistory(t *testing.T) {
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	changes := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "user_id", "action", "diff", "snapshot", "actor", "request_id", "created_at"}).
+			AddRow(1, 7, "created", `{"username":{"from":null,"to":"obi"}}`, `{"id":7,"username":"obi"}`, "alice", "req-1", created).
+			AddRow(2, 7, "updated", `{"username":{"from":"obi","to":"obi2"}}`, `{"id":7,"username":"obi2"}`, "bob", "req-2", updated)
+	}
+	asOf := `SELECT \* FROM "user_changes" WHERE user_id = \$1 AND created_at <= \$2 ORDER BY created_at DESC, id DESC`
+
+	tests := []struct {
+		name     string
+		url      string
+		expect   func(mock sqlmock.Sqlmock)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "History oldest first",
+			url:  "/users/7/history",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "user_changes" WHERE user_id = \$1 ORDER BY created_at, id`).WithArgs(7).
+					WillReturnRows(changes())
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"status":"success","message":"Retrieved user history.","data":{"history":[` +
+				`{"id":1,"user_id":7,"action":"created","diff":{"username":{"from":null,"to":"obi"}},"snapshot":{"id":7,"username":"obi"},"actor":"alice","request_id":"req-1","created_at":"2024-06-01T12:00:00Z"},` +
+				`{"id":2,"user_id":7,"action":"updated","diff":{"username":{"from":"obi","to":"obi2"}},"snapshot":{"id":7,"username":"obi2"},"actor":"bob","request_id":"req-2","created_at":"2024-06-01T13:00:00Z"}]}}`,
+		},
+		{
+			name: "History of an unknown user",
+			url:  "/users/8/history",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "user_changes" WHERE user_id = \$1`).WithArgs(8).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","message":"User does not exist.","data":null}`,
+		},
+		{
+			name: "As of a time between changes",
+			url:  "/users/7?as_of=2024-06-01T12:30:00Z",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(asOf).WithArgs(7, created.Add(30*time.Minute), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "action", "snapshot", "created_at"}).
+						AddRow(1, 7, "created", `{"id":7,"username":"obi"}`, created))
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"status":"success","message":"User retrieved successfully.","data":{"as_of":"2024-06-01T12:30:00Z","user":{"id":7,"username":"obi"}}}`,
+		},
+		{
+			name: "As of a time before creation",
+			url:  "/users/7?as_of=2024-05-01T00:00:00Z",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(asOf).WithArgs(7, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			wantCode: http.StatusNotFound,
+			wantBody: `{"status":"error","message":"User did not exist at that time.","data":null}`,
+		},
+		{
+			name: "As of a time after deletion",
+			url:  "/users/7?as_of=2024-07-01T00:00:00Z",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(asOf).WithArgs(7, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "action", "snapshot", "created_at"}).
+						AddRow(3, 7, "deleted", nil, updated.Add(time.Hour)))
+			},
+			wantCode: http.StatusNotFound,
+			wantBody: `{"status":"error","message":"User did not exist at that time.","data":null}`,
+		},
+		{
+			name:     "Reject malformed as_of",
+			url:      "/users/7?as_of=yesterday",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","message":"as_of must be an RFC 3339 timestamp.","data":null}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock := InitDB(t)
+			rawDB, err := db.DB()
+			if err != nil {
+				t.Fatalf("Unable to get sql.DB from gorm.DB, %v", err)
+			}
+			defer rawDB.Close()
+
+			if test.expect != nil {
+				test.expect(mock)
+			}
+
+			gin.SetMode(gin.ReleaseMode)
+			r := gin.New()
+			r.GET("/users/:userID", func(c *gin.Context) {
+				GetUserByID(c, db)
+			})
+			r.GET("/users/:userID/history", func(c *gin.Context) {
+				GetUserHistory(c, db)
+			})
+
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, test.wantCode, w.Code)
+			assert.JSONEq(t, test.wantBody, w.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
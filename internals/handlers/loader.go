@@ -0,0 +1,58 @@
+package handlers
+
+// batchLoader is a DataLoader for GraphQL resolvers. load queues a key and
+// returns a thunk; graphql-go resolves every field of a level before calling
+// the thunks, so the first thunk fetches all the keys queued so far with a
+// single query instead of one per parent object. Results are cached for the
+// rest of the request. GraphQL resolves fields one at a time, so there is no
+// locking.
+type batchLoader[K comparable, V any] struct {
+	fetch   func(keys []K) (map[K]V, error)
+	pending []K
+	queued  map[K]bool
+	results map[K]V
+	errs    map[K]error
+}
+
+func newBatchLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{
+		fetch:   fetch,
+		queued:  map[K]bool{},
+		results: map[K]V{},
+		errs:    map[K]error{},
+	}
+}
+
+// load returns a thunk resolving to the value for key, or its zero value if
+// fetch returned none.
+func (l *batchLoader[K, V]) load(key K) func() (any, error) {
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+
+	return func() (any, error) {
+		if len(l.pending) > 0 {
+			l.dispatch()
+		}
+		if err := l.errs[key]; err != nil {
+			return nil, err
+		}
+
+		return l.results[key], nil
+	}
+}
+
+func (l *batchLoader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+
+	values, err := l.fetch(keys)
+	for _, key := range keys {
+		if err != nil {
+			l.errs[key] = err
+			continue
+		}
+		l.results[key] = values[key]
+	}
+}
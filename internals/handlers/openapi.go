@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/openapi"
+)
+
+// Operations documents every /api route, keyed by method and gin path. The
+// router test fails when a route is missing from it.
+var Operations = map[string]openapi.Operation{
+	"GET /api/openapi.json": {Summary: "This OpenAPI document", Tag: "docs", Produces: "application/json"},
+	"GET /api/docs":         {Summary: "Swagger UI for this document", Tag: "docs", Produces: "text/html"},
+
+	"POST /api/organizations/": {
+		Summary:      "Create an organization",
+		Tag:          "organizations",
+		Admin:        true,
+		Body:         models.Organizations{},
+		BodyRequired: []string{"name", "slug"},
+		Data:         map[string]any{"organization": models.Organizations{}},
+	},
+	"GET /api/organizations/": {
+		Summary: "List organizations",
+		Tag:     "organizations",
+		Admin:   true,
+		Data:    map[string]any{"organizations": []models.Organizations{}},
+	},
+
+	"POST /api/attributes/": {
+		Summary:      "Define a custom user attribute",
+		Tag:          "attributes",
+		Tenant:       true,
+		Admin:        true,
+		Body:         models.AttributeDefinitions{},
+		BodyRequired: []string{"name", "type"},
+		Data:         map[string]any{"attribute": models.AttributeDefinitions{}},
+	},
+	"GET /api/attributes/": {
+		Summary: "List custom attribute definitions",
+		Tag:     "attributes",
+		Tenant:  true,
+		Data:    map[string]any{"attributes": []models.AttributeDefinitions{}},
+	},
+	"DELETE /api/attributes/:name": {Summary: "Delete a custom attribute definition", Tag: "attributes", Tenant: true, Admin: true},
+
+	"GET /api/preferences": {
+		Summary: "Preference namespaces, keys and defaults",
+		Tag:     "preferences",
+		Data:    map[string]any{"namespaces": models.PreferenceNamespaces},
+	},
+
+	"GET /api/audit": {
+		Summary: "Search the security audit log",
+		Tag:     "audit",
+		Tenant:  true,
+		Query: []openapi.Query{
+			{Name: "actor", Type: "string"},
+			{Name: "action", Type: "string"},
+			{Name: "from", Type: "string", Description: "RFC 3339 time"},
+			{Name: "to", Type: "string", Description: "RFC 3339 time"},
+			{Name: "limit", Type: "integer"},
+		},
+		Data: map[string]any{"entries": []models.AuditEntries{}},
+	},
+
+	"POST /api/webhooks/": {
+		Summary:      "Subscribe a webhook to user events",
+		Tag:          "webhooks",
+		Tenant:       true,
+		Body:         webhookRequest{},
+		BodyRequired: []string{"url", "events"},
+		Data:         map[string]any{"webhook": models.Webhooks{}, "secret": ""},
+	},
+	"GET /api/webhooks/": {
+		Summary: "List webhooks",
+		Tag:     "webhooks",
+		Tenant:  true,
+		Data:    map[string]any{"webhooks": []models.Webhooks{}},
+	},
+	"DELETE /api/webhooks/:webhookID": {Summary: "Delete a webhook", Tag: "webhooks", Tenant: true},
+	"GET /api/webhooks/:webhookID/deliveries": {
+		Summary: "List a webhook's deliveries",
+		Tag:     "webhooks",
+		Tenant:  true,
+		Query:   []openapi.Query{{Name: "status", Type: "string", Description: "pending, delivered or dead"}},
+		Data:    map[string]any{"deliveries": []models.WebhookDeliveries{}},
+	},
+	"POST /api/webhooks/:webhookID/deliveries/:deliveryID/redeliver": {
+		Summary: "Retry a delivery",
+		Tag:     "webhooks",
+		Tenant:  true,
+		Data:    map[string]any{"delivery": models.WebhookDeliveries{}},
+	},
+
+	"POST /api/users/": {
+		Summary:      "Create a user",
+		Tag:          "users",
+		Tenant:       true,
+		Body:         models.Users{},
+		BodyRequired: []string{"username", "email"},
+		Data:         map[string]any{"user": models.Users{}},
+	},
+	"GET /api/users/": {
+		Summary: "List users, or get one by username",
+		Tag:     "users",
+		Tenant:  true,
+		Query: []openapi.Query{
+			{Name: "username", Type: "string"},
+			{Name: "status", Type: "string"},
+			{Name: "attr.{name}", Type: "string", Description: "Custom attribute filter, e.g. attr.department=eng"},
+			{Name: "limit", Type: "integer", Description: "Page size, 1 to 100; pages are in ID order"},
+			{Name: "after", Type: "integer", Description: "Return users after this ID, i.e. the previous page's next_after"},
+		},
+		Data: map[string]any{"users": []models.Users{}, "user": models.Users{}, "next_after": uint(0)},
+	},
+	"GET /api/users/:userID": {
+		Summary: "Get a user",
+		Tag:     "users",
+		Tenant:  true,
+		Query:   []openapi.Query{{Name: "as_of", Type: "string", Description: "RFC 3339 time to read the user at"}},
+		Data:    map[string]any{"user": models.Users{}, "as_of": time.Time{}},
+	},
+	"GET /api/users/events": {
+		Summary:  "Stream user events",
+		Tag:      "users",
+		Tenant:   true,
+		Query:    []openapi.Query{{Name: "types", Type: "string", Description: "Comma-separated event types"}},
+		Produces: "text/event-stream",
+	},
+	"PUT /api/users/": {
+		Summary: "Update a user by username",
+		Tag:     "users",
+		Tenant:  true,
+		Query:   []openapi.Query{{Name: "username", Type: "string"}},
+		Body:    models.Users{},
+	},
+	"PUT /api/users/:userID": {Summary: "Update a user", Tag: "users", Tenant: true, Body: models.Users{}},
+	"DELETE /api/users/": {
+		Summary: "Delete a user by username",
+		Tag:     "users",
+		Tenant:  true,
+		Query:   []openapi.Query{{Name: "username", Type: "string"}},
+	},
+	"DELETE /api/users/:userID": {Summary: "Delete a user", Tag: "users", Tenant: true},
+	"GET /api/users/:userID/history": {
+		Summary: "A user's change history",
+		Tag:     "users",
+		Tenant:  true,
+		Data:    map[string]any{"history": []models.UserChanges{}},
+	},
+
+	"POST /api/users/:userID/suspend":    statusOperation("Suspend a user"),
+	"POST /api/users/:userID/lock":       statusOperation("Lock a user"),
+	"POST /api/users/:userID/deactivate": statusOperation("Deactivate a user"),
+	"POST /api/users/:userID/reactivate": statusOperation("Reactivate a user"),
+	"GET /api/users/:userID/status-history": {
+		Summary: "A user's status transitions",
+		Tag:     "status",
+		Tenant:  true,
+		Data:    map[string]any{"transitions": []models.UserStatusTransitions{}},
+	},
+
+	"GET /api/users/:userID/preferences": {
+		Summary: "A user's preferences",
+		Tag:     "preferences",
+		Tenant:  true,
+		Data:    map[string]any{"preferences": map[string]models.Attributes{}},
+	},
+	"PUT /api/users/:userID/preferences": {
+		Summary: "Update preferences in several namespaces",
+		Tag:     "preferences",
+		Tenant:  true,
+		Body:    map[string]models.Attributes{},
+		Data:    map[string]any{"preferences": map[string]models.Attributes{}},
+	},
+	"GET /api/users/:userID/preferences/:namespace": {
+		Summary: "A user's preferences in one namespace",
+		Tag:     "preferences",
+		Tenant:  true,
+		Data:    map[string]any{"preferences": map[string]models.Attributes{}},
+	},
+	"PUT /api/users/:userID/preferences/:namespace": {
+		Summary: "Update preferences in one namespace",
+		Tag:     "preferences",
+		Tenant:  true,
+		Body:    models.Attributes{},
+		Data:    map[string]any{"preferences": map[string]models.Attributes{}},
+	},
+
+	"PUT /api/users/:userID/avatar": {
+		Summary:   "Upload an avatar (PNG, JPEG or WebP)",
+		Tag:       "avatars",
+		Tenant:    true,
+		BodyMedia: "image/*",
+	},
+	"GET /api/users/:userID/avatar": {
+		Summary:  "A user's avatar, or an identicon",
+		Tag:      "avatars",
+		Tenant:   true,
+		Query:    []openapi.Query{{Name: "size", Type: "integer", Description: "64, 128 or 256"}},
+		Produces: "image/png",
+	},
+	"DELETE /api/users/:userID/avatar": {Summary: "Remove a user's avatar", Tag: "avatars", Tenant: true},
+}
+
+func statusOperation(summary string) openapi.Operation {
+	return openapi.Operation{
+		Summary:      summary,
+		Tag:          "status",
+		Tenant:       true,
+		Body:         statusRequest{},
+		BodyOptional: true,
+		Data:         map[string]any{"user": models.Users{}},
+	}
+}
+
+// OpenAPI builds the API document from the registered routes.
+func OpenAPI(routes gin.RoutesInfo) *openapi.Document {
+	return openapi.Build(openapi.Info{
+		Title:       "Users API",
+		Version:     "1.0.0",
+		Description: "Multi-tenant user management. Every response uses the same envelope; data holds the operation's result.",
+	}, routes, Operations, jsonResponse{})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"gorm.io/gorm"
+)
+
+func CreateOrganization(c *gin.Context, db *gorm.DB) {
+	var org models.Organizations
+
+	err := c.ShouldBindBodyWithJSON(&org)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Request body not valid.",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	org.ID = 0
+	org.Slug = strings.ToLower(strings.TrimSpace(org.Slug))
+	if org.Name == "" || org.Slug == "" {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "You must specify both a name and a slug.",
+		})
+		return
+	}
+
+	// organizations are audited outside any organization
+	err = models.CreateOrganization(db.WithContext(tenant.WithoutScope(c.Request.Context())), &org)
+	if err != nil {
+		if models.IsUniqueViolation(err) {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "Slug has been taken!",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Organization operation failed",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Organization created successfully.",
+		Data: gin.H{
+			"organization": org,
+		},
+	})
+}
+
+func GetOrganizations(c *gin.Context, db *gorm.DB) {
+	orgs, err := models.GetOrganizations(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve organizations.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Retrieved all organizations.",
+		Data: gin.H{
+			"organizations": orgs,
+		},
+	})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"gorm.io/gorm"
+)
+
+// GetPreferenceSchema lists every preference namespace with its keys, types
+// and defaults.
+func GetPreferenceSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Retrieved preference schema.",
+		Data: gin.H{
+			"namespaces": models.PreferenceNamespaces,
+		},
+	})
+}
+
+func GetPreferences(c *gin.Context, db *gorm.DB) {
+	namespaces := models.PreferenceNamespaceNames()
+	if namespace := c.Param("namespace"); namespace != "" {
+		if _, ok := models.PreferenceNamespaces[namespace]; !ok {
+			unknownNamespace(c)
+			return
+		}
+		namespaces = []string{namespace}
+	}
+
+	user, ok := pathUser(c, db)
+	if !ok {
+		return
+	}
+
+	prefs, err := models.GetUserPreferences(db, user.ID, namespaces...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve preferences.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Preferences retrieved successfully.",
+		Data: gin.H{
+			"preferences": prefs,
+		},
+	})
+}
+
+// UpdatePreferences merges the body into the user's preferences. On
+// /preferences/:namespace the body maps keys to values; on /preferences it
+// maps namespaces to such objects. A null value resets a key to its default.
+func UpdatePreferences(c *gin.Context, db *gorm.DB) {
+	changes := map[string]models.Attributes{}
+	namespace := c.Param("namespace")
+	if namespace != "" {
+		var values models.Attributes
+		if !bindPreferences(c, &values) {
+			return
+		}
+		changes[namespace] = values
+	} else if !bindPreferences(c, &changes) {
+		return
+	}
+
+	for namespace, values := range changes {
+		err := models.ValidatePreferences(namespace, values)
+		if errors.Is(err, models.ErrUnknownNamespace) {
+			unknownNamespace(c)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "Preferences not valid.",
+				Error: gin.H{
+					"error": err.Error(),
+				},
+			})
+			return
+		}
+	}
+
+	user, ok := pathUser(c, db)
+	if !ok {
+		return
+	}
+
+	err := models.SetUserPreferences(db, user, changes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to update preferences.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	namespaces := make([]string, 0, len(changes))
+	for namespace := range changes {
+		namespaces = append(namespaces, namespace)
+	}
+	prefs, err := models.GetUserPreferences(db, user.ID, namespaces...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve preferences.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Preferences updated successfully.",
+		Data: gin.H{
+			"preferences": prefs,
+		},
+	})
+}
+
+func bindPreferences(c *gin.Context, v any) bool {
+	err := c.ShouldBindBodyWithJSON(v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Request body not valid.",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return false
+	}
+
+	return true
+}
+
+func unknownNamespace(c *gin.Context) {
+	c.JSON(http.StatusNotFound, jsonResponse{
+		Status:  "error",
+		Message: "Preference namespace does not exist.",
+	})
+}
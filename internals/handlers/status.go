@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"gorm.io/gorm"
+)
+
+type statusRequest struct {
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"until"`
+}
+
+func SuspendUser(c *gin.Context, db *gorm.DB) {
+	transitionUser(c, db, models.StatusSuspended, "User suspended successfully.")
+}
+
+func LockUser(c *gin.Context, db *gorm.DB) {
+	transitionUser(c, db, models.StatusLocked, "User locked successfully.")
+}
+
+func DeactivateUser(c *gin.Context, db *gorm.DB) {
+	transitionUser(c, db, models.StatusDeactivated, "User deactivated successfully.")
+}
+
+func ReactivateUser(c *gin.Context, db *gorm.DB) {
+	transitionUser(c, db, models.StatusActive, "User reactivated successfully.")
+}
+
+func GetUserStatusHistory(c *gin.Context, db *gorm.DB) {
+	id, err := strconv.ParseUint(c.Param("userID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "UserID must be a positive interger.",
+		})
+		return
+	}
+
+	_, err = models.GetUserByID(db, uint(id))
+	if err != nil {
+		checkRecordExists(c, err)
+		return
+	}
+
+	transitions, err := models.GetUserStatusTransitions(db, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve status history.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Retrieved status history.",
+		Data: gin.H{
+			"transitions": transitions,
+		},
+	})
+}
+
+func transitionUser(c *gin.Context, db *gorm.DB, to string, message string) {
+	id, err := strconv.ParseUint(c.Param("userID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "UserID must be a positive interger.",
+		})
+		return
+	}
+
+	var req statusRequest
+	if c.Request.ContentLength > 0 {
+		err = c.ShouldBindBodyWithJSON(&req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "Request body not valid.",
+				Error: gin.H{
+					"error": err.Error(),
+				},
+			})
+			return
+		}
+	}
+
+	if req.Until != nil && !req.Until.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Suspension end must be in the future.",
+		})
+		return
+	}
+
+	user, err := models.TransitionUserStatus(db, uint(id), to, req.Reason, req.Until)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, jsonResponse{
+				Status:  "error",
+				Message: "User cannot be moved to " + to + ".",
+			})
+			return
+		}
+		checkRecordExists(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: message,
+		Data: gin.H{
+			"user": user,
+		},
+	})
+}
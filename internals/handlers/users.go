@@ -1,13 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/obimadu/ipc3-stage-2/internals/db"
 	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"gorm.io/gorm"
 )
 
 type jsonResponse struct {
@@ -17,7 +18,7 @@ type jsonResponse struct {
 	Error   map[string]any `json:"error,omitempty"`
 }
 
-func UpdateUser(c *gin.Context) {
+func UpdateUser(c *gin.Context, db *gorm.DB) {
 
 	var user models.Users
 	err := c.ShouldBindBodyWithJSON(&user)
@@ -29,6 +30,15 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// status only changes through the lifecycle endpoints
+	user.Status = ""
+	user.SuspendedUntil = nil
+
+	// attributes sent on update replace the whole set
+	if user.Attributes != nil && !validateAttributes(c, db, user.Attributes) {
+		return
+	}
+
 	username := c.Query("username")
 	userID := c.Param("userID")
 	if username == "" && userID != "" {
@@ -42,9 +52,9 @@ func UpdateUser(c *gin.Context) {
 			return
 		}
 
-		err = models.UpdateUserByID(db.DB, uint(id), user)
+		err = models.UpdateUserByID(db, uint(id), user)
 		if err != nil {
-			checkUnique(c, err)
+			userWriteError(err).respond(c)
 			return
 		}
 
@@ -54,9 +64,9 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	} else if userID == "" && username != "" {
-		err = models.UpdateUserByUsername(db.DB, username, user)
+		err = models.UpdateUserByUsername(db, username, user)
 		if err != nil {
-			checkUnique(c, err)
+			userWriteError(err).respond(c)
 			return
 		}
 
@@ -74,46 +84,114 @@ func UpdateUser(c *gin.Context) {
 
 }
 
+// requestError is a failed request's status code and message, with the
+// underlying error when there is one. REST handlers write it as a
+// jsonResponse and GraphQL reports it with the status in the error's
+// extensions, so both APIs fail the same way.
+type requestError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+// Extensions implements gqlerrors.ExtendedError.
+func (e *requestError) Extensions() map[string]any {
+	ext := map[string]any{"status": e.Status}
+	if e.Err != nil {
+		ext["error"] = e.Err.Error()
+	}
+
+	return ext
+}
+
+// respond writes e as the response.
+func (e *requestError) respond(c *gin.Context) {
+	resp := jsonResponse{
+		Status:  "error",
+		Message: e.Message,
+	}
+	if e.Err != nil {
+		resp.Error = gin.H{
+			"error": e.Err.Error(),
+		}
+	}
+
+	c.JSON(e.Status, resp)
+}
+
 func checkUnique(c *gin.Context, err error) {
-	if strings.Contains(err.Error(), "duplicate key value violates unique constraint") && strings.Contains(err.Error(), "email") {
-		c.JSON(http.StatusBadRequest, jsonResponse{
-			Status:  "error",
-			Message: "Email has been taken!",
-		})
-		return
-	} else if strings.Contains(err.Error(), "duplicate key value violates unique constraint") && strings.Contains(err.Error(), "username") {
-		c.JSON(http.StatusBadRequest, jsonResponse{
-			Status:  "error",
-			Message: "Username has been taken!",
-		})
-		return
-	} else {
-		c.JSON(http.StatusInternalServerError, jsonResponse{
-			Status:  "error",
-			Message: "User operation failed",
-			Error: gin.H{
-				"error": err.Error(),
-			},
-		})
-		return
+	uniqueError(err).respond(c)
+}
+
+// uniqueError reports a failed user write, naming the field when it broke a
+// unique constraint.
+func uniqueError(err error) *requestError {
+	switch models.UniqueViolation(err) {
+	case "email":
+		return &requestError{Status: http.StatusBadRequest, Message: "Email has been taken!"}
+	case "username":
+		return &requestError{Status: http.StatusBadRequest, Message: "Username has been taken!"}
 	}
+
+	return &requestError{Status: http.StatusInternalServerError, Message: "User operation failed", Err: err}
 }
 
 func checkRecordExists(c *gin.Context, err error) {
+	recordExistsError(err).respond(c)
+}
+
+// recordExistsError reports a failed user lookup.
+func recordExistsError(err error) *requestError {
 	if strings.Contains(err.Error(), "record not found") {
+		return &requestError{Status: http.StatusBadRequest, Message: "User does not exist."}
+	}
+
+	return &requestError{Status: http.StatusInternalServerError, Message: "Failed to retrieve user.", Err: err}
+}
+
+// userWriteError reports a failed update or delete: a missing user or a
+// unique constraint violation.
+func userWriteError(err error) *requestError {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return recordExistsError(err)
+	}
+
+	return uniqueError(err)
+}
+
+// pathUser loads the user named by the :userID path parameter and writes the
+// error response if there is none. It reports whether the request may
+// continue.
+func pathUser(c *gin.Context, db *gorm.DB) (*models.Users, bool) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := models.GetUserByID(db, id)
+	if err != nil {
+		checkRecordExists(c, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// userIDParam parses the :userID path parameter and writes the error
+// response if it is not valid. It reports whether the request may continue.
+func userIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("userID"), 10, 32)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, jsonResponse{
 			Status:  "error",
-			Message: "User does not exist.",
+			Message: "UserID must be a positive interger.",
 		})
-		return
-	} else {
-		c.JSON(http.StatusInternalServerError, jsonResponse{
-			Status:  "error",
-			Message: "Failed to retrieve user.",
-			Error: gin.H{
-				"error": err.Error(),
-			},
-		})
-		return
+		return 0, false
 	}
+
+	return uint(id), true
 }
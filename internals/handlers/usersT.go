@@ -24,6 +24,10 @@ func CreateUser(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	// status only changes through the lifecycle endpoints
+	user.Status = ""
+	user.SuspendedUntil = nil
+
 	if user.Username == "" || user.Email == "" {
 		c.JSON(http.StatusBadRequest, jsonResponse{
 			Status:  "error",
@@ -32,7 +36,11 @@ func CreateUser(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	err = models.CreateUser(db, user)
+	if !validateAttributes(c, db, user.Attributes) {
+		return
+	}
+
+	err = models.CreateUser(db, &user)
 	if err != nil {
 		checkUnique(c, err)
 		return
@@ -41,6 +49,9 @@ func CreateUser(c *gin.Context, db *gorm.DB) {
 	c.JSON(http.StatusOK, jsonResponse{
 		Status:  "success",
 		Message: "User created successfully.",
+		Data: gin.H{
+			"user": user,
+		},
 	})
 }
 
@@ -49,12 +60,7 @@ func GetAll(c *gin.Context, db *gorm.DB) {
 	if username := c.Query("username"); username != "" {
 		user, err := models.GetUserByUsername(db, username)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, jsonResponse{
-				Status:  "error",
-				Message: "Failed to retrieve users.",
-				Error: gin.H{
-					"error": err.Error(),
-				}})
+			checkRecordExists(c, err)
 			return
 		}
 
@@ -68,7 +74,27 @@ func GetAll(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	users, err := models.GetAll(db)
+	status := c.Query("status")
+	if status != "" && !models.ValidStatus(status) {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Status filter not valid.",
+		})
+		return
+	}
+
+	attributes, ok := attributeFilters(c, db)
+	if !ok {
+		return
+	}
+
+	filter := models.UserFilter{Status: status, Attributes: attributes}
+	limit, ok := pageParams(c, &filter)
+	if !ok {
+		return
+	}
+
+	users, err := models.GetAll(db, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, jsonResponse{
 			Status:  "error",
@@ -79,15 +105,58 @@ func GetAll(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	data := gin.H{
+		"users": users,
+	}
+	if limit > 0 && len(users) > limit {
+		users = users[:limit]
+		data["users"] = users
+		data["next_after"] = users[limit-1].ID
+	}
+
 	c.JSON(http.StatusOK, jsonResponse{
 		Status:  "success",
 		Message: "Retrieved all users.",
-		Data: gin.H{
-			"users": users,
-		},
+		Data:    data,
 	})
 }
 
+// maxPageLimit bounds the limit query parameter of GetAll.
+const maxPageLimit = 100
+
+// pageParams reads the limit and after query parameters into filter and
+// writes the error response if they are not valid. With a limit, filter asks
+// for one extra user so the caller can tell whether another page follows.
+func pageParams(c *gin.Context, filter *models.UserFilter) (int, bool) {
+	if after := c.Query("after"); after != "" {
+		id, err := strconv.ParseUint(after, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "After must be a positive interger.",
+			})
+			return 0, false
+		}
+		filter.AfterID = uint(id)
+	}
+
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageLimit {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "Limit must be between 1 and " + strconv.Itoa(maxPageLimit) + ".",
+			})
+			return 0, false
+		}
+		limit = n
+		filter.Limit = n + 1
+	}
+
+	return limit, true
+}
+
 func GetUserByID(c *gin.Context, db *gorm.DB) {
 	userID := c.Param("userID")
 	id, err := strconv.ParseUint(userID, 10, 32)
@@ -99,6 +168,11 @@ func GetUserByID(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	if asOf := c.Query("as_of"); asOf != "" {
+		getUserAsOf(c, db, uint(id), asOf)
+		return
+	}
+
 	user, err := models.GetUserByID(db, uint(id))
 	if err != nil {
 		checkRecordExists(c, err)
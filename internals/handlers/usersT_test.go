@@ -51,6 +51,16 @@ func InitDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
 	return db, mock
 }
 
+// expectAudit expects an audit entry to be appended to a new chain.
+func expectAudit(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT \* FROM "audit_entries"`).WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectExec(`INSERT INTO "audit_chains"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT \* FROM "audit_chains" .* FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"organization_id", "seq", "hash"}).AddRow(0, 0, ""))
+	mock.ExpectQuery(`INSERT INTO "audit_entries"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`UPDATE "audit_chains" SET "hash"=\$1,"seq"=\$2`).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
 func TestCreateUser(t *testing.T) {
 	tests := []test{
 		{
@@ -67,6 +77,9 @@ func TestCreateUser(t *testing.T) {
 				httpResponseBody: jsonResponse{
 					Status:  "success",
 					Message: "User created successfully.",
+					Data: gin.H{
+						"user": map[string]any{"id": 0.0, "username": "user1", "email": "user1@example.com", "status": "active"},
+					},
 				},
 			},
 		},
@@ -134,6 +147,9 @@ func TestCreateUser(t *testing.T) {
 			}
 			defer rawDB.Close()
 
+			// attribute definitions
+			mock.ExpectQuery(".*").WillReturnRows(sqlmock.NewRows(nil))
+
 			switch test.args.sqlStatus {
 			case "error":
 				mock.ExpectBegin()
@@ -142,6 +158,9 @@ func TestCreateUser(t *testing.T) {
 			default:
 				mock.ExpectBegin()
 				mock.ExpectQuery(".*").WillReturnRows(sqlmock.NewRows(nil))
+				// user history and outbox event
+				mock.ExpectQuery(".*").WillReturnRows(sqlmock.NewRows(nil))
+				mock.ExpectQuery(".*").WillReturnRows(sqlmock.NewRows(nil))
 				mock.ExpectCommit()
 			}
 
@@ -215,6 +234,50 @@ func TestGetAll(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Get a page of users",
+			args: args{
+				sqlStatement: `SELECT \* FROM "users" WHERE id > \$1 ORDER BY id LIMIT \$2`,
+				sqlReturnRows: [][]any{
+					{3, "Obi", "obi@example.com"},
+					{4, "Marry", "marry@example.com"},
+				},
+				httpRequestURL:       "/?limit=1&after=2",
+				httpRequestMethod:    "GET",
+				httpResponseBodyCode: http.StatusOK,
+				httpResponseBody: jsonResponse{
+					Status:  "success",
+					Message: "Retrieved all users.",
+					Data: gin.H{
+						"users": []any{
+							map[string]any{"id": 3.0, "username": "Obi", "email": "obi@example.com"},
+						},
+						"next_after": 3.0,
+					},
+				},
+			},
+		},
+		{
+			name: "Get users after an ID",
+			args: args{
+				sqlStatement: `SELECT \* FROM "users" WHERE id > \$1 ORDER BY id$`,
+				sqlReturnRows: [][]any{
+					{3, "Obi", "obi@example.com"},
+				},
+				httpRequestURL:       "/?after=2",
+				httpRequestMethod:    "GET",
+				httpResponseBodyCode: http.StatusOK,
+				httpResponseBody: jsonResponse{
+					Status:  "success",
+					Message: "Retrieved all users.",
+					Data: gin.H{
+						"users": []any{
+							map[string]any{"id": 3.0, "username": "Obi", "email": "obi@example.com"},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "Get user by username",
 			args: args{
@@ -441,6 +504,10 @@ func TestDeleteUserByID(t *testing.T) {
 			mock.ExpectQuery(test.args.sqlStatement).WillReturnRows(rows)
 			mock.ExpectBegin()
 			mock.ExpectExec(test.args.sqlStatement).WillReturnResult(sqlmock.NewResult(1, 1))
+			// user history and outbox event
+			mock.ExpectQuery(test.args.sqlStatement).WillReturnRows(sqlmock.NewRows(nil))
+			mock.ExpectQuery(test.args.sqlStatement).WillReturnRows(sqlmock.NewRows(nil))
+			expectAudit(mock)
 			mock.ExpectCommit()
 
 			gin.SetMode(gin.ReleaseMode)
@@ -541,6 +608,10 @@ func TestDeleteUserByUsername(t *testing.T) {
 			mock.ExpectQuery(test.args.sqlStatement).WillReturnRows(rows)
 			mock.ExpectBegin()
 			mock.ExpectExec(test.args.sqlStatement).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+			// user history and outbox event
+			mock.ExpectQuery(test.args.sqlStatement).WillReturnRows(sqlmock.NewRows(nil))
+			mock.ExpectQuery(test.args.sqlStatement).WillReturnRows(sqlmock.NewRows(nil))
+			expectAudit(mock)
 			mock.ExpectCommit()
 
 			gin.SetMode(gin.ReleaseMode)
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"gorm.io/gorm"
+)
+
+// maxDeliveries bounds the deliveries listed per request.
+const maxDeliveries = 100
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+func CreateWebhook(c *gin.Context, db *gorm.DB) {
+	var req webhookRequest
+	err := c.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Request body not valid.",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	webhook := models.Webhooks{URL: req.URL, EventTypes: req.Events, Secret: req.Secret}
+	err = webhook.Validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Webhook not valid.",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	if webhook.Secret == "" {
+		webhook.Secret, err = newWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, jsonResponse{
+				Status:  "error",
+				Message: "Webhook operation failed",
+				Error: gin.H{
+					"error": err.Error(),
+				},
+			})
+			return
+		}
+	}
+
+	err = models.CreateWebhook(db, &webhook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Webhook operation failed",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	// the secret is only ever returned here
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Webhook created successfully.",
+		Data: gin.H{
+			"webhook": webhook,
+			"secret":  webhook.Secret,
+		},
+	})
+}
+
+func GetWebhooks(c *gin.Context, db *gorm.DB) {
+	webhooks, err := models.GetWebhooks(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve webhooks.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Retrieved all webhooks.",
+		Data: gin.H{
+			"webhooks": webhooks,
+		},
+	})
+}
+
+func DeleteWebhook(c *gin.Context, db *gorm.DB) {
+	id, ok := uintParam(c, "webhookID")
+	if !ok {
+		return
+	}
+
+	err := models.DeleteWebhookByID(db, id)
+	if err != nil {
+		checkWebhookExists(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Webhook deleted successfully.",
+	})
+}
+
+// GetWebhookDeliveries lists a webhook's deliveries; ?status=dead lists its
+// dead letters.
+func GetWebhookDeliveries(c *gin.Context, db *gorm.DB) {
+	id, ok := uintParam(c, "webhookID")
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" && status != models.DeliveryPending && status != models.DeliveryDelivered && status != models.DeliveryDead {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Status filter not valid.",
+		})
+		return
+	}
+
+	_, err := models.GetWebhookByID(db, id)
+	if err != nil {
+		checkWebhookExists(c, err)
+		return
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(db, id, status, maxDeliveries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Failed to retrieve deliveries.",
+			Error: gin.H{
+				"error": err.Error(),
+			}})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Retrieved webhook deliveries.",
+		Data: gin.H{
+			"deliveries": deliveries,
+		},
+	})
+}
+
+func RedeliverWebhookDelivery(c *gin.Context, db *gorm.DB) {
+	webhookID, ok := uintParam(c, "webhookID")
+	if !ok {
+		return
+	}
+	deliveryID, ok := uintParam(c, "deliveryID")
+	if !ok {
+		return
+	}
+
+	delivery, err := models.RedeliverWebhookDelivery(db, webhookID, deliveryID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, jsonResponse{
+				Status:  "error",
+				Message: "Delivery does not exist.",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, jsonResponse{
+			Status:  "error",
+			Message: "Webhook operation failed",
+			Error: gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jsonResponse{
+		Status:  "success",
+		Message: "Delivery queued for redelivery.",
+		Data: gin.H{
+			"delivery": delivery,
+		},
+	})
+}
+
+func checkWebhookExists(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: "Webhook does not exist.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, jsonResponse{
+		Status:  "error",
+		Message: "Failed to retrieve webhook.",
+		Error: gin.H{
+			"error": err.Error(),
+		},
+	})
+}
+
+// uintParam parses a positive integer path parameter and writes the error
+// response if it is not valid. It reports whether the request may continue.
+func uintParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, jsonResponse{
+			Status:  "error",
+			Message: name + " must be a positive interger.",
+		})
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,126 @@
+// Package health probes the API's dependencies for liveness and readiness
+// checks.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Timeout bounds each probe, so one hung dependency can't stall the others.
+var Timeout = 2 * time.Second
+
+// Pinger is implemented by dependencies that can be probed, e.g. event
+// publishers and blob stores.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Check is one dependency.
+type Check struct {
+	Name string
+	// Critical checks must pass for the API to be ready; the others are
+	// only reported.
+	Critical bool
+	Probe    func(ctx context.Context) error
+}
+
+// Result of one check.
+type Result struct {
+	Status    string  `json:"status"` // "up" or "down"
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Run probes every check at once and reports whether all the critical ones
+// passed.
+func Run(ctx context.Context, checks []Check) (bool, map[string]Result) {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Probe(ctx)
+			results[i] = Result{Status: "up", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				results[i].Status, results[i].Error = "down", err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	ok := true
+	byName := make(map[string]Result, len(checks))
+	for i, check := range checks {
+		byName[check.Name] = results[i]
+		if check.Critical && results[i].Status != "up" {
+			ok = false
+		}
+	}
+
+	return ok, byName
+}
+
+// Critical returns the critical checks.
+func Critical(checks []Check) []Check {
+	var critical []Check
+	for _, check := range checks {
+		if check.Critical {
+			critical = append(critical, check)
+		}
+	}
+
+	return critical
+}
+
+// Cached skips probe for ttl after it passes, for probes too costly to run
+// on every request. Failures are probed again on the next call.
+func Cached(ttl time.Duration, probe func(ctx context.Context) error) func(ctx context.Context) error {
+	var mu sync.Mutex
+	var passed time.Time
+
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !passed.IsZero() && time.Since(passed) < ttl {
+			return nil
+		}
+		if err := probe(ctx); err != nil {
+			return err
+		}
+		passed = time.Now()
+
+		return nil
+	}
+}
+
+// Pool is a database connection pool's stats.
+type Pool struct {
+	MaxOpen        int     `json:"max_open_connections"`
+	Open           int     `json:"open_connections"`
+	InUse          int     `json:"in_use"`
+	Idle           int     `json:"idle"`
+	WaitCount      int64   `json:"wait_count"`
+	WaitDurationMS float64 `json:"wait_duration_ms"`
+	MaxIdleClosed  int64   `json:"max_idle_closed"`
+}
+
+func PoolStats(stats sql.DBStats) Pool {
+	return Pool{
+		MaxOpen:        stats.MaxOpenConnections,
+		Open:           stats.OpenConnections,
+		InUse:          stats.InUse,
+		Idle:           stats.Idle,
+		WaitCount:      stats.WaitCount,
+		WaitDurationMS: float64(stats.WaitDuration.Microseconds()) / 1000,
+		MaxIdleClosed:  stats.MaxIdleClosed,
+	}
+}
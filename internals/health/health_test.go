@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	Timeout = 10 * time.Millisecond
+
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	hung := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantOK     bool
+		wantStatus map[string]string
+	}{
+		{
+			name:       "Everything up",
+			checks:     []Check{{Name: "database", Critical: true, Probe: up}, {Name: "broker", Probe: up}},
+			wantOK:     true,
+			wantStatus: map[string]string{"database": "up", "broker": "up"},
+		},
+		{
+			name:       "Optional dependency down",
+			checks:     []Check{{Name: "database", Critical: true, Probe: up}, {Name: "broker", Probe: down}},
+			wantOK:     true,
+			wantStatus: map[string]string{"database": "up", "broker": "down"},
+		},
+		{
+			name:       "Critical dependency down",
+			checks:     []Check{{Name: "database", Critical: true, Probe: down}, {Name: "broker", Probe: up}},
+			wantOK:     false,
+			wantStatus: map[string]string{"database": "down", "broker": "up"},
+		},
+		{
+			name:       "Critical dependency hung",
+			checks:     []Check{{Name: "database", Critical: true, Probe: hung}},
+			wantOK:     false,
+			wantStatus: map[string]string{"database": "down"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, results := Run(context.Background(), test.checks)
+			assert.Equal(t, test.wantOK, ok)
+
+			status := map[string]string{}
+			for name, result := range results {
+				status[name] = result.Status
+				if result.Status == "down" {
+					assert.NotEmpty(t, result.Error)
+				}
+			}
+			assert.Equal(t, test.wantStatus, status)
+		})
+	}
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	var err error
+	probe := Cached(time.Hour, func(ctx context.Context) error {
+		calls++
+		return err
+	})
+
+	// failures are probed every time
+	err = errors.New("column users.status is missing")
+	assert.Error(t, probe(context.Background()))
+	assert.Error(t, probe(context.Background()))
+	assert.Equal(t, 2, calls)
+
+	// a pass is remembered
+	err = nil
+	assert.NoError(t, probe(context.Background()))
+	err = errors.New("column users.status is missing")
+	assert.NoError(t, probe(context.Background()))
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"gorm.io/gorm"
+)
+
+// ReactivateSuspendedUsers reactivates users whose suspension has expired,
+// checking every interval until ctx is done.
+func ReactivateSuspendedUsers(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// suspensions expire across every organization
+			n, err := models.ReactivateExpiredSuspensions(db.WithContext(tenant.WithoutScope(ctx)), now)
+			if err != nil {
+				slog.ErrorContext(ctx, "Unable to reactivate suspended users", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "Reactivated suspended users", "count", n)
+			}
+		}
+	}
+}
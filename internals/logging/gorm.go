@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// gormLogger logs every statement at debug level with its duration, and
+// slow ones as warnings, with text values redacted. Failed statements are
+// logged with their error at the same levels; handlers decide whether a
+// failure is worth more.
+type gormLogger struct {
+	slow  time.Duration
+	level gormlogger.LogLevel
+}
+
+// NewGormLogger returns a GORM logger writing to slog, warning of statements
+// slower than slow.
+func NewGormLogger(slow time.Duration) gormlogger.Interface {
+	return &gormLogger{slow: slow, level: gormlogger.Info}
+}
+
+func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	logger := *l
+	logger.level = level
+	return &logger
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...any) {
+	if l.level >= gormlogger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	if l.level >= gormlogger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...any) {
+	if l.level >= gormlogger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	level := slog.LevelDebug
+	msg := "Ran query"
+	if elapsed > l.slow && l.level >= gormlogger.Warn {
+		level = slog.LevelWarn
+		msg = "Ran slow query"
+	}
+	// building the SQL is skipped when the line would be dropped
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter redacts the text values of logged SQL, as any of them may be
+// personal data. IDs, flags and times are kept.
+func (l *gormLogger) ParamsFilter(_ context.Context, sql string, params ...any) (string, []any) {
+	if policy.mode == "off" {
+		return sql, params
+	}
+
+	redacted := make([]any, len(params))
+	for i, param := range params {
+		if valuer, ok := param.(driver.Valuer); ok {
+			if v, err := valuer.Value(); err == nil {
+				param = v
+			}
+		}
+		switch v := param.(type) {
+		case string:
+			redacted[i] = policy.redact(v)
+		case []byte:
+			redacted[i] = policy.redact(string(v))
+		default:
+			redacted[i] = v
+		}
+	}
+
+	return sql, redacted
+}
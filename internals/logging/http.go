@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// probes are polled every few seconds, so they are only logged at debug
+// level unless they fail.
+var probes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// Middleware logs every request once it's handled, as a warning for client
+// errors and an error for server errors. It must come after
+// requestinfo.Middleware for the line to carry the request ID.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case probes[c.Request.URL.Path]:
+			level = slog.LevelDebug
+		}
+
+		// the path, not the query, which may hold personal data
+		slog.LogAttrs(c.Request.Context(), level, "Handled request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		)
+	}
+}
+
+// Recovery answers 500 to requests whose handler panicked, logging the panic
+// and its stack in place of gin's text output.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "Recovered from a panic handling the request",
+			"panic", fmt.Sprint(err),
+			"stack", string(debug.Stack()),
+		)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
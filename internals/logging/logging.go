@@ -0,0 +1,72 @@
+// Package logging writes structured logs with log/slog. Lines logged with a
+// request's context carry its request ID and trace, and personal data is
+// redacted by the configured policy.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// policy redacts the values of logged queries. It masks until Init runs.
+var policy redactor
+
+// Init makes a logger built from cfg the default of slog and of the log
+// package, writing to stderr.
+func Init(cfg config.Log) {
+	slog.SetDefault(New(os.Stderr, cfg))
+	policy = newRedactor(cfg.Redact, cfg.PIIFields)
+}
+
+// New returns a logger writing cfg.Format lines at cfg.Level and above to w.
+// Validate has checked cfg.
+func New(w io.Writer, cfg config.Log) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: newRedactor(cfg.Redact, cfg.PIIFields).replaceAttr,
+	}
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(contextHandler{handler})
+}
+
+// contextHandler adds the request ID and trace of the context a line is
+// logged with, so the lines of one request can be found together.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestinfo.RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
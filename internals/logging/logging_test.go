@@ -0,0 +1,259 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// capture makes a logger writing JSON lines to a buffer the default for the
+// test, and returns a func decoding the lines logged so far.
+func capture(t *testing.T, cfg config.Log) func() []map[string]any {
+	var buf bytes.Buffer
+	previous, previousPolicy := slog.Default(), policy
+	slog.SetDefault(New(&buf, cfg))
+	policy = newRedactor(cfg.Redact, cfg.PIIFields)
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		policy = previousPolicy
+	})
+
+	return func() []map[string]any {
+		var lines []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var fields map[string]any
+			if err := json.Unmarshal([]byte(line), &fields); err != nil {
+				t.Fatalf("Unable to decode log line %q %s", line, err.Error())
+			}
+			lines = append(lines, fields)
+		}
+		return lines
+	}
+}
+
+func logConfig(redact string) config.Log {
+	cfg := config.Default().Log
+	cfg.Level = "debug"
+	cfg.Redact = redact
+	return cfg
+}
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		name   string
+		redact string
+		want   map[string]any
+	}{
+		{
+			name:   "Mask",
+			redact: "mask",
+			want: map[string]any{
+				"msg":      "Invited j***@example.com",
+				"email":    "j***@example.com",
+				"fullname": "J***",
+				"error":    `duplicate key (email)=(j***@example.com)`,
+				"username": "jdoe",
+			},
+		},
+		{
+			name:   "Hash",
+			redact: "hash",
+			want: map[string]any{
+				"msg":      "Invited sha256:86e0b9e56c17",
+				"email":    "sha256:86e0b9e56c17",
+				"fullname": "sha256:01332c876518",
+				"error":    `duplicate key (email)=(sha256:86e0b9e56c17)`,
+				"username": "jdoe",
+			},
+		},
+		{
+			name:   "Off",
+			redact: "off",
+			want: map[string]any{
+				"msg":      "Invited jane.doe@example.com",
+				"email":    "jane.doe@example.com",
+				"fullname": "Jane Doe",
+				"error":    `duplicate key (email)=(jane.doe@example.com)`,
+				"username": "jdoe",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := capture(t, logConfig(test.redact))
+
+			slog.Info("Invited jane.doe@example.com",
+				"email", "jane.doe@example.com",
+				"fullname", "Jane Doe",
+				"error", errors.New("duplicate key (email)=(jane.doe@example.com)"),
+				"username", "jdoe",
+			)
+
+			logged := lines()
+			if assert.Len(t, logged, 1) {
+				for key, want := range test.want {
+					assert.Equal(t, want, logged[0][key], key)
+				}
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	lines := capture(t, logConfig("mask"))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(requestinfo.WithRequestID(context.Background(), "abc123"),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	slog.InfoContext(ctx, "In a request")
+	slog.Info("Outside a request")
+
+	logged := lines()
+	if assert.Len(t, logged, 2) {
+		assert.Equal(t, "abc123", logged[0]["request_id"])
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", logged[0]["trace_id"])
+		assert.Equal(t, "00f067aa0ba902b7", logged[0]["span_id"])
+		assert.NotContains(t, logged[1], "request_id")
+		assert.NotContains(t, logged[1], "trace_id")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	cfg := logConfig("mask")
+	cfg.Level = "info"
+	lines := capture(t, cfg)
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestinfo.Middleware(), Middleware(), Recovery())
+	r.GET("/api/users/:userID", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	r.GET("/healthz", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/7?email=jane.doe@example.com", nil)
+	req.Header.Set(requestinfo.RequestIDHeader, "abc123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "abc123", w.Header().Get(requestinfo.RequestIDHeader))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	logged := lines()
+	if assert.Len(t, logged, 3) {
+		assert.Equal(t, "WARN", logged[0]["level"])
+		assert.Equal(t, "Handled request", logged[0]["msg"])
+		assert.Equal(t, "/api/users/7", logged[0]["path"])
+		assert.Equal(t, "/api/users/:userID", logged[0]["route"])
+		assert.Equal(t, float64(http.StatusNotFound), logged[0]["status"])
+		assert.Equal(t, "abc123", logged[0]["request_id"])
+
+		assert.Equal(t, "Recovered from a panic handling the request", logged[1]["msg"])
+		assert.Equal(t, "boom", logged[1]["panic"])
+		assert.Equal(t, logged[1]["request_id"], logged[2]["request_id"])
+		assert.Equal(t, "ERROR", logged[2]["level"])
+		assert.Equal(t, float64(http.StatusInternalServerError), logged[2]["status"])
+	}
+}
+
+func TestGormLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		redact    string
+		slow      time.Duration
+		wantLevel string
+		wantMsg   string
+		wantSQL   string
+	}{
+		{
+			name:      "Text values masked",
+			redact:    "mask",
+			slow:      time.Minute,
+			wantLevel: "DEBUG",
+			wantMsg:   "Ran query",
+			wantSQL:   `SELECT * FROM "users" WHERE email = 'j***@example.com' AND "users"."id" = 7 ORDER BY "users"."id" LIMIT 1`,
+		},
+		{
+			name:      "Values kept with redaction off",
+			redact:    "off",
+			slow:      time.Minute,
+			wantLevel: "DEBUG",
+			wantMsg:   "Ran query",
+			wantSQL:   `SELECT * FROM "users" WHERE email = 'jane.doe@example.com' AND "users"."id" = 7 ORDER BY "users"."id" LIMIT 1`,
+		},
+		{
+			name:      "Slow",
+			redact:    "mask",
+			slow:      time.Nanosecond,
+			wantLevel: "WARN",
+			wantMsg:   "Ran slow query",
+			wantSQL:   `SELECT * FROM "users" WHERE email = 'j***@example.com' AND "users"."id" = 7 ORDER BY "users"."id" LIMIT 1`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := capture(t, logConfig(test.redact))
+
+			dbMock, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Unable to init mock db %s", err.Error())
+			}
+			defer dbMock.Close()
+			db, err := gorm.Open(postgres.New(postgres.Config{Conn: dbMock}), &gorm.Config{Logger: NewGormLogger(test.slow)})
+			if err != nil {
+				t.Fatalf("Failed to connect to db; gorm; %s", err.Error())
+			}
+
+			mock.ExpectQuery(`SELECT \* FROM "users"`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(7, "jane.doe@example.com"))
+
+			ctx := requestinfo.WithRequestID(context.Background(), "abc123")
+			var user models.Users
+			db.WithContext(ctx).Where("email = ?", "jane.doe@example.com").First(&user, 7)
+
+			logged := lines()
+			if assert.Len(t, logged, 1) {
+				assert.Equal(t, test.wantLevel, logged[0]["level"])
+				assert.Equal(t, test.wantMsg, logged[0]["msg"])
+				assert.Equal(t, test.wantSQL, logged[0]["sql"])
+				assert.Equal(t, float64(1), logged[0]["rows"])
+				assert.Contains(t, logged[0], "duration_ms")
+				assert.Equal(t, "abc123", logged[0]["request_id"])
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// emailPattern finds emails in messages and errors, e.g. a unique violation
+// quoting the duplicate.
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// redactor applies a redaction policy: "mask" keeps the first character and
+// an email's domain, "hash" replaces values with a short SHA-256 so the same
+// person can still be followed across lines, and "off" logs values as they
+// are.
+type redactor struct {
+	mode   string
+	fields map[string]bool
+}
+
+func newRedactor(mode string, fields []string) redactor {
+	r := redactor{mode: mode, fields: map[string]bool{}}
+	for _, field := range fields {
+		r.fields[strings.ToLower(field)] = true
+	}
+
+	return r
+}
+
+// replaceAttr redacts the attributes named as personal data entirely, and
+// the emails in every other string, error and message.
+func (r redactor) replaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if r.mode == "off" {
+		return a
+	}
+
+	if r.fields[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, r.redact(a.Value.String()))
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(r.scrub(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(r.scrub(err.Error()))
+		}
+	}
+
+	return a
+}
+
+func (r redactor) scrub(s string) string {
+	return emailPattern.ReplaceAllStringFunc(s, r.redact)
+}
+
+func (r redactor) redact(s string) string {
+	if s == "" {
+		return s
+	}
+
+	if r.mode == "hash" {
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:6])
+	}
+
+	// j***@example.com, J***
+	first, _ := utf8.DecodeRuneInString(s)
+	if at := strings.LastIndexByte(s, '@'); at > 0 {
+		return string(first) + "***" + s[at:]
+	}
+	return string(first) + "***"
+}
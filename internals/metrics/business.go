@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// scrapeTimeout bounds the business queries of one scrape.
+const scrapeTimeout = 5 * time.Second
+
+var (
+	usersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "users"),
+		"Users across every organization, by status.",
+		[]string{"status"}, nil,
+	)
+	organizationsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "organizations"),
+		"Organizations.",
+		nil, nil,
+	)
+)
+
+// businessCollector counts users and organizations when scraped, so the
+// gauges are never stale.
+type businessCollector struct {
+	db *gorm.DB
+}
+
+func newBusinessCollector(db *gorm.DB) *businessCollector {
+	return &businessCollector{db: db}
+}
+
+func (b *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usersDesc
+	ch <- organizationsDesc
+}
+
+func (b *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+	// the gauges span every tenant
+	db := b.db.WithContext(tenant.WithoutScope(ctx))
+
+	counts, err := models.CountUsersByStatus(db)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to count users for metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(usersDesc, err)
+	} else {
+		// every status is reported, so a status emptying drops to zero
+		// instead of vanishing
+		for _, status := range []string{models.StatusPending, models.StatusActive, models.StatusSuspended, models.StatusLocked, models.StatusDeactivated} {
+			ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(counts[status]), status)
+		}
+	}
+
+	orgs, err := models.CountOrganizations(db)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to count organizations for metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(organizationsDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(organizationsDesc, prometheus.GaugeValue, float64(orgs))
+}
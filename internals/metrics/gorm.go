@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/callbacks"
+	"gorm.io/gorm"
+)
+
+// startKey holds a statement's start time between the callbacks.
+const startKey = "metrics:start"
+
+// Plugin times every GORM statement by operation, from the first callback to
+// the last, so tenant scoping and hooks are included.
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "metrics"
+}
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	return callbacks.Around(db, "metrics", observe)
+}
+
+func observe(operation string) (before, after func(*gorm.DB)) {
+	before = func(db *gorm.DB) {
+		db.InstanceSet(startKey, time.Now())
+	}
+	after = func(db *gorm.DB) {
+		if start, ok := db.InstanceGet(startKey); ok {
+			queryDuration.WithLabelValues(operation).Observe(time.Since(start.(time.Time)).Seconds())
+		}
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			queryErrors.WithLabelValues(operation).Inc()
+		}
+	}
+
+	return before, after
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware counts and times every request by its route template, e.g.
+// /api/users/:userID, so IDs don't become labels. Requests matching no route
+// share the "unmatched" route.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
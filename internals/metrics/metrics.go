@@ -0,0 +1,84 @@
+// Package metrics exposes Prometheus metrics for the HTTP and database
+// layers. They are served from Registry on the admin port, away from the
+// public API.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "users_api"
+
+// Registry holds every metric of the process.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to handle HTTP requests, by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being handled.",
+	})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time to run GORM statements, by operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+
+	queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "GORM statements that failed, by operation. Records not found are not errors.",
+	}, []string{"operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		httpInFlight,
+		queryDuration,
+		queryErrors,
+	)
+}
+
+// Handler serves Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB adds the connection pool stats of db and the business gauges
+// read from it. Call it once, after the database is migrated.
+func RegisterDB(db *gorm.DB) error {
+	rawDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	if err := Registry.Register(collectors.NewDBStatsCollector(rawDB, "users")); err != nil {
+		return err
+	}
+
+	return Registry.Register(newBusinessCollector(db))
+}
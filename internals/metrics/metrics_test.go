@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func mockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unable to init mock db %s", err.Error())
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: dbMock}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to db; gorm; %s", err.Error())
+	}
+
+	return db, mock
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/api/users/:userID", func(c *gin.Context) {
+		assert.Equal(t, 1.0, testutil.ToFloat64(httpInFlight))
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, url := range []string{"/api/users/1", "/api/users/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/users/:userID", "204")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "unmatched", "404")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(httpInFlight))
+	assert.Equal(t, 2, testutil.CollectAndCount(httpDuration))
+}
+
+func TestPlugin(t *testing.T) {
+	db, mock := mockDB(t)
+	if err := db.Use(Plugin{}); err != nil {
+		t.Fatalf("Unable to register the plugin %s", err.Error())
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "organizations"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).AddRow(1, "Default", "default"))
+	mock.ExpectQuery(`SELECT \* FROM "organizations"`).WillReturnError(errors.New("connection reset"))
+	mock.ExpectQuery(`SELECT \* FROM "organizations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	models.GetOrganizations(db)
+	models.GetOrganizations(db)
+	models.GetOrganizationBySlug(db, "missing")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(queryErrors.WithLabelValues("query")))
+	var m dto.Metric
+	if err := queryDuration.WithLabelValues("query").(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatalf("Unable to read the histogram %s", err.Error())
+	}
+	assert.Equal(t, uint64(3), m.GetHistogram().GetSampleCount())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBusinessCollector(t *testing.T) {
+	db, mock := mockDB(t)
+
+	mock.ExpectQuery(`SELECT status, count\(\*\) AS count FROM "users" GROUP BY "status"`).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).AddRow("active", 7).AddRow("locked", 2))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "organizations"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	want := `
+# HELP users_api_organizations Organizations.
+# TYPE users_api_organizations gauge
+users_api_organizations 3
+# HELP users_api_users Users across every organization, by status.
+# TYPE users_api_users gauge
+users_api_users{status="active"} 7
+users_api_users{status="deactivated"} 0
+users_api_users{status="locked"} 2
+users_api_users{status="pending"} 0
+users_api_users{status="suspended"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(newBusinessCollector(db), strings.NewReader(want)))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,303 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+)
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// AttributeDefinitions are the admin-defined custom profile fields of an
+// organization.
+type AttributeDefinitions struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint       `json:"-" gorm:"not null;uniqueIndex:idx_attribute_definitions_org_name,priority:1"`
+	Name           string     `json:"name" gorm:"not null;uniqueIndex:idx_attribute_definitions_org_name,priority:2"`
+	Type           string     `json:"type" gorm:"not null"`
+	Required       bool       `json:"required"`
+	Pattern        string     `json:"pattern,omitempty"`
+	EnumValues     StringList `json:"enum_values,omitempty"`
+}
+
+// Attributes holds a user's custom profile fields, stored as JSONB on
+// Postgres and JSON elsewhere.
+type Attributes map[string]any
+
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(a)
+	return string(b), err
+}
+
+func (a *Attributes) Scan(src any) error {
+	return scanJSON(src, a)
+}
+
+func (Attributes) GormDataType() string {
+	return "json"
+}
+
+func (Attributes) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
+
+// StringList is a list of strings stored as a JSON array.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(l)
+	return string(b), err
+}
+
+func (l *StringList) Scan(src any) error {
+	return scanJSON(src, l)
+}
+
+func (StringList) GormDataType() string {
+	return "json"
+}
+
+func (StringList) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
+
+func jsonDataType(db *gorm.DB) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "JSONB"
+	default:
+		return "JSON"
+	}
+}
+
+func scanJSON(src any, dst any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("cannot scan %T into JSON", src)
+	}
+}
+
+// AttributeError describes why a user's custom attributes were rejected.
+type AttributeError struct {
+	Name   string
+	Reason string
+}
+
+func (e *AttributeError) Error() string {
+	return fmt.Sprintf("attribute %q %s", e.Name, e.Reason)
+}
+
+// Validate checks that a definition is itself usable.
+func (d AttributeDefinitions) Validate() error {
+	if !attributeNamePattern.MatchString(d.Name) {
+		return errors.New("name must be lowercase letters, digits and underscores, starting with a letter")
+	}
+
+	switch d.Type {
+	case AttributeString:
+		if d.Pattern != "" {
+			if _, err := regexp.Compile(d.Pattern); err != nil {
+				return fmt.Errorf("pattern not valid: %w", err)
+			}
+		}
+	case AttributeEnum:
+		if len(d.EnumValues) == 0 {
+			return errors.New("enum attributes need at least one value")
+		}
+	case AttributeNumber, AttributeBoolean:
+	default:
+		return fmt.Errorf("type must be one of %s, %s, %s or %s", AttributeString, AttributeNumber, AttributeBoolean, AttributeEnum)
+	}
+
+	return nil
+}
+
+// ValidateAttributes checks attrs against the organization's definitions:
+// unknown names, wrong types, pattern and enum mismatches and missing
+// required attributes are all rejected.
+func ValidateAttributes(defs []AttributeDefinitions, attrs Attributes) error {
+	byName := make(map[string]AttributeDefinitions, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+
+	for name, value := range attrs {
+		def, ok := byName[name]
+		if !ok {
+			return &AttributeError{Name: name, Reason: "is not defined"}
+		}
+		if err := validateAttribute(def, value); err != nil {
+			return err
+		}
+	}
+
+	for _, def := range defs {
+		if _, ok := attrs[def.Name]; def.Required && !ok {
+			return &AttributeError{Name: def.Name, Reason: "is required"}
+		}
+	}
+
+	return nil
+}
+
+func validateAttribute(def AttributeDefinitions, value any) error {
+	switch def.Type {
+	case AttributeString:
+		s, ok := value.(string)
+		if !ok {
+			return &AttributeError{Name: def.Name, Reason: "must be a string"}
+		}
+		if def.Pattern != "" && !regexp.MustCompile(def.Pattern).MatchString(s) {
+			return &AttributeError{Name: def.Name, Reason: "does not match " + def.Pattern}
+		}
+	case AttributeNumber:
+		if _, ok := value.(float64); !ok {
+			return &AttributeError{Name: def.Name, Reason: "must be a number"}
+		}
+	case AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return &AttributeError{Name: def.Name, Reason: "must be a boolean"}
+		}
+	case AttributeEnum:
+		s, ok := value.(string)
+		if !ok || !slices.Contains(def.EnumValues, s) {
+			return &AttributeError{Name: def.Name, Reason: "must be one of the defined values"}
+		}
+	}
+
+	return nil
+}
+
+// attributeFilter returns a condition matching users whose attribute name
+// equals value, compared as JSON so numbers and booleans match by type. name
+// must already be a validated attribute name.
+func attributeFilter(db *gorm.DB, name string, value any) (string, []any, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "users.attributes -> ? = ?::jsonb", []any{name, string(raw)}, nil
+	case "mysql":
+		return "JSON_EXTRACT(users.attributes, ?) = CAST(? AS JSON)", []any{"$." + name, string(raw)}, nil
+	default:
+		return "json_extract(users.attributes, ?) = json_extract(?, '$')", []any{"$." + name, string(raw)}, nil
+	}
+}
+
+// ParseAttributeValue converts a query string value to the type of def.
+func ParseAttributeValue(def AttributeDefinitions, value string) (any, error) {
+	switch def.Type {
+	case AttributeNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, &AttributeError{Name: def.Name, Reason: "must be a number"}
+		}
+		return n, nil
+	case AttributeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, &AttributeError{Name: def.Name, Reason: "must be a boolean"}
+		}
+		return b, nil
+	default:
+		return value, nil
+	}
+}
+
+// ParseAttributeFilters types raw filter values, keyed by attribute name,
+// with ParseAttributeValue. Every name must be defined.
+func ParseAttributeFilters(defs []AttributeDefinitions, raw map[string]string) (map[string]any, error) {
+	byName := make(map[string]AttributeDefinitions, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+
+	filters := make(map[string]any, len(raw))
+	for name, value := range raw {
+		def, ok := byName[name]
+		if !ok {
+			return nil, &AttributeError{Name: name, Reason: "is not defined"}
+		}
+
+		typed, err := ParseAttributeValue(def, value)
+		if err != nil {
+			return nil, err
+		}
+		filters[name] = typed
+	}
+
+	return filters, nil
+}
+
+// CreateAttributeDefinition inserts def and records it in the audit log.
+func CreateAttributeDefinition(db *gorm.DB, def *AttributeDefinitions) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(def).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, def.OrganizationID, AuditEvent{
+			Action:     AuditAttributeCreated,
+			TargetType: "attribute",
+			TargetID:   def.Name,
+		})
+	})
+}
+
+func GetAttributeDefinitions(db *gorm.DB) ([]AttributeDefinitions, error) {
+	var defs []AttributeDefinitions
+	if err := db.Order("name").Find(&defs).Error; err != nil {
+		return nil, err
+	}
+
+	return defs, nil
+}
+
+// DeleteAttributeDefinition deletes the named definition and records it in
+// the audit log.
+func DeleteAttributeDefinition(db *gorm.DB, name string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var def AttributeDefinitions
+		if err := tx.Where("name = ?", name).First(&def).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&def).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, def.OrganizationID, AuditEvent{
+			Action:     AuditAttributeDeleted,
+			TargetType: "attribute",
+			TargetID:   def.Name,
+		})
+	})
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAttributes(t *testing.T) {
+	defs := []AttributeDefinitions{
+		{Name: "department", Type: AttributeString, Required: true},
+		{Name: "phone", Type: AttributeString, Pattern: `^\+[0-9]{7,15}$`},
+		{Name: "cost_center", Type: AttributeNumber},
+		{Name: "contractor", Type: AttributeBoolean},
+		{Name: "level", Type: AttributeEnum, EnumValues: StringList{"junior", "senior"}},
+	}
+
+	tests := []struct {
+		name  string
+		attrs Attributes
+		err   string
+	}{
+		{"all valid", Attributes{"department": "eng", "phone": "+2348012345678", "cost_center": 42.0, "contractor": false, "level": "senior"}, ""},
+		{"only required", Attributes{"department": "eng"}, ""},
+		{"missing required", Attributes{"phone": "+2348012345678"}, `attribute "department" is required`},
+		{"undefined", Attributes{"department": "eng", "shoe_size": 42.0}, `attribute "shoe_size" is not defined`},
+		{"wrong type", Attributes{"department": 1.0}, `attribute "department" must be a string`},
+		{"pattern mismatch", Attributes{"department": "eng", "phone": "12"}, `attribute "phone" does not match ^\+[0-9]{7,15}$`},
+		{"not a number", Attributes{"department": "eng", "cost_center": "42"}, `attribute "cost_center" must be a number`},
+		{"not a boolean", Attributes{"department": "eng", "contractor": "no"}, `attribute "contractor" must be a boolean`},
+		{"not in enum", Attributes{"department": "eng", "level": "staff"}, `attribute "level" must be one of the defined values`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateAttributes(defs, test.attrs)
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
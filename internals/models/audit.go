@@ -0,0 +1,173 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"maps"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Security-relevant actions recorded in the audit log.
+const (
+	AuditUserDeleted         = "user.deleted"
+	AuditUserStatusChanged   = "user.status_changed"
+	AuditUsersExported       = "users.exported"
+	AuditOrganizationCreated = "organization.created"
+	AuditAttributeCreated    = "attribute.created"
+	AuditAttributeDeleted    = "attribute.deleted"
+)
+
+// ErrAuditAppendOnly is returned by any attempt to change or remove an audit
+// entry.
+var ErrAuditAppendOnly = errors.New("audit: entries are append-only")
+
+// AuditEntries is the append-only security log, written in the same
+// transaction as the change it records. Each organization has its own chain
+// (organization 0 holds events outside any organization): Seq counts up from
+// 1 without gaps and Hash covers the entry together with the previous
+// entry's hash, so changing, removing or reordering entries breaks the chain.
+// Actor is who the API verified; an actor the caller only claimed is kept in
+// Details as claimed_actor.
+type AuditEntries struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint       `json:"-" gorm:"not null;uniqueIndex:idx_audit_entries_org_seq,priority:1"`
+	Seq            uint64     `json:"seq" gorm:"not null;uniqueIndex:idx_audit_entries_org_seq,priority:2"`
+	Actor          string     `json:"actor" gorm:"not null;index"`
+	Action         string     `json:"action" gorm:"not null;index"`
+	TargetType     string     `json:"target_type,omitempty"`
+	TargetID       string     `json:"target_id,omitempty"`
+	Details        Attributes `json:"details,omitempty"`
+	RequestID      string     `json:"request_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"not null;index;precision:6"`
+	PrevHash       string     `json:"prev_hash"`
+	Hash           string     `json:"hash" gorm:"not null"`
+}
+
+func (AuditEntries) TableName() string {
+	return "audit_entries"
+}
+
+func (AuditEntries) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (AuditEntries) BeforeDelete(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+// ChainHash is the SHA-256 over the previous hash and the entry's content.
+func (e AuditEntries) ChainHash() (string, error) {
+	content, err := json.Marshal(struct {
+		OrganizationID uint       `json:"organization_id"`
+		Seq            uint64     `json:"seq"`
+		Actor          string     `json:"actor"`
+		Action         string     `json:"action"`
+		TargetType     string     `json:"target_type"`
+		TargetID       string     `json:"target_id"`
+		Details        Attributes `json:"details"`
+		RequestID      string     `json:"request_id"`
+		CreatedAt      string     `json:"created_at"`
+	}{
+		e.OrganizationID, e.Seq, e.Actor, e.Action, e.TargetType, e.TargetID,
+		e.Details, e.RequestID, e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(e.PrevHash), content...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditChains hold the last entry of each organization's audit chain. The
+// row is locked while an entry is appended, so transactions appending to the
+// same chain take turns instead of racing for the next Seq.
+type AuditChains struct {
+	OrganizationID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Seq            uint64 `gorm:"not null"`
+	Hash           string `gorm:"not null"`
+}
+
+// AuditEvent is what changes record; the chain fields are filled in by
+// recordAudit.
+type AuditEvent struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Details    Attributes
+}
+
+// recordAudit appends event to the chain of the organization, with the actor
+// and request ID of tx's context, as part of tx.
+func recordAudit(tx *gorm.DB, orgID uint, event AuditEvent) error {
+	chain, err := lockAuditChain(tx, orgID)
+	if err != nil {
+		return err
+	}
+
+	ctx := tx.Statement.Context
+	actor := requestinfo.VerifiedActor(ctx)
+	details := event.Details
+	if claimed := requestinfo.ClaimedActor(ctx); claimed != "" && claimed != actor {
+		details = maps.Clone(details)
+		if details == nil {
+			details = Attributes{}
+		}
+		details["claimed_actor"] = claimed
+	}
+
+	entry := AuditEntries{
+		OrganizationID: orgID,
+		Seq:            chain.Seq + 1,
+		Actor:          actor,
+		Action:         event.Action,
+		TargetType:     event.TargetType,
+		TargetID:       event.TargetID,
+		Details:        details,
+		RequestID:      requestinfo.RequestID(ctx),
+		// the column keeps microseconds (MySQL would default to
+		// milliseconds); truncate so the hash can be recomputed from what
+		// is read back
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		PrevHash:  chain.Hash,
+	}
+	entry.Hash, err = entry.ChainHash()
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&AuditChains{}).Where("organization_id = ?", orgID).
+		Updates(map[string]any{"seq": entry.Seq, "hash": entry.Hash}).Error
+}
+
+// lockAuditChain returns the organization's chain, starting it at its last
+// entry if it is not tracked yet, locked for the rest of tx.
+func lockAuditChain(tx *gorm.DB, orgID uint) (*AuditChains, error) {
+	var last AuditEntries
+	err := tx.Where("organization_id = ?", orgID).Order("seq DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&AuditChains{OrganizationID: orgID, Seq: last.Seq, Hash: last.Hash}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var chain AuditChains
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("organization_id = ?", orgID).First(&chain).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &chain, nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func TestAuditIsPartOfTheChange(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Unable to open sqlite %s", err.Error())
+	}
+	err = db.AutoMigrate(&Organizations{}, &Users{}, &UserChanges{}, &Events{}, &AttributeDefinitions{}, &AuditEntries{}, &AuditChains{})
+	if err != nil {
+		t.Fatalf("Unable to migrate %s", err.Error())
+	}
+
+	ctx := requestinfo.WithRequestID(context.Background(), "req-1")
+	ctx = requestinfo.WithVerifiedActor(requestinfo.WithActor(ctx, "mallory"), "alice")
+	db = db.WithContext(ctx)
+
+	user := Users{OrganizationID: 1, Username: "obi", Email: "obi@example.com"}
+	assert.NoError(t, CreateUser(db, &user))
+	assert.NoError(t, DeleteUserByID(db, user.ID))
+
+	def := AttributeDefinitions{OrganizationID: 1, Name: "team", Type: AttributeString}
+	assert.NoError(t, CreateAttributeDefinition(db, &def))
+	// a failed change records nothing
+	def = AttributeDefinitions{OrganizationID: 1, Name: "team", Type: AttributeString}
+	assert.Error(t, CreateAttributeDefinition(db, &def))
+
+	var entries []AuditEntries
+	assert.NoError(t, db.Order("seq").Find(&entries).Error)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, AuditUserDeleted, entries[0].Action)
+		assert.Equal(t, "alice", entries[0].Actor)
+		assert.Equal(t, "req-1", entries[0].RequestID)
+		assert.Equal(t, Attributes{"username": "obi", "claimed_actor": "mallory"}, entries[0].Details)
+		assert.Equal(t, AuditAttributeCreated, entries[1].Action)
+
+		for i, entry := range entries {
+			assert.Equal(t, uint64(i+1), entry.Seq)
+			hash, err := entry.ChainHash()
+			assert.NoError(t, err)
+			assert.Equal(t, hash, entry.Hash)
+		}
+		assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	}
+
+	var chain AuditChains
+	assert.NoError(t, db.Where("organization_id = ?", 1).First(&chain).Error)
+	assert.Equal(t, AuditChains{OrganizationID: 1, Seq: 2, Hash: entries[1].Hash}, chain)
+
+	// organizations have a chain of their own
+	assert.NoError(t, CreateOrganization(db, &Organizations{Name: "Acme", Slug: "acme"}))
+	var created AuditEntries
+	assert.NoError(t, db.Where("organization_id = ?", 0).First(&created).Error)
+	assert.Equal(t, uint64(1), created.Seq)
+	assert.Equal(t, "acme", created.TargetID)
+}
+
+func TestAuditEntryHashSurvivesReadBack(t *testing.T) {
+	// MySQL keeps only milliseconds unless the column asks for more
+	s, err := schema.Parse(&AuditEntries{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("Unable to parse schema %s", err.Error())
+	}
+	assert.Equal(t, 6, s.LookUpField("CreatedAt").Precision)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Unable to open sqlite %s", err.Error())
+	}
+	if err := db.AutoMigrate(&AuditEntries{}, &AuditChains{}); err != nil {
+		t.Fatalf("Unable to migrate %s", err.Error())
+	}
+
+	ctx := requestinfo.WithVerifiedActor(context.Background(), "alice")
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return recordAudit(tx, 1, AuditEvent{Action: AuditUserDeleted, TargetType: "user", TargetID: "7"})
+	})
+	assert.NoError(t, err)
+
+	var entry AuditEntries
+	assert.NoError(t, db.First(&entry).Error)
+	hash, err := entry.ChainHash()
+	assert.NoError(t, err)
+	assert.Equal(t, entry.Hash, hash)
+}
+
+func TestExportUsersIsAudited(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Unable to open sqlite %s", err.Error())
+	}
+	err = db.AutoMigrate(&Users{}, &UserChanges{}, &Events{}, &AuditEntries{}, &AuditChains{})
+	if err != nil {
+		t.Fatalf("Unable to migrate %s", err.Error())
+	}
+	db = db.WithContext(requestinfo.WithVerifiedActor(context.Background(), "alice"))
+
+	assert.NoError(t, CreateUser(db, &Users{OrganizationID: 1, Username: "obi", Email: "obi@example.com"}))
+	assert.NoError(t, CreateUser(db, &Users{OrganizationID: 1, Username: "ada", Email: "ada@example.com", Status: StatusSuspended}))
+
+	users, err := ExportUsers(db, 1, UserFilter{Status: StatusActive})
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	var entry AuditEntries
+	assert.NoError(t, db.Where("action = ?", AuditUsersExported).First(&entry).Error)
+	assert.Equal(t, "alice", entry.Actor)
+	assert.Equal(t, "1", entry.TargetID)
+	assert.Equal(t, Attributes{"count": float64(1), "status": StatusActive}, entry.Details)
+}
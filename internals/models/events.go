@@ -0,0 +1,225 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+)
+
+// EventTypes lists every event type, in a stable order.
+var EventTypes = []string{EventUserCreated, EventUserUpdated, EventUserDeleted}
+
+var changeEvents = map[string]string{
+	ChangeCreated: EventUserCreated,
+	ChangeUpdated: EventUserUpdated,
+	ChangeDeleted: EventUserDeleted,
+}
+
+// Events is the transactional outbox: every user change appends an event in
+// the same transaction as the change itself, so an event exists exactly when
+// the change was committed. IDs are allocated when events are written but
+// only become visible on commit, so a lower ID may appear after a higher
+// one. Consumers track how far they got with an EventCursors row: the
+// webhook dispatcher and the broker relay each have one.
+type Events struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint       `json:"-" gorm:"index;not null"`
+	Type           string     `json:"type" gorm:"not null;index"`
+	UserID         uint       `json:"user_id" gorm:"not null"`
+	Data           Attributes `json:"data"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// EventSettleWindow is how long a transaction holding an event ID is given to
+// commit. Consumers keep looking for IDs they skipped for this long, then
+// assume they were rolled back.
+var EventSettleWindow = 5 * time.Minute
+
+// maxEventGap bounds the IDs before a newly seen event that may still be in
+// flight, far more than there are connections to hold them.
+const maxEventGap = 1000
+
+// EventCursors records the events each consumer has processed: every one up
+// to LastEventID, except the Gaps, IDs skipped as they weren't visible yet.
+type EventCursors struct {
+	Consumer    string `gorm:"primaryKey"`
+	LastEventID uint   `gorm:"not null"`
+	Gaps        EventGaps
+}
+
+// EventGaps maps skipped event IDs to when they were first skipped, stored as
+// JSON.
+type EventGaps map[uint]time.Time
+
+func (g EventGaps) Value() (driver.Value, error) {
+	if g == nil {
+		g = EventGaps{}
+	}
+	b, err := json.Marshal(g)
+	return string(b), err
+}
+
+func (g *EventGaps) Scan(src any) error {
+	return scanJSON(src, g)
+}
+
+func (EventGaps) GormDataType() string {
+	return "json"
+}
+
+func (EventGaps) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
+
+// Advance moves the cursor past ids, which were read after it in order, at
+// now. IDs it jumps over become gaps, up to maxEventGap of them, and gaps
+// older than EventSettleWindow are given up on.
+func (c *EventCursors) Advance(ids []uint, now time.Time) {
+	if c.Gaps == nil {
+		c.Gaps = EventGaps{}
+	}
+
+	for _, id := range ids {
+		if _, ok := c.Gaps[id]; ok {
+			delete(c.Gaps, id)
+			continue
+		}
+		for skipped := max(c.LastEventID+1, id-min(id, maxEventGap)); skipped < id; skipped++ {
+			c.Gaps[skipped] = now
+		}
+		if id > c.LastEventID {
+			c.LastEventID = id
+		}
+	}
+
+	for id, skipped := range c.Gaps {
+		if now.Sub(skipped) > EventSettleWindow {
+			delete(c.Gaps, id)
+		}
+	}
+}
+
+// pending limits db to the events the cursor hasn't processed: newer ones and
+// its gaps.
+func (c *EventCursors) pending(db *gorm.DB) *gorm.DB {
+	if len(c.Gaps) == 0 {
+		return db.Where("id > ?", c.LastEventID)
+	}
+
+	gaps := make([]uint, 0, len(c.Gaps))
+	for id := range c.Gaps {
+		gaps = append(gaps, id)
+	}
+	return db.Where("id > ? OR id IN ?", c.LastEventID, gaps)
+}
+
+// appendEvent adds the event for a recorded user change to the outbox.
+func appendEvent(tx *gorm.DB, change *UserChanges) error {
+	event := changeEvent(change)
+	return tx.Create(&event).Error
+}
+
+// changeEvent returns the outbox event for a recorded user change.
+func changeEvent(change *UserChanges) Events {
+	return Events{
+		OrganizationID: change.OrganizationID,
+		Type:           changeEvents[change.Action],
+		UserID:         change.UserID,
+		Data: Attributes{
+			"user":       change.Snapshot,
+			"changes":    change.Diff,
+			"actor":      change.Actor,
+			"request_id": change.RequestID,
+		},
+	}
+}
+
+// GetPendingEvents returns up to limit events cursor hasn't processed, by ID.
+func GetPendingEvents(db *gorm.DB, cursor *EventCursors, limit int) ([]Events, error) {
+	var events []Events
+	if err := db.Scopes(cursor.pending).Order("id").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetPendingEventIDs is GetPendingEvents for IDs only, e.g. to advance a cursor
+// over events of every organization while reading those of one.
+func GetPendingEventIDs(db *gorm.DB, cursor *EventCursors, limit int) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&Events{}).Scopes(cursor.pending).Order("id").Limit(limit).Pluck("id", &ids).Error
+
+	return ids, err
+}
+
+// EventIDs returns the IDs of events, e.g. to advance a cursor past them.
+func EventIDs(events []Events) []uint {
+	ids := make([]uint, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+
+	return ids
+}
+
+// GetEventsByID returns the events with the given IDs, by ID.
+func GetEventsByID(db *gorm.DB, ids []uint) ([]Events, error) {
+	var events []Events
+	if len(ids) == 0 {
+		return events, nil
+	}
+	if err := db.Where("id IN ?", ids).Order("id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetLastEventID returns the ID of the newest event, or 0 if there are none.
+func GetLastEventID(db *gorm.DB) (uint, error) {
+	var last uint
+	err := db.Model(&Events{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error
+
+	return last, err
+}
+
+// LockEventCursor returns the consumer's cursor, creating it at the current
+// end of the outbox if it does not exist, locked for the rest of tx so only
+// one instance advances it at a time.
+func LockEventCursor(tx *gorm.DB, consumer string) (*EventCursors, error) {
+	last, err := GetLastEventID(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&EventCursors{Consumer: consumer, LastEventID: last, Gaps: EventGaps{}}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor EventCursors
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("consumer = ?", consumer).First(&cursor).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
+// SaveEventCursor stores how far the consumer got, once it has processed the
+// events read with it.
+func SaveEventCursor(tx *gorm.DB, cursor *EventCursors) error {
+	return tx.Model(&EventCursors{}).Where("consumer = ?", cursor.Consumer).
+		Updates(map[string]any{"last_event_id": cursor.LastEventID, "gaps": cursor.Gaps}).Error
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventCursorAdvance(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cursor := EventCursors{LastEventID: 10}
+
+	// 11 and 13 aren't visible yet
+	cursor.Advance([]uint{12, 14}, now)
+	assert.Equal(t, uint(14), cursor.LastEventID)
+	assert.Equal(t, EventGaps{11: now, 13: now}, cursor.Gaps)
+
+	// 13 commits late
+	cursor.Advance([]uint{13, 15}, now.Add(time.Minute))
+	assert.Equal(t, uint(15), cursor.LastEventID)
+	assert.Equal(t, EventGaps{11: now}, cursor.Gaps)
+
+	// 11 was rolled back
+	cursor.Advance(nil, now.Add(EventSettleWindow+time.Second))
+	assert.Empty(t, cursor.Gaps)
+
+	// far jumps, e.g. resuming an old stream, only look back so far
+	cursor.Advance([]uint{5000}, now)
+	assert.Equal(t, uint(5000), cursor.LastEventID)
+	assert.Len(t, cursor.Gaps, maxEventGap)
+	assert.Contains(t, cursor.Gaps, uint(4000))
+	assert.NotContains(t, cursor.Gaps, uint(3999))
+}
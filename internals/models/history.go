@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"gorm.io/gorm"
+)
+
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// UserChanges is the history of a user: one row per create, update or
+// delete, with what changed, the full record afterwards (nil once deleted),
+// and who made the change in which request.
+type UserChanges struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint       `json:"-" gorm:"index;not null"`
+	UserID         uint       `json:"user_id" gorm:"not null;index:idx_user_changes_user_created,priority:1"`
+	Action         string     `json:"action" gorm:"not null"`
+	Diff           Attributes `json:"diff"`
+	Snapshot       Attributes `json:"snapshot"`
+	Actor          string     `json:"actor" gorm:"not null"`
+	RequestID      string     `json:"request_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"index:idx_user_changes_user_created,priority:2"`
+}
+
+// FieldChange is one entry of UserChanges.Diff.
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// recordUserChange stores the change from before to after, either of which
+// is nil for creates and deletes, and publishes it to the event outbox.
+// Updates that change nothing visible are not recorded.
+func recordUserChange(tx *gorm.DB, action string, before, after *Users) error {
+	change, err := newUserChange(tx.Statement.Context, action, before, after)
+	if err != nil || change == nil {
+		return err
+	}
+	if err := tx.Create(change).Error; err != nil {
+		return err
+	}
+
+	return appendEvent(tx, change)
+}
+
+// newUserChange describes the change from before to after, made by the
+// actor of ctx. It returns nil for updates that change nothing visible.
+func newUserChange(ctx context.Context, action string, before, after *Users) (*UserChanges, error) {
+	from, err := userSnapshot(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := userSnapshot(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffSnapshots(from, to)
+	if action == ChangeUpdated && len(diff) == 0 {
+		return nil, nil
+	}
+
+	user := after
+	if user == nil {
+		user = before
+	}
+
+	return &UserChanges{
+		OrganizationID: user.OrganizationID,
+		UserID:         user.ID,
+		Action:         action,
+		Diff:           diff,
+		Snapshot:       to,
+		Actor:          requestinfo.Actor(ctx),
+		RequestID:      requestinfo.RequestID(ctx),
+	}, nil
+}
+
+// diffSnapshots returns a FieldChange for every field that differs between
+// the two snapshots.
+func diffSnapshots(from, to Attributes) Attributes {
+	diff := Attributes{}
+	for key, value := range to {
+		if old, ok := from[key]; !ok || !reflect.DeepEqual(old, value) {
+			diff[key] = FieldChange{From: from[key], To: value}
+		}
+	}
+	for key, old := range from {
+		if _, ok := to[key]; !ok {
+			diff[key] = FieldChange{From: old, To: nil}
+		}
+	}
+
+	return diff
+}
+
+// userSnapshot is the user as the API shows it, decoded into a generic map
+// so snapshots survive later changes to the Users struct.
+func userSnapshot(user *Users) (Attributes, error) {
+	if user == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Attributes
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func GetUserChanges(db *gorm.DB, userID uint) ([]UserChanges, error) {
+	var changes []UserChanges
+	if err := db.Where("user_id = ?", userID).Order("created_at, id").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// GetUserAsOf reconstructs the user as it was at the given time from its
+// history. It returns gorm.ErrRecordNotFound if the user did not exist then.
+func GetUserAsOf(db *gorm.DB, userID uint, at time.Time) (Attributes, error) {
+	var change UserChanges
+	err := db.Where("user_id = ? AND created_at <= ?", userID, at).
+		Order("created_at DESC, id DESC").
+		First(&change).Error
+	if err != nil {
+		return nil, err
+	}
+	if change.Action == ChangeDeleted {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return change.Snapshot, nil
+}
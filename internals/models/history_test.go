@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	before, err := userSnapshot(&Users{ID: 1, Username: "obi", Email: "obi@example.com", Status: StatusActive})
+	assert.NoError(t, err)
+	after, err := userSnapshot(&Users{ID: 1, Username: "obi", Email: "obi@new.example.com", Fullname: "Obi Madu", Status: StatusActive})
+	assert.NoError(t, err)
+
+	assert.Equal(t, Attributes{
+		"email":    FieldChange{From: "obi@example.com", To: "obi@new.example.com"},
+		"fullname": FieldChange{From: nil, To: "Obi Madu"},
+	}, diffSnapshots(before, after))
+
+	assert.Empty(t, diffSnapshots(before, before))
+
+	deleted := diffSnapshots(before, nil)
+	assert.Equal(t, FieldChange{From: "obi", To: nil}, deleted["username"])
+	assert.Len(t, deleted, len(before))
+}
@@ -0,0 +1,54 @@
+package models
+
+import "gorm.io/gorm"
+
+// DefaultOrganizationSlug is the tenant rows created before organizations
+// existed are assigned to.
+const DefaultOrganizationSlug = "default"
+
+type Organizations struct {
+	ID   uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name string `json:"name" gorm:"not null"`
+	Slug string `json:"slug" gorm:"unique;not null"`
+}
+
+// CreateOrganization inserts org and records it in the audit log outside any
+// organization, so db must not be scoped to one.
+func CreateOrganization(db *gorm.DB, org *Organizations) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, 0, AuditEvent{
+			Action:     AuditOrganizationCreated,
+			TargetType: "organization",
+			TargetID:   org.Slug,
+		})
+	})
+}
+
+func GetOrganizations(db *gorm.DB) ([]Organizations, error) {
+	var orgs []Organizations
+	if err := db.Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func GetOrganizationBySlug(db *gorm.DB, slug string) (*Organizations, error) {
+	var org Organizations
+	if err := db.Where("slug = ?", slug).First(&org).Error; err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+func CountOrganizations(db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Model(&Organizations{}).Count(&count).Error
+
+	return count, err
+}
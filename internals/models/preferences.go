@@ -0,0 +1,199 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PreferenceSpec describes one preference key: its type, constraints and the
+// value users get until they set their own.
+type PreferenceSpec struct {
+	Type       string     `json:"type"`
+	Default    any        `json:"default"`
+	Pattern    string     `json:"pattern,omitempty"`
+	EnumValues StringList `json:"enum_values,omitempty"`
+
+	// Check runs after the type checks for constraints a pattern cannot
+	// express.
+	Check func(value any) error `json:"-"`
+}
+
+// PreferenceNamespaces is the server-side schema of every preference users
+// can set, by namespace and key.
+var PreferenceNamespaces = map[string]map[string]PreferenceSpec{
+	"locale": {
+		"language": {Type: AttributeString, Default: "en", Pattern: `^[a-z]{2,3}(-[A-Z]{2})?$`},
+		"timezone": {Type: AttributeString, Default: "UTC", Check: checkTimezone},
+		"date_format": {
+			Type:       AttributeEnum,
+			Default:    "YYYY-MM-DD",
+			EnumValues: StringList{"YYYY-MM-DD", "DD/MM/YYYY", "MM/DD/YYYY"},
+		},
+	},
+	"notifications": {
+		"email": {Type: AttributeBoolean, Default: true},
+		"sms":   {Type: AttributeBoolean, Default: false},
+		"digest": {
+			Type:       AttributeEnum,
+			Default:    "weekly",
+			EnumValues: StringList{"never", "daily", "weekly"},
+		},
+	},
+	"display": {
+		"theme": {
+			Type:       AttributeEnum,
+			Default:    "system",
+			EnumValues: StringList{"system", "light", "dark"},
+		},
+		"page_size": {Type: AttributeNumber, Default: 20.0, Check: checkPageSize},
+	},
+}
+
+// ErrUnknownNamespace is returned for preference namespaces that are not in
+// PreferenceNamespaces.
+var ErrUnknownNamespace = errors.New("unknown preference namespace")
+
+// UserPreferences holds the values a user has set in one namespace; unset
+// keys fall back to their PreferenceSpec default.
+type UserPreferences struct {
+	ID             uint       `json:"-" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint       `json:"-" gorm:"index;not null"`
+	UserID         uint       `json:"-" gorm:"not null;uniqueIndex:idx_user_preferences_user_namespace,priority:1"`
+	Namespace      string     `json:"-" gorm:"not null;uniqueIndex:idx_user_preferences_user_namespace,priority:2"`
+	Settings       Attributes `json:"settings"`
+	UpdatedAt      time.Time  `json:"-"`
+}
+
+func checkTimezone(value any) error {
+	if _, err := time.LoadLocation(value.(string)); err != nil {
+		return errors.New("is not a known time zone")
+	}
+
+	return nil
+}
+
+func checkPageSize(value any) error {
+	if n := value.(float64); n < 1 || n > 100 || n != float64(int(n)) {
+		return errors.New("must be a whole number from 1 to 100")
+	}
+
+	return nil
+}
+
+// PreferenceNamespaceNames returns the namespaces in a stable order.
+func PreferenceNamespaceNames() []string {
+	names := make([]string, 0, len(PreferenceNamespaces))
+	for name := range PreferenceNamespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ValidatePreferences checks values against the namespace schema. A nil value
+// resets the key to its default.
+func ValidatePreferences(namespace string, values Attributes) error {
+	specs, ok := PreferenceNamespaces[namespace]
+	if !ok {
+		return ErrUnknownNamespace
+	}
+
+	for key, value := range values {
+		spec, ok := specs[key]
+		if !ok {
+			return &AttributeError{Name: namespace + "." + key, Reason: "is not defined"}
+		}
+		if value == nil {
+			continue
+		}
+
+		def := AttributeDefinitions{Name: namespace + "." + key, Type: spec.Type, Pattern: spec.Pattern, EnumValues: spec.EnumValues}
+		if err := validateAttribute(def, value); err != nil {
+			return err
+		}
+		if spec.Check != nil {
+			if err := spec.Check(value); err != nil {
+				return &AttributeError{Name: def.Name, Reason: err.Error()}
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetUserPreferences returns the user's effective preferences, defaults
+// included, for the given namespaces.
+func GetUserPreferences(db *gorm.DB, userID uint, namespaces ...string) (map[string]Attributes, error) {
+	var stored []UserPreferences
+	if err := db.Where("user_id = ? AND namespace IN ?", userID, namespaces).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	set := map[string]Attributes{}
+	for _, prefs := range stored {
+		set[prefs.Namespace] = prefs.Settings
+	}
+
+	effective := make(map[string]Attributes, len(namespaces))
+	for _, namespace := range namespaces {
+		values := Attributes{}
+		for key, spec := range PreferenceNamespaces[namespace] {
+			values[key] = spec.Default
+		}
+		for key, value := range set[namespace] {
+			if _, ok := values[key]; ok {
+				values[key] = value
+			}
+		}
+		effective[namespace] = values
+	}
+
+	return effective, nil
+}
+
+// SetUserPreferences merges the given values into the user's stored
+// preferences, per namespace, in one transaction. Values must already be
+// validated with ValidatePreferences.
+func SetUserPreferences(db *gorm.DB, user *Users, changes map[string]Attributes) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for namespace, values := range changes {
+			prefs := UserPreferences{
+				OrganizationID: user.OrganizationID,
+				UserID:         user.ID,
+				Namespace:      namespace,
+			}
+			err := tx.Where("user_id = ? AND namespace = ?", user.ID, namespace).Limit(1).Find(&prefs).Error
+			if err != nil {
+				return err
+			}
+
+			merged := Attributes{}
+			for key, value := range prefs.Settings {
+				merged[key] = value
+			}
+			for key, value := range values {
+				if value == nil {
+					delete(merged, key)
+					continue
+				}
+				merged[key] = value
+			}
+			prefs.Settings = merged
+
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "namespace"}},
+				DoUpdates: clause.AssignmentColumns([]string{"settings", "updated_at"}),
+			}).Create(&prefs).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePreferences(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		values    Attributes
+		err       string
+	}{
+		{"valid", "locale", Attributes{"language": "en-GB", "timezone": "Africa/Lagos"}, ""},
+		{"reset to default", "notifications", Attributes{"email": nil}, ""},
+		{"unknown namespace", "colours", Attributes{"primary": "red"}, ErrUnknownNamespace.Error()},
+		{"unknown key", "locale", Attributes{"currency": "NGN"}, `attribute "locale.currency" is not defined`},
+		{"wrong type", "notifications", Attributes{"sms": "yes"}, `attribute "notifications.sms" must be a boolean`},
+		{"bad timezone", "locale", Attributes{"timezone": "Mars/Olympus"}, `attribute "locale.timezone" is not a known time zone`},
+		{"not in enum", "display", Attributes{"theme": "neon"}, `attribute "display.theme" must be one of the defined values`},
+		{"out of range", "display", Attributes{"page_size": 500.0}, `attribute "display.page_size" must be a whole number from 1 to 100`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidatePreferences(test.namespace, test.values)
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
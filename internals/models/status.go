@@ -0,0 +1,196 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatusPending     = "pending"
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"
+	StatusLocked      = "locked"
+	StatusDeactivated = "deactivated"
+)
+
+// ErrInvalidTransition is returned when a user cannot move from its current
+// status to the requested one.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// statusTransitions lists the statuses each status may move to.
+var statusTransitions = map[string][]string{
+	StatusPending:     {StatusActive, StatusDeactivated},
+	StatusActive:      {StatusSuspended, StatusLocked, StatusDeactivated},
+	StatusSuspended:   {StatusActive, StatusDeactivated},
+	StatusLocked:      {StatusActive, StatusDeactivated},
+	StatusDeactivated: {StatusActive},
+}
+
+// UserStatusTransitions records every status change with who made it and why.
+type UserStatusTransitions struct {
+	ID             uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint      `json:"-" gorm:"index;not null"`
+	UserID         uint      `json:"user_id" gorm:"index;not null"`
+	FromStatus     string    `json:"from_status" gorm:"not null"`
+	ToStatus       string    `json:"to_status" gorm:"not null"`
+	Reason         string    `json:"reason,omitempty"`
+	Actor          string    `json:"actor" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ValidStatus reports whether status is a known user status.
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether a user may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TransitionUserStatus moves the user to the given status and records the
+// transition, in the user's history and the audit log. until is only kept
+// for suspensions, after which the user is reactivated by
+// ReactivateExpiredSuspensions.
+func TransitionUserStatus(db *gorm.DB, id uint, to, reason string, until *time.Time) (*Users, error) {
+	return transitionUserStatus(db, id, to, reason, until, nil)
+}
+
+// errSuspensionNotExpired is returned by the precondition of
+// ReactivateExpiredSuspensions when a user's suspension changed since it was
+// found expired.
+var errSuspensionNotExpired = errors.New("suspension not expired")
+
+// transitionUserStatus is TransitionUserStatus, failing with the error of
+// precondition, when given, on the user as locked for the transition.
+func transitionUserStatus(db *gorm.DB, id uint, to, reason string, until *time.Time, precondition func(*Users) error) (*Users, error) {
+	var user Users
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&user).Error; err != nil {
+			return err
+		}
+		if precondition != nil {
+			if err := precondition(&user); err != nil {
+				return err
+			}
+		}
+
+		before := user
+		from := user.Status
+		if !CanTransition(from, to) {
+			return ErrInvalidTransition
+		}
+
+		if to != StatusSuspended {
+			until = nil
+		}
+
+		err := tx.Model(&Users{}).Where("id = ?", user.ID).Updates(map[string]any{
+			"status":          to,
+			"suspended_until": until,
+		}).Error
+		if err != nil {
+			return err
+		}
+		user.Status = to
+		user.SuspendedUntil = until
+
+		err = tx.Create(&UserStatusTransitions{
+			OrganizationID: user.OrganizationID,
+			UserID:         user.ID,
+			FromStatus:     from,
+			ToStatus:       to,
+			Reason:         reason,
+			Actor:          requestinfo.Actor(tx.Statement.Context),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := recordUserChange(tx, ChangeUpdated, &before, &user); err != nil {
+			return err
+		}
+
+		return recordAudit(tx, user.OrganizationID, AuditEvent{
+			Action:     AuditUserStatusChanged,
+			TargetType: "user",
+			TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+			Details:    Attributes{"status": to, "reason": reason},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func GetUserStatusTransitions(db *gorm.DB, userID uint) ([]UserStatusTransitions, error) {
+	var transitions []UserStatusTransitions
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&transitions).Error; err != nil {
+		return nil, err
+	}
+
+	return transitions, nil
+}
+
+// GetStatusTransitionsByUserIDs returns the status history of several users
+// at once, keyed by user ID.
+func GetStatusTransitionsByUserIDs(db *gorm.DB, userIDs []uint) (map[uint][]UserStatusTransitions, error) {
+	var transitions []UserStatusTransitions
+	if err := db.Where("user_id IN ?", userIDs).Order("id").Find(&transitions).Error; err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[uint][]UserStatusTransitions, len(userIDs))
+	for _, transition := range transitions {
+		byUser[transition.UserID] = append(byUser[transition.UserID], transition)
+	}
+
+	return byUser, nil
+}
+
+// ReactivateExpiredSuspensions reactivates every suspended user whose
+// suspension ended before now and returns how many were reactivated.
+func ReactivateExpiredSuspensions(db *gorm.DB, now time.Time) (int, error) {
+	var ids []uint
+	err := db.Model(&Users{}).
+		Where("status = ? AND suspended_until IS NOT NULL AND suspended_until <= ?", StatusSuspended, now).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// the user may have been reactivated or suspended again since
+	expired := func(user *Users) error {
+		if user.Status != StatusSuspended || user.SuspendedUntil == nil || user.SuspendedUntil.After(now) {
+			return errSuspensionNotExpired
+		}
+		return nil
+	}
+
+	reactivated := 0
+	for _, id := range ids {
+		_, err := transitionUserStatus(db, id, StatusActive, "Suspension expired.", nil, expired)
+		if err != nil && !errors.Is(err, ErrInvalidTransition) && !errors.Is(err, errSuspensionNotExpired) && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return reactivated, err
+		}
+		if err == nil {
+			reactivated++
+		}
+	}
+
+	return reactivated, nil
+}
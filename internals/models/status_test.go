@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{StatusPending, StatusActive, true},
+		{StatusPending, StatusSuspended, false},
+		{StatusActive, StatusSuspended, true},
+		{StatusActive, StatusLocked, true},
+		{StatusActive, StatusActive, false},
+		{StatusSuspended, StatusActive, true},
+		{StatusSuspended, StatusLocked, false},
+		{StatusLocked, StatusActive, true},
+		{StatusDeactivated, StatusActive, true},
+		{StatusDeactivated, StatusSuspended, false},
+		{"unknown", StatusActive, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.from+" to "+test.to, func(t *testing.T) {
+			assert.Equal(t, test.want, CanTransition(test.from, test.to))
+		})
+	}
+}
+
+func TestReactivateExpiredSuspensionsRechecksUnderLock(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Unable to open sqlite %s", err.Error())
+	}
+	rawDB, _ := db.DB()
+	rawDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&Users{}, &UserStatusTransitions{}, &UserChanges{}, &Events{}, &AuditEntries{}, &AuditChains{})
+	if err != nil {
+		t.Fatalf("Unable to migrate %s", err.Error())
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	expired, later := now.Add(-time.Hour), now.Add(time.Hour)
+	obi := Users{OrganizationID: 1, Username: "obi", Email: "obi@example.com", Status: StatusSuspended, SuspendedUntil: &expired}
+	ada := Users{OrganizationID: 1, Username: "ada", Email: "ada@example.com", Status: StatusSuspended, SuspendedUntil: &expired}
+	assert.NoError(t, db.Create(&obi).Error)
+	assert.NoError(t, db.Create(&ada).Error)
+
+	// ada is suspended again right after the expired suspensions are found
+	resuspended := false
+	err = db.Callback().Query().After("gorm:query").Register("test:resuspend", func(tx *gorm.DB) {
+		if !resuspended {
+			resuspended = true
+			tx.Session(&gorm.Session{NewDB: true}).Model(&Users{}).Where("id = ?", ada.ID).Update("suspended_until", later)
+		}
+	})
+	assert.NoError(t, err)
+
+	reactivated, err := ReactivateExpiredSuspensions(db, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reactivated)
+
+	var users []Users
+	assert.NoError(t, db.Order("id").Find(&users).Error)
+	assert.Equal(t, StatusActive, users[0].Status)
+	assert.Equal(t, StatusSuspended, users[1].Status)
+}
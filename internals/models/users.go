@@ -1,19 +1,165 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// Users are owned by an organization; usernames and emails only have to be
+// unique within that organization. OrganizationID is filled in from the
+// request's tenant and never read from or written to JSON.
 type Users struct {
-	ID       uint   `json:"id" gorm:"primaryKey;autoIncrement"`
-	Username string `json:"username" gorm:"unique;not null"`
-	Email    string `json:"email" gorm:"unique;not null"`
-	Fullname string `json:"fullname,omitempty"`
+	ID             uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint   `json:"-" gorm:"index;uniqueIndex:idx_users_org_username,priority:1;uniqueIndex:idx_users_org_email,priority:1"`
+	Username       string `json:"username" gorm:"not null;uniqueIndex:idx_users_org_username,priority:2"`
+	Email          string `json:"email" gorm:"not null;uniqueIndex:idx_users_org_email,priority:2"`
+	Fullname       string `json:"fullname,omitempty"`
+
+	// Status is only changed through TransitionUserStatus.
+	Status         string     `json:"status,omitempty" gorm:"not null;default:active;index"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+
+	// Attributes are custom profile fields validated against the
+	// organization's AttributeDefinitions.
+	Attributes Attributes `json:"attributes,omitempty"`
+
+	// AvatarHash identifies the current avatar upload; empty means the user
+	// gets an identicon.
+	AvatarHash string `json:"-"`
+}
+
+// IsUniqueViolation reports whether err is a unique constraint violation, as
+// reported by Postgres, MySQL or SQLite.
+func IsUniqueViolation(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "duplicate key") || strings.Contains(msg, "Duplicate entry") || strings.Contains(msg, "UNIQUE constraint failed")
+}
+
+// UniqueViolation returns the field, "username" or "email", whose
+// per-organization unique index err violates, or "" for any other error.
+func UniqueViolation(err error) string {
+	if !IsUniqueViolation(err) {
+		return ""
+	}
+	// MySQL quotes the duplicate value first, which may contain anything
+	msg := err.Error()
+	if i := strings.LastIndex(msg, " for key "); i >= 0 {
+		msg = msg[i:]
+	}
+	if strings.Contains(msg, "email") {
+		return "email"
+	}
+	if strings.Contains(msg, "username") {
+		return "username"
+	}
+
+	return ""
+}
+
+// UserFilter narrows the users returned by GetAll. Zero values match
+// everything.
+type UserFilter struct {
+	Status string
+	// Attributes must already be typed with ParseAttributeValue.
+	Attributes map[string]any
+	// AfterID and Limit page through users in ID order.
+	AfterID uint
+	Limit   int
+}
+
+// EncodeUserCursor returns the opaque cursor of the page after the user
+// with the given ID, shared by the GraphQL and gRPC APIs.
+func EncodeUserCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("user:" + strconv.FormatUint(uint64(id), 10)))
 }
 
-func CreateUser(db *gorm.DB, user Users) error {
-	return db.Create(&user).Error
+// DecodeUserCursor returns the UserFilter.AfterID of a cursor from
+// EncodeUserCursor.
+func DecodeUserCursor(cursor string) (uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(string(raw), "user:"), 10, 32)
+	return uint(id), err
 }
 
-func GetAll(db *gorm.DB) ([]Users, error) {
+// CreateUser inserts user and fills in its ID.
+func CreateUser(db *gorm.DB, user *Users) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return recordUserChange(tx, ChangeCreated, nil, user)
+	})
+}
+
+// CreateUsers inserts users batchSize at a time and fills in their IDs.
+// Each batch is one transaction that also records the users' history and
+// events, so bulk loads look like users created one by one. Batches before
+// a failing one stay committed.
+func CreateUsers(db *gorm.DB, users []Users, batchSize int) error {
+	for start := 0; start < len(users); start += batchSize {
+		batch := users[start:min(start+batchSize, len(users))]
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(batch).Error; err != nil {
+				return err
+			}
+
+			changes := make([]UserChanges, len(batch))
+			for i := range batch {
+				change, err := newUserChange(tx.Statement.Context, ChangeCreated, nil, &batch[i])
+				if err != nil {
+					return err
+				}
+				changes[i] = *change
+			}
+			if err := tx.Create(changes).Error; err != nil {
+				return err
+			}
+
+			events := make([]Events, len(changes))
+			for i := range changes {
+				events[i] = changeEvent(&changes[i])
+			}
+			return tx.Create(events).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func GetAll(db *gorm.DB, filter UserFilter) ([]Users, error) {
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	for name, value := range filter.Attributes {
+		query, args, err := attributeFilter(db, name, value)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(query, args...)
+	}
+	if filter.AfterID > 0 {
+		db = db.Where("id > ?", filter.AfterID)
+	}
+	if filter.AfterID > 0 || filter.Limit > 0 {
+		db = db.Order("id")
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+
 	var users []Users
 	if err := db.Find(&users).Error; err != nil {
 		return nil, err
@@ -22,6 +168,58 @@ func GetAll(db *gorm.DB) ([]Users, error) {
 	return users, nil
 }
 
+// ExportUsers returns the organization's users matching filter, like
+// GetAll, and records in the audit log that they were exported.
+func ExportUsers(db *gorm.DB, orgID uint, filter UserFilter) ([]Users, error) {
+	var users []Users
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		users, err = GetAll(tx, filter)
+		if err != nil {
+			return err
+		}
+
+		details := Attributes{"count": len(users)}
+		if filter.Status != "" {
+			details["status"] = filter.Status
+		}
+		if len(filter.Attributes) > 0 {
+			details["attributes"] = filter.Attributes
+		}
+		return recordAudit(tx, orgID, AuditEvent{
+			Action:     AuditUsersExported,
+			TargetType: "organization",
+			TargetID:   strconv.FormatUint(uint64(orgID), 10),
+			Details:    details,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// CountUsersByStatus returns how many users have each status. Statuses
+// without users are left out.
+func CountUsersByStatus(db *gorm.DB) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := db.Model(&Users{}).Select("status, count(*) AS count").Group("status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	return counts, nil
+}
+
 func GetUserByID(db *gorm.DB, id uint) (*Users, error) {
 	var user Users
 	if err := db.Where("id = ?", id).First(&user).Error; err != nil {
@@ -41,11 +239,39 @@ func GetUserByUsername(db *gorm.DB, username string) (*Users, error) {
 }
 
 func UpdateUserByID(db *gorm.DB, id uint, user Users) error {
-	return db.Model(&Users{}).Where("id = ?", id).Updates(user).Error
+	return updateUser(db, "id = ?", id, user)
 }
 
 func UpdateUserByUsername(db *gorm.DB, username string, user Users) error {
-	return db.Model(&Users{}).Where("username = ?", username).Updates(user).Error
+	return updateUser(db, "username = ?", username, user)
+}
+
+// UpdateUserFieldsByID sets the given columns, including to zero values,
+// which UpdateUserByID skips.
+func UpdateUserFieldsByID(db *gorm.DB, id uint, fields map[string]any) error {
+	return updateUser(db, "id = ?", id, fields)
+}
+
+// updateUser applies updates, a Users or a column map, to the user matching
+// query and records the change.
+func updateUser(db *gorm.DB, query string, arg any, updates any) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var before Users
+		if err := tx.Where(query, arg).First(&before).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Users{}).Where("id = ?", before.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		var after Users
+		if err := tx.Where("id = ?", before.ID).First(&after).Error; err != nil {
+			return err
+		}
+
+		return recordUserChange(tx, ChangeUpdated, &before, &after)
+	})
 }
 
 func DeleteUserByID(db *gorm.DB, id uint) error {
@@ -53,7 +279,8 @@ func DeleteUserByID(db *gorm.DB, id uint) error {
 	if err != nil {
 		return err
 	}
-	return db.Delete(&Users{}, user).Error
+
+	return deleteUser(db, user)
 }
 
 func DeleteUserByUsername(db *gorm.DB, username string) error {
@@ -62,5 +289,28 @@ func DeleteUserByUsername(db *gorm.DB, username string) error {
 		return err
 	}
 
-	return db.Delete(&user).Error
+	return deleteUser(db, user)
+}
+
+// deleteUser deletes user, recording it in its history and the audit log.
+func deleteUser(db *gorm.DB, user *Users) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		if err := recordUserChange(tx, ChangeDeleted, user, nil); err != nil {
+			return err
+		}
+
+		return recordAudit(tx, user.OrganizationID, AuditEvent{
+			Action:     AuditUserDeleted,
+			TargetType: "user",
+			TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+			Details:    Attributes{"username": user.Username},
+		})
+	})
+}
+
+func SetUserAvatar(db *gorm.DB, id uint, hash string) error {
+	return db.Model(&Users{}).Where("id = ?", id).Update("avatar_hash", hash).Error
 }
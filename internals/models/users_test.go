@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+		want string
+	}{
+		{"Postgres email", `ERROR: duplicate key value violates unique constraint "idx_users_org_email" (SQLSTATE 23505)`, "email"},
+		{"Postgres username", `ERROR: duplicate key value violates unique constraint "idx_users_org_username" (SQLSTATE 23505)`, "username"},
+		{"MySQL email", `Error 1062 (23000): Duplicate entry '1-jane@example.com' for key 'users.idx_users_org_email'`, "email"},
+		{"MySQL username that looks like an email", `Error 1062 (23000): Duplicate entry '1-email' for key 'users.idx_users_org_username'`, "username"},
+		{"SQLite email", `constraint failed: UNIQUE constraint failed: users.organization_id, users.email (2067)`, "email"},
+		{"SQLite username", `constraint failed: UNIQUE constraint failed: users.organization_id, users.username (2067)`, "username"},
+		{"Other unique index", `ERROR: duplicate key value violates unique constraint "organizations_slug_key" (SQLSTATE 23505)`, ""},
+		{"Other error", `ERROR: null value in column "email" violates not-null constraint (SQLSTATE 23502)`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := errors.New(test.err)
+			assert.Equal(t, test.want, UniqueViolation(err))
+			assert.Equal(t, test.name != "Other error", IsUniqueViolation(err))
+		})
+	}
+}
+
+func TestUserCursor(t *testing.T) {
+	id, err := DecodeUserCursor(EncodeUserCursor(42))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), id)
+
+	_, err = DecodeUserCursor("not a cursor")
+	assert.Error(t, err)
+}
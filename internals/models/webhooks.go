@@ -0,0 +1,163 @@
+package models
+
+import (
+	"errors"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead deliveries exhausted their retries; they stay on the
+	// dead-letter list until redelivered.
+	DeliveryDead = "dead"
+)
+
+// Webhooks are subscriptions of an organization to user events.
+type Webhooks struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint       `json:"-" gorm:"index;not null"`
+	URL            string     `json:"url" gorm:"not null"`
+	EventTypes     StringList `json:"events"`
+	// Secret signs every payload; it is only shown when the webhook is
+	// created.
+	Secret    string    `json:"-" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDeliveries are the attempts to deliver one event to one webhook.
+type WebhookDeliveries struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrganizationID uint       `json:"-" gorm:"index;not null"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;uniqueIndex:idx_webhook_deliveries_webhook_event,priority:1"`
+	EventID        uint       `json:"event_id" gorm:"not null;uniqueIndex:idx_webhook_deliveries_webhook_event,priority:2"`
+	Status         string     `json:"status" gorm:"not null;index:idx_webhook_deliveries_due,priority:1"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due,priority:2"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Validate checks the URL and event types of a new webhook. A URL naming a
+// private host is rejected here; one whose name resolves to a private address
+// is refused when sending.
+func (w Webhooks) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("url must not point to a private address")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !PublicAddr(addr) {
+		return errors.New("url must not point to a private address")
+	}
+	if len(w.EventTypes) == 0 {
+		return errors.New("events must name at least one event type")
+	}
+	for _, t := range w.EventTypes {
+		if !slices.Contains(EventTypes, t) {
+			return errors.New("unknown event type " + t)
+		}
+	}
+
+	return nil
+}
+
+// PublicAddr reports whether webhooks may be sent to addr, so that they can't
+// reach the API's own network: loopback, private, link-local, multicast and
+// unspecified addresses are not public.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && !addr.IsLoopback() && !addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() && !addr.IsLinkLocalMulticast() &&
+		!addr.IsMulticast() && !addr.IsUnspecified()
+}
+
+// Subscribed reports whether the webhook wants events of the given type.
+func (w Webhooks) Subscribed(eventType string) bool {
+	return slices.Contains(w.EventTypes, eventType)
+}
+
+func CreateWebhook(db *gorm.DB, webhook *Webhooks) error {
+	return db.Create(webhook).Error
+}
+
+func GetWebhooks(db *gorm.DB) ([]Webhooks, error) {
+	var webhooks []Webhooks
+	if err := db.Order("id").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func GetWebhookByID(db *gorm.DB, id uint) (*Webhooks, error) {
+	var webhook Webhooks
+	if err := db.Where("id = ?", id).First(&webhook).Error; err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// DeleteWebhookByID removes the webhook and its deliveries.
+func DeleteWebhookByID(db *gorm.DB, id uint) error {
+	webhook, err := GetWebhookByID(db, id)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&WebhookDeliveries{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(webhook).Error
+	})
+}
+
+// GetWebhookDeliveries lists a webhook's deliveries, newest first, optionally
+// only those with the given status.
+func GetWebhookDeliveries(db *gorm.DB, webhookID uint, status string, limit int) ([]WebhookDeliveries, error) {
+	db = db.Where("webhook_id = ?", webhookID)
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+
+	var deliveries []WebhookDeliveries
+	if err := db.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverWebhookDelivery queues a delivery to be attempted again right
+// away, whatever its status.
+func RedeliverWebhookDelivery(db *gorm.DB, webhookID, deliveryID uint) (*WebhookDeliveries, error) {
+	var delivery WebhookDeliveries
+	err := db.Where("id = ? AND webhook_id = ?", deliveryID, webhookID).First(&delivery).Error
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	delivery.LastError = ""
+	err = db.Model(&delivery).Select("status", "attempts", "next_attempt_at", "last_error").Updates(&delivery).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{"https://hooks.example.com/users", ""},
+		{"http://203.0.113.7:8080/hook", ""},
+		{"ftp://hooks.example.com", "url must be an absolute http or https URL"},
+		{"/hook", "url must be an absolute http or https URL"},
+		{"http://localhost:8080/hook", "url must not point to a private address"},
+		{"http://api.LOCALHOST/hook", "url must not point to a private address"},
+		{"http://127.0.0.1/hook", "url must not point to a private address"},
+		{"http://[::1]/hook", "url must not point to a private address"},
+		{"http://10.0.0.5/hook", "url must not point to a private address"},
+		{"http://192.168.1.1/hook", "url must not point to a private address"},
+		{"http://169.254.169.254/latest/meta-data", "url must not point to a private address"},
+		{"http://[fe80::1]/hook", "url must not point to a private address"},
+		{"http://[::ffff:10.0.0.5]/hook", "url must not point to a private address"},
+		{"http://0.0.0.0/hook", "url must not point to a private address"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			err := Webhooks{URL: test.url, EventTypes: StringList{EventUserCreated}}.Validate()
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// Package openapi builds the API's OpenAPI 3.1 document from the gin route
+// table and the Go types handlers read and write, serves it with a Swagger
+// UI, and validates request bodies against it.
+package openapi
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Document is an OpenAPI 3.1 document. Only the parts the API uses are
+// modelled.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]*PathItem `json:"paths"`
+	Components Components                      `json:"components"`
+
+	// operations indexes Paths by gin method and route for the validator.
+	operations map[string]*PathItem
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem is one operation of a path.
+type PathItem struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation describes what a route reads and writes. Paths and path
+// parameters come from the route itself.
+type Operation struct {
+	Summary string
+	Tag     string
+	// Tenant marks routes scoped to the caller's organization.
+	Tenant bool
+	// Admin marks routes needing the admin token; with Tenant, the admin
+	// names the organization in the X-Organization header.
+	Admin bool
+	Query []Query
+
+	// Body is a value of the JSON request body type; BodyRequired lists the
+	// fields this operation needs on top of its schema. BodyOptional marks
+	// bodies that may be left out entirely.
+	Body         any
+	BodyRequired []string
+	BodyOptional bool
+	// BodyMedia is the media type of a non-JSON request body.
+	BodyMedia string
+
+	// Data holds a value of each field of the success response's data.
+	Data map[string]any
+	// Produces is the media type of a non-JSON success response.
+	Produces string
+}
+
+// Query is a query string parameter.
+type Query struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// Build documents every route that has an Operation, keyed by
+// "METHOD /path" with gin's path syntax. envelope is the JSON response
+// envelope; success responses put the operation's Data in its "data"
+// field.
+func Build(info Info, routes gin.RoutesInfo, operations map[string]Operation, envelope any) *Document {
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI:    "3.1.0",
+		Info:       info,
+		Paths:      map[string]map[string]*PathItem{},
+		operations: map[string]*PathItem{},
+	}
+
+	envelopeRef := g.named("Response", envelope)
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Path+routes[i].Method < routes[j].Path+routes[j].Method
+	})
+	for _, route := range routes {
+		op, ok := operations[route.Method+" "+route.Path]
+		if !ok {
+			continue
+		}
+
+		item := &PathItem{
+			Summary:   op.Summary,
+			Responses: map[string]Response{},
+		}
+		if op.Tag != "" {
+			item.Tags = []string{op.Tag}
+		}
+		if op.Tenant {
+			item.Security = []map[string][]string{{"organization": {}}, {"bearer": {}}}
+		}
+		switch {
+		case op.Admin && op.Tenant:
+			item.Security = []map[string][]string{{"admin": {}, "organization": {}}}
+		case op.Admin:
+			item.Security = []map[string][]string{{"admin": {}}}
+		}
+
+		path := openAPIPath(route.Path)
+		for _, segment := range strings.Split(route.Path, "/") {
+			if name, ok := strings.CutPrefix(segment, ":"); ok {
+				item.Parameters = append(item.Parameters, Parameter{
+					Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"},
+				})
+			}
+		}
+		for _, q := range op.Query {
+			item.Parameters = append(item.Parameters, Parameter{
+				Name: q.Name, In: "query", Description: q.Description, Schema: &Schema{Type: q.Type},
+			})
+		}
+
+		switch {
+		case op.Body != nil:
+			schema := g.schema(op.Body)
+			if len(op.BodyRequired) > 0 {
+				schema = &Schema{AllOf: []*Schema{schema}, Required: op.BodyRequired}
+			}
+			item.RequestBody = &RequestBody{
+				Required: !op.BodyOptional,
+				Content:  map[string]MediaType{"application/json": {Schema: schema}},
+			}
+		case op.BodyMedia != "":
+			item.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{op.BodyMedia: {Schema: &Schema{Type: "string", Format: "binary"}}},
+			}
+		}
+
+		if op.Produces != "" {
+			item.Responses["200"] = Response{
+				Description: "OK",
+				Content:     map[string]MediaType{op.Produces: {Schema: &Schema{Type: "string"}}},
+			}
+		} else {
+			data := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			for name, value := range op.Data {
+				data.Properties[name] = g.schema(value)
+			}
+			item.Responses["200"] = Response{
+				Description: "OK",
+				Content: map[string]MediaType{"application/json": {Schema: &Schema{
+					AllOf:      []*Schema{envelopeRef},
+					Properties: map[string]*Schema{"data": data},
+				}}},
+			}
+		}
+		item.Responses["default"] = Response{
+			Description: "Error",
+			Content:     map[string]MediaType{"application/json": {Schema: envelopeRef}},
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = item
+		doc.operations[route.Method+" "+route.Path] = item
+	}
+
+	doc.Components = Components{
+		Schemas: g.schemas,
+		SecuritySchemes: map[string]SecurityScheme{
+			"organization": {Type: "apiKey", In: "header", Name: "X-Organization", Description: "Slug of the organization."},
+			"bearer":       {Type: "http", Scheme: "bearer", Description: "HS256 token with an org claim."},
+			"admin":        {Type: "http", Scheme: "bearer", Description: "The admin token."},
+		},
+	}
+
+	return doc
+}
+
+// openAPIPath converts gin's /users/:userID to /users/{userID}, dropping
+// gin's trailing slash on group roots.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+
+	path = strings.Join(segments, "/")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	return path
+}
+
+// Handler serves the document as JSON.
+func Handler(doc *Document) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
@@ -0,0 +1,169 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type envelope struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    any    `json:"data"`
+}
+
+type user struct {
+	ID         uint           `json:"id"`
+	Username   string         `json:"username"`
+	Email      string         `json:"email"`
+	Until      *time.Time     `json:"until,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Secret     string         `json:"-"`
+}
+
+func TestValidateRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid body",
+			method:   http.MethodPost,
+			url:      "/users/",
+			body:     `{"username":"ada","email":"ada@example.com","attributes":{"team":"eng"}}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"username":"ada","email":"ada@example.com","attributes":{"team":"eng"}}`,
+		},
+		{
+			name:     "Missing required field",
+			method:   http.MethodPost,
+			url:      "/users/",
+			body:     `{"username":"ada"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","message":"Request body not valid.","error":{"error":"body.email is required"}}`,
+		},
+		{
+			name:     "Wrong type",
+			method:   http.MethodPut,
+			url:      "/users/1",
+			body:     `{"username":7}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","message":"Request body not valid.","error":{"error":"body.username must be a string"}}`,
+		},
+		{
+			name:     "Unknown field",
+			method:   http.MethodPut,
+			url:      "/users/1",
+			body:     `{"secret":"x"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","message":"Request body not valid.","error":{"error":"body.secret is not a known field"}}`,
+		},
+		{
+			name:     "Bad date-time",
+			method:   http.MethodPut,
+			url:      "/users/1",
+			body:     `{"until":"tomorrow"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"error","message":"Request body not valid.","error":{"error":"body.until must be an RFC 3339 date-time"}}`,
+		},
+		{
+			name:     "Body too large",
+			method:   http.MethodPost,
+			url:      "/users/",
+			body:     `{"username":"` + strings.Repeat("a", 128) + `","email":"ada@example.com"}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantBody: `{"status":"error","message":"Request body must not be larger than 128 bytes."}`,
+		},
+		{
+			name:     "Other media left to the handler",
+			method:   http.MethodPut,
+			url:      "/users/1/avatar",
+			body:     `"` + strings.Repeat("a", 256) + `"`,
+			wantCode: http.StatusOK,
+			wantBody: `"` + strings.Repeat("a", 256) + `"`,
+		},
+		{
+			name:     "Optional body left out",
+			method:   http.MethodPut,
+			url:      "/users/1",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.ReleaseMode)
+			r := gin.New()
+			var doc Document
+			r.Use(ValidateRequests(&doc, 128))
+			echo := func(c *gin.Context) {
+				body, _ := c.GetRawData()
+				c.String(http.StatusOK, string(body))
+			}
+			r.POST("/users/", echo)
+			r.PUT("/users/:userID", echo)
+			r.PUT("/users/:userID/avatar", echo)
+			doc = *Build(Info{Title: "test"}, r.Routes(), map[string]Operation{
+				"POST /users/":              {Body: user{}, BodyRequired: []string{"username", "email"}},
+				"PUT /users/:userID":        {Body: user{}, BodyOptional: true},
+				"PUT /users/:userID/avatar": {BodyMedia: "image/png"},
+			}, envelope{})
+
+			req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("Failed to create request %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, test.wantCode, w.Code)
+			if test.wantBody == "" {
+				assert.Empty(t, w.Body.String())
+			} else {
+				assert.JSONEq(t, test.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/users/:userID", func(c *gin.Context) {})
+	r.GET("/undocumented", func(c *gin.Context) {})
+
+	doc := Build(Info{Title: "test"}, r.Routes(), map[string]Operation{
+		"GET /users/:userID": {Tenant: true, Data: map[string]any{"user": user{}}},
+	}, envelope{})
+
+	assert.Equal(t, []string{"/users/{userID}"}, keys(doc.Paths))
+	op := doc.Paths["/users/{userID}"]["get"]
+	assert.Equal(t, []Parameter{{Name: "userID", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, op.Parameters)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/user"}, op.Responses["200"].Content["application/json"].Schema.Properties["data"].Properties["user"])
+
+	schema := doc.Components.Schemas["user"]
+	assert.Equal(t, []string{"attributes", "email", "id", "until", "username"}, keys(schema.Properties))
+	assert.Equal(t, []string{"string", "null"}, schema.Properties["until"].Type)
+	assert.Equal(t, "date-time", schema.Properties["until"].Format)
+	assert.Equal(t, false, schema.AdditionalProperties)
+}
+
+func keys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
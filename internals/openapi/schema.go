@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema 2020-12 schema, as used by OpenAPI 3.1.
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        any                `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// AdditionalProperties is a *Schema, or false to reject unknown fields.
+	AdditionalProperties any       `json:"additionalProperties,omitempty"`
+	Items                *Schema   `json:"items,omitempty"`
+	AllOf                []*Schema `json:"allOf,omitempty"`
+	Minimum              *float64  `json:"minimum,omitempty"`
+}
+
+// generator turns Go types into schemas the way encoding/json would encode
+// them. Named structs become components referenced by $ref.
+type generator struct {
+	schemas map[string]*Schema
+	types   map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{schemas: map[string]*Schema{}, types: map[reflect.Type]string{}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// named registers v's type as the component name and returns a reference
+// to it.
+func (g *generator) named(name string, v any) *Schema {
+	t := reflect.TypeOf(v)
+	g.types[t] = name
+	g.schemas[name] = g.structSchema(t)
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *generator) schema(v any) *Schema {
+	return g.typeSchema(reflect.TypeOf(v))
+}
+
+func (g *generator) typeSchema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	schema := g.valueSchema(t)
+	if nullable && schema.Ref == "" {
+		if typ, ok := schema.Type.(string); ok {
+			schema.Type = []string{typ, "null"}
+		}
+	}
+
+	return schema
+}
+
+func (g *generator) valueSchema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		return g.structRef(t)
+	}
+
+	zero := 0.0
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		// nil slices and maps encode as null
+		return &Schema{Type: []string{"array", "null"}, Items: g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: []string{"object", "null"}, AdditionalProperties: g.typeSchema(t.Elem())}
+	}
+
+	// interfaces hold any JSON value
+	return &Schema{}
+}
+
+// structRef returns a reference to a named struct's component, generating it
+// on first use; anonymous structs are inlined.
+func (g *generator) structRef(t reflect.Type) *Schema {
+	if t.Name() == "" {
+		return g.structSchema(t)
+	}
+
+	name, ok := g.types[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := g.schemas[name]; taken {
+			name = strings.ReplaceAll(t.String(), ".", "")
+		}
+		g.types[t] = name
+		// reserve the name before recursing into the fields
+		g.schemas[name] = &Schema{}
+		g.schemas[name] = g.structSchema(t)
+	}
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema lists the fields encoding/json would encode. Every field is
+// optional, since the same types are read from requests and written in
+// responses; operations add the fields they require. Unknown fields are not
+// allowed.
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	g.addFields(schema, t)
+
+	return schema
+}
+
+func (g *generator) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(schema, embedded)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = g.typeSchema(field.Type)
+	}
+}
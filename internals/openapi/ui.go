@@ -0,0 +1,22 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed ui.html
+var uiPage string
+
+// UI serves a Swagger UI page for the document at specURL. The page is
+// embedded in the binary; the Swagger UI scripts load from a CDN.
+func UI(specURL string) gin.HandlerFunc {
+	page := strings.Replace(uiPage, "{{SPEC_URL}}", specURL, 1)
+
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	}
+}
@@ -0,0 +1,211 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValidateRequests rejects JSON request bodies that do not match the
+// operation's schema in doc, before they reach the handler, and answers 413
+// to those larger than maxBytes. Other bodies, like avatars, are left for
+// their handlers to read and limit. doc may be filled in after the
+// middleware is installed, once every route is registered.
+func ValidateRequests(doc *Document, maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		item := doc.operations[c.Request.Method+" "+c.FullPath()]
+		if item == nil || item.RequestBody == nil {
+			c.Next()
+			return
+		}
+		media, ok := item.RequestBody.Content["application/json"]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Request body must not be larger than %d bytes.", maxBytes),
+			})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Request body not valid.",
+				"error": gin.H{
+					"error": err.Error(),
+				},
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if len(bytes.TrimSpace(body)) == 0 && !item.RequestBody.Required {
+			c.Next()
+			return
+		}
+
+		if err := doc.Validate(media.Schema, body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Request body not valid.",
+				"error": gin.H{
+					"error": err.Error(),
+				},
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Validate checks a JSON document against schema, resolving references to
+// doc's components.
+func (doc *Document) Validate(schema *Schema, body []byte) error {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return err
+	}
+
+	return doc.validate(schema, value, "body")
+}
+
+func (doc *Document) validate(schema *Schema, value any, path string) error {
+	if schema == nil {
+		return nil
+	}
+
+	if schema.Ref != "" {
+		ref := doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if err := doc.validate(ref, value, path); err != nil {
+			return err
+		}
+	}
+	for _, sub := range schema.AllOf {
+		if err := doc.validate(sub, value, path); err != nil {
+			return err
+		}
+	}
+
+	if schema.Type != nil && !matchesType(schema.Type, value) {
+		return fmt.Errorf("%s must be %s", path, typeName(schema.Type))
+	}
+
+	switch value := value.(type) {
+	case string:
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				return fmt.Errorf("%s must be an RFC 3339 date-time", path)
+			}
+		}
+	case float64:
+		if schema.Minimum != nil && value < *schema.Minimum {
+			return fmt.Errorf("%s must be at least %v", path, *schema.Minimum)
+		}
+	case []any:
+		for i, item := range value {
+			if err := doc.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if v, ok := value[name]; !ok || v == nil {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fieldPath := path + "." + name
+			if property, ok := schema.Properties[name]; ok {
+				if err := doc.validate(property, value[name], fieldPath); err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s is not a known field", fieldPath)
+				}
+			case *Schema:
+				if err := doc.validate(additional, value[name], fieldPath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchesType(types any, value any) bool {
+	switch types := types.(type) {
+	case string:
+		return isType(types, value)
+	case []string:
+		return slices.ContainsFunc(types, func(t string) bool { return isType(t, value) })
+	}
+
+	return true
+}
+
+func isType(t string, value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || (t == "integer" && value == math.Trunc(value))
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	}
+
+	return false
+}
+
+func typeName(types any) string {
+	switch types := types.(type) {
+	case []string:
+		names := make([]string, len(types))
+		for i, t := range types {
+			names[i] = typeName(t)
+		}
+		return strings.Join(names, " or ")
+	case string:
+		switch types {
+		case "array", "integer", "object":
+			return "an " + types
+		case "null":
+			return types
+		}
+		return "a " + types
+	}
+
+	return fmt.Sprint(types)
+}
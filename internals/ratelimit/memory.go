@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+)
+
+// sweepInterval is how often full buckets, which are the same as no bucket,
+// are dropped.
+const sweepInterval = time.Minute
+
+// Memory keeps buckets in the process, so each instance of the API limits
+// clients on its own.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+	full   time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Take(_ context.Context, key string, rate config.Rate) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		for key, b := range m.buckets {
+			if !now.Before(b.full) {
+				delete(m.buckets, key)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, found := m.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(rate.Count), at: now}
+		m.buckets[key] = b
+	}
+
+	left, ok := take(b.tokens, now.Sub(b.at), rate)
+	b.tokens, b.at, b.full = left, now, now.Add(untilFull(left, rate))
+
+	return left, ok, nil
+}
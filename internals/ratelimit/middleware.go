@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+)
+
+// APIKeyHeader carries a client's API key.
+const APIKeyHeader = "X-API-Key"
+
+// Identity is how clients are told apart. Only identities the server can
+// verify are used, as a client could otherwise send a new one with every
+// request to get a fresh bucket.
+type Identity struct {
+	// Keys are tried in order: api_key, user or ip. Clients with none of
+	// them are told apart by IP.
+	Keys []string
+	// APIKeys holds the SHA-256 hex digests of the valid API keys.
+	APIKeys []string
+	// TokenSecret verifies the bearer tokens users are told apart by.
+	TokenSecret string
+}
+
+// Middleware limits each client to the rate of the route it calls, keyed
+// "METHOD /route", else to fallback; a zero rate means no limit. Limited
+// responses carry RateLimit-* headers, and requests over the limit are
+// answered 429 with Retry-After. Clients' IPs are only read from
+// X-Forwarded-For when the request comes through one of the engine's
+// trusted proxies. Requests are let through when the store fails.
+func Middleware(store Store, id Identity, fallback config.Rate, routes map[string]config.Rate) gin.HandlerFunc {
+	apiKeys := make(map[string]bool, len(id.APIKeys))
+	for _, digest := range id.APIKeys {
+		apiKeys[strings.ToLower(digest)] = true
+	}
+
+	return func(c *gin.Context) {
+		scope := c.Request.Method + " " + c.FullPath()
+		rate, ok := routes[scope]
+		if !ok {
+			scope, rate = "default", fallback
+		}
+		if rate.Count == 0 {
+			c.Next()
+			return
+		}
+
+		key := "ratelimit:" + scope + ":" + client(c, id, apiKeys)
+		left, ok, err := store.Take(c.Request.Context(), key, rate)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "Unable to rate limit request, letting it through", "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rate.Count, ceilSeconds(rate.Period)))
+		c.Header("RateLimit-Limit", strconv.Itoa(rate.Count))
+		c.Header("RateLimit-Remaining", strconv.Itoa(int(left)))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(untilFull(left, rate))))
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(untilToken(left, rate))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"status":  "error",
+				"message": "Too many requests, retry later.",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// client identifies the caller by the first of id.Keys it proves: an API key
+// listed in apiKeys, or a bearer token signed with id.TokenSecret naming a
+// user. Anything else falls back to the IP.
+func client(c *gin.Context, id Identity, apiKeys map[string]bool) string {
+	for _, key := range id.Keys {
+		switch key {
+		case "api_key":
+			if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+				sum := sha256.Sum256([]byte(apiKey))
+				if digest := hex.EncodeToString(sum[:]); apiKeys[digest] {
+					return "key:" + digest
+				}
+			}
+		case "user":
+			token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !ok {
+				continue
+			}
+			if claims, err := tenant.VerifyToken(token, id.TokenSecret); err == nil && claims.Subject != "" {
+				return "user:" + claims.Org + "/" + claims.Subject
+			}
+		}
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
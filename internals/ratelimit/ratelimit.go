@@ -0,0 +1,79 @@
+// Package ratelimit limits how many requests each client may make, with a
+// token bucket per client and route kept in memory or in Redis.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+)
+
+// Store keeps token buckets.
+type Store interface {
+	// Take takes a token from the bucket at key, which holds rate.Count
+	// tokens and refills them over rate.Period, and returns the tokens left
+	// and whether there was one to take.
+	Take(ctx context.Context, key string, rate config.Rate) (left float64, ok bool, err error)
+}
+
+// Default is the store requests are limited with, nil when rate limiting
+// is off.
+var Default Store
+
+// Init sets up Default from cfg.Store ("memory", "redis" or empty to
+// disable rate limiting).
+func Init(cfg config.RateLimit) {
+	switch cfg.Store {
+	case "":
+		return
+	case "redis":
+		store, err := NewRedis(cfg.RedisURL)
+		if err != nil {
+			slog.Error("Unable to set up the Redis rate limit store", "error", err)
+			os.Exit(1)
+		}
+		Default = store
+		slog.Info("Rate limiting with Redis")
+	default:
+		Default = NewMemory()
+		slog.Info("Rate limiting in memory")
+	}
+}
+
+// take refills a bucket holding tokens for elapsed, then takes a token if
+// there is one.
+func take(tokens float64, elapsed time.Duration, rate config.Rate) (float64, bool) {
+	capacity := float64(rate.Count)
+	tokens = math.Min(capacity, tokens+elapsed.Seconds()*perSecond(rate))
+	if tokens < 1 {
+		return tokens, false
+	}
+
+	return tokens - 1, true
+}
+
+func perSecond(rate config.Rate) float64 {
+	return float64(rate.Count) / rate.Period.Seconds()
+}
+
+// untilFull is how long a bucket holding tokens takes to refill.
+func untilFull(tokens float64, rate config.Rate) time.Duration {
+	return seconds((float64(rate.Count) - tokens) / perSecond(rate))
+}
+
+// untilToken is how long a bucket holding tokens takes to have one to take.
+func untilToken(tokens float64, rate config.Rate) time.Duration {
+	return seconds((1 - tokens) / perSecond(rate))
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+
+	return time.Duration(s * float64(time.Second))
+}
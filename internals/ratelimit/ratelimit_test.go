@@ -0,0 +1,233 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// signToken returns an HS256 JWT with the given claims.
+func signToken(claims, secret string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// stores returns each store with a function moving its clock forward.
+func stores(t *testing.T) map[string]struct {
+	store   Store
+	advance func(time.Duration)
+} {
+	memory := NewMemory()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	memory.now = func() time.Time { return now }
+
+	server := miniredis.RunT(t)
+	server.SetTime(now)
+	redisStore, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatalf("Unable to connect to miniredis %s", err.Error())
+	}
+	t.Cleanup(func() { redisStore.Close() })
+	redisNow := now
+
+	return map[string]struct {
+		store   Store
+		advance func(time.Duration)
+	}{
+		"memory": {memory, func(d time.Duration) { now = now.Add(d) }},
+		"redis": {redisStore, func(d time.Duration) {
+			redisNow = redisNow.Add(d)
+			server.SetTime(redisNow)
+		}},
+	}
+}
+
+func TestStores(t *testing.T) {
+	rate := config.Rate{Count: 2, Period: time.Minute}
+
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			take := func() (float64, bool) {
+				left, ok, err := s.store.Take(ctx, "ratelimit:test", rate)
+				assert.NoError(t, err)
+				return left, ok
+			}
+
+			left, ok := take()
+			assert.True(t, ok)
+			assert.Equal(t, 1.0, left)
+			_, ok = take()
+			assert.True(t, ok)
+			_, ok = take()
+			assert.False(t, ok)
+
+			// a token every 30s
+			s.advance(15 * time.Second)
+			left, ok = take()
+			assert.False(t, ok)
+			assert.InDelta(t, 0.5, left, 0.001)
+			s.advance(15 * time.Second)
+			_, ok = take()
+			assert.True(t, ok)
+
+			// buckets refill to their capacity and no further
+			s.advance(time.Hour)
+			left, ok = take()
+			assert.True(t, ok)
+			assert.InDelta(t, 1.0, left, 0.001)
+
+			left, ok, err := s.store.Take(ctx, "ratelimit:other", rate)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, 1.0, left)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	sum := sha256.Sum256([]byte("secret"))
+	id := Identity{Keys: []string{"api_key", "user", "ip"}, APIKeys: []string{hex.EncodeToString(sum[:])}, TokenSecret: "s3cret"}
+	fallback := config.Rate{Count: 3, Period: time.Minute}
+	routes := map[string]config.Rate{
+		"POST /api/users/":      {Count: 1, Period: time.Minute},
+		"GET /api/users/events": {},
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		headers   map[string]string
+		status    int
+		limit     string
+		remaining string
+		reset     string
+		retry     string
+	}{
+		{name: "default rate", method: http.MethodGet, url: "/api/users/", status: http.StatusOK, limit: "3", remaining: "2", reset: "20"},
+		{name: "same client", method: http.MethodGet, url: "/api/users/", status: http.StatusOK, limit: "3", remaining: "1", reset: "40"},
+		{name: "other route shares the default bucket", method: http.MethodGet, url: "/api/users/1", status: http.StatusOK, limit: "3", remaining: "0", reset: "60"},
+		{name: "over the limit", method: http.MethodGet, url: "/api/users/", status: http.StatusTooManyRequests, limit: "3", remaining: "0", reset: "60", retry: "20"},
+		{name: "unlimited route", method: http.MethodGet, url: "/api/users/events", status: http.StatusOK},
+		{name: "route rate", method: http.MethodPost, url: "/api/users/", status: http.StatusCreated, limit: "1", remaining: "0", reset: "60"},
+		{name: "over the route rate", method: http.MethodPost, url: "/api/users/", status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+		{name: "api key", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"X-API-Key": "secret"}, status: http.StatusCreated, limit: "1", remaining: "0", reset: "60"},
+		{name: "same api key", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"X-API-Key": "secret"}, status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+		{name: "unknown api key falls back to the ip", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"X-API-Key": "rotated-1"}, status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+		{name: "rotating unknown api keys", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"X-API-Key": "rotated-2"}, status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+		{name: "api key as a bearer token", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"Authorization": "Bearer secret"}, status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+		{name: "user", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"Authorization": "Bearer " + signToken(`{"org":"acme","sub":"jane"}`, "s3cret")}, status: http.StatusCreated, limit: "1", remaining: "0", reset: "60"},
+		{name: "same user", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"Authorization": "Bearer " + signToken(`{"org":"acme","sub":"jane"}`, "s3cret")}, status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+		{name: "forged user token", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"Authorization": "Bearer " + signToken(`{"org":"acme","sub":"john"}`, "guess")}, status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+		{name: "unverified actor header", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"X-Actor": "john"}, status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+		{name: "forwarded ip from an untrusted proxy", method: http.MethodPost, url: "/api/users/", headers: map[string]string{"X-Forwarded-For": "203.0.113.7"}, status: http.StatusTooManyRequests, limit: "1", remaining: "0", reset: "60", retry: "60"},
+	}
+
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			r := gin.New()
+			if err := r.SetTrustedProxies(nil); err != nil {
+				t.Fatalf("Unable to distrust proxies %s", err.Error())
+			}
+			r.Use(Middleware(s.store, id, fallback, routes))
+			r.GET("/api/users/", func(c *gin.Context) { c.Status(http.StatusOK) })
+			r.GET("/api/users/:userID", func(c *gin.Context) { c.Status(http.StatusOK) })
+			r.GET("/api/users/events", func(c *gin.Context) { c.Status(http.StatusOK) })
+			r.POST("/api/users/", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+			for _, tt := range tests {
+				req := httptest.NewRequest(tt.method, tt.url, nil)
+				for k, v := range tt.headers {
+					req.Header.Set(k, v)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.status, w.Code, tt.name)
+				assert.Equal(t, tt.limit, w.Header().Get("RateLimit-Limit"), tt.name)
+				assert.Equal(t, tt.remaining, w.Header().Get("RateLimit-Remaining"), tt.name)
+				assert.Equal(t, tt.reset, w.Header().Get("RateLimit-Reset"), tt.name)
+				assert.Equal(t, tt.retry, w.Header().Get("Retry-After"), tt.name)
+				if tt.limit != "" {
+					assert.Equal(t, tt.limit+";w=60", w.Header().Get("RateLimit-Policy"), tt.name)
+				}
+				if tt.status == http.StatusTooManyRequests {
+					assert.JSONEq(t, `{"status":"error","message":"Too many requests, retry later."}`, w.Body.String(), tt.name)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("Unable to trust proxies %s", err.Error())
+	}
+	r.Use(Middleware(NewMemory(), Identity{Keys: []string{"ip"}}, config.Rate{Count: 1, Period: time.Minute}, nil))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		status     int
+	}{
+		{name: "client through the proxy", remoteAddr: "10.0.0.1:1234", forwarded: "203.0.113.7", status: http.StatusOK},
+		{name: "other client through the proxy", remoteAddr: "10.0.0.1:1234", forwarded: "203.0.113.8", status: http.StatusOK},
+		{name: "same client through another proxy", remoteAddr: "10.0.0.2:1234", forwarded: "203.0.113.7", status: http.StatusTooManyRequests},
+		{name: "untrusted proxy can't spoof a client", remoteAddr: "192.0.2.1:1234", forwarded: "203.0.113.9", status: http.StatusOK},
+		{name: "untrusted proxy is the client", remoteAddr: "192.0.2.1:1234", forwarded: "203.0.113.10", status: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set("X-Forwarded-For", tt.forwarded)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.status, w.Code, tt.name)
+	}
+}
+
+func TestMiddlewareFailsOpen(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	server := miniredis.RunT(t)
+	store, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatalf("Unable to connect to miniredis %s", err.Error())
+	}
+	t.Cleanup(func() { store.Close() })
+	server.Close()
+
+	r := gin.New()
+	r.Use(Middleware(store, Identity{Keys: []string{"ip"}}, config.Rate{Count: 1, Period: time.Minute}, nil))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// requests go through, unlimited, while the store is down
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
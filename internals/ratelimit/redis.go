@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript is take, run in Redis so instances sharing a bucket can't race.
+// It uses the server's clock, as instances' clocks may differ, and expires
+// buckets once they are full.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local per_second = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "at")
+local tokens = tonumber(bucket[1]) or capacity
+local at = tonumber(bucket[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - at) * per_second)
+local ok = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	ok = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "at", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / per_second * 1000) + 1000)
+return {ok, tostring(tokens)}
+`)
+
+// Redis keeps buckets in a Redis-compatible server shared by every instance
+// of the API.
+type Redis struct {
+	Client *redis.Client
+}
+
+// NewRedis connects lazily to the server at url, e.g.
+// redis://:password@localhost:6379/0.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Redis{Client: redis.NewClient(opts)}, nil
+}
+
+func (r *Redis) Take(ctx context.Context, key string, rate config.Rate) (float64, bool, error) {
+	result, err := takeScript.Run(ctx, r.Client, []string{key}, rate.Count, perSecond(rate)).Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	if len(result) != 2 {
+		return 0, false, fmt.Errorf("unexpected rate limit script result %v", result)
+	}
+
+	ok, _ := result[0].(int64)
+	tokens, _ := result[1].(string)
+	left, err := strconv.ParseFloat(tokens, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("unexpected rate limit script result %v", result)
+	}
+
+	return left, ok == 1, nil
+}
+
+// Ping checks the server answers.
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.Client.Ping(ctx).Err()
+}
+
+func (r *Redis) Close() error {
+	return r.Client.Close()
+}
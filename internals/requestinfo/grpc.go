@@ -0,0 +1,33 @@
+package requestinfo
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryServerInterceptor is Middleware for gRPC, reading the request ID and
+// actor from the x-request-id and x-actor metadata and returning the request
+// ID in the response header.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		var id string
+		if values := md.Get(RequestIDHeader); len(values) > 0 && len(values[0]) <= maxRequestIDLength {
+			id = values[0]
+		}
+		if id == "" {
+			id = newRequestID()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+		ctx = WithRequestID(ctx, id)
+		if values := md.Get(ActorHeader); len(values) > 0 && values[0] != "" {
+			ctx = WithActor(ctx, values[0])
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,132 @@
+package requestinfo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader carries the request ID. A caller-supplied value is kept
+	// so requests can be traced across services.
+	RequestIDHeader = "X-Request-ID"
+	// ActorHeader names the operator performing a request. Anyone can send
+	// it, so it is only a claim.
+	ActorHeader = "X-Actor"
+)
+
+// maxRequestIDLength bounds caller-supplied request IDs.
+const maxRequestIDLength = 128
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	actorKey
+	verifiedActorKey
+)
+
+// Middleware attaches a request ID and the actor to the request context and
+// echoes the request ID in the response.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		ctx := WithRequestID(c.Request.Context(), id)
+		if actor := c.GetHeader(ActorHeader); actor != "" {
+			ctx = WithActor(ctx, actor)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID of ctx, or "" outside a request.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithActor records who the work in ctx claims to be done by, e.g. the
+// X-Actor of a request.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// WithVerifiedActor records who the work in ctx is done by as established by
+// the API, e.g. the subject of a verified token or the operator of a local
+// command. It takes precedence over any claimed actor.
+func WithVerifiedActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, verifiedActorKey, actor)
+}
+
+// Actor returns who is performing the work in ctx: the verified actor, else
+// the claimed one of a request, "anonymous" for requests without either, and
+// "system" for background work.
+func Actor(ctx context.Context) string {
+	if ctx == nil {
+		return "system"
+	}
+	if actor, ok := ctx.Value(verifiedActorKey).(string); ok {
+		return actor
+	}
+	if actor, ok := ctx.Value(actorKey).(string); ok {
+		return actor
+	}
+
+	return unknownActor(ctx)
+}
+
+// VerifiedActor is Actor ignoring claims, for records that must not trust
+// the caller, like the audit log.
+func VerifiedActor(ctx context.Context) string {
+	if ctx == nil {
+		return "system"
+	}
+	if actor, ok := ctx.Value(verifiedActorKey).(string); ok {
+		return actor
+	}
+
+	return unknownActor(ctx)
+}
+
+// ClaimedActor returns the actor the caller claims to be in ctx, or "" if it
+// made no claim.
+func ClaimedActor(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+func unknownActor(ctx context.Context) string {
+	if RequestID(ctx) != "" {
+		return "anonymous"
+	}
+
+	return "system"
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
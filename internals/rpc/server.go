@@ -0,0 +1,328 @@
+// Package rpc serves the users.v1 gRPC API for internal callers, on top of
+// the same models as the REST handlers.
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"github.com/obimadu/ipc3-stage-2/internals/rpc/userspb"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// Page sizes of ListUsers.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// updatableFields are the User fields UpdateUser's mask may name.
+var updatableFields = map[string]bool{
+	"username":   true,
+	"email":      true,
+	"fullname":   true,
+	"attributes": true,
+}
+
+// NewServer returns a gRPC server with the UserService, the standard
+// grpc.health.v1 health service and reflection registered. Every call gets a
+// request ID and is scoped to the caller's organization as in the REST API.
+// The health server reports SERVING for "" and the UserService until it is
+// shut down.
+func NewServer(db *gorm.DB, cfg config.Tenant) (*grpc.Server, *health.Server) {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		requestinfo.UnaryServerInterceptor(),
+		tenant.UnaryServerInterceptor(db, cfg),
+	))
+
+	userspb.RegisterUserServiceServer(server, &Server{DB: db})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(userspb.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+
+	return server, healthServer
+}
+
+// Server implements userspb.UserServiceServer.
+type Server struct {
+	userspb.UnimplementedUserServiceServer
+	DB *gorm.DB
+}
+
+func (s *Server) db(ctx context.Context) *gorm.DB {
+	return s.DB.WithContext(ctx)
+}
+
+func (s *Server) CreateUser(ctx context.Context, req *userspb.CreateUserRequest) (*userspb.User, error) {
+	db := s.db(ctx)
+	if req.GetUser().GetUsername() == "" || req.GetUser().GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "You must specify both a username and an email.")
+	}
+
+	// status only changes through the lifecycle endpoints
+	user := models.Users{
+		Username: req.User.Username,
+		Email:    req.User.Email,
+		Fullname: req.User.Fullname,
+	}
+	if req.User.Attributes != nil {
+		user.Attributes = req.User.Attributes.AsMap()
+	}
+	if err := validateAttributes(db, user.Attributes); err != nil {
+		return nil, err
+	}
+
+	if err := models.CreateUser(db, &user); err != nil {
+		return nil, statusError(err)
+	}
+
+	return toProto(&user)
+}
+
+func (s *Server) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "UserID must be a positive interger.")
+	}
+
+	user, err := models.GetUserByID(s.db(ctx), uint(req.Id))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return toProto(user)
+}
+
+func (s *Server) GetUserByUsername(ctx context.Context, req *userspb.GetUserByUsernameRequest) (*userspb.User, error) {
+	if req.GetUsername() == "" {
+		return nil, status.Error(codes.InvalidArgument, "You must specify a username.")
+	}
+
+	user, err := models.GetUserByUsername(s.db(ctx), req.Username)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return toProto(user)
+}
+
+// ListUsers pages through users in ID order.
+func (s *Server) ListUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.ListUsersResponse, error) {
+	db := s.db(ctx)
+
+	pageSize := int(req.GetPageSize())
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize < 0 || pageSize > maxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must be between 1 and %d.", maxPageSize)
+	}
+	filter := models.UserFilter{Limit: pageSize + 1}
+
+	if req.GetPageToken() != "" {
+		id, err := models.DecodeUserCursor(req.PageToken)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "page_token not valid.")
+		}
+		filter.AfterID = id
+	}
+
+	if req.GetStatus() != "" {
+		if !models.ValidStatus(req.Status) {
+			return nil, status.Error(codes.InvalidArgument, "Status filter not valid.")
+		}
+		filter.Status = req.Status
+	}
+
+	if len(req.GetAttributes()) > 0 {
+		defs, err := models.GetAttributeDefinitions(db)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		filter.Attributes, err = models.ParseAttributeFilters(defs, req.Attributes)
+		if err != nil {
+			return nil, statusError(err)
+		}
+	}
+
+	users, err := models.GetAll(db, filter)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &userspb.ListUsersResponse{}
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		resp.NextPageToken = models.EncodeUserCursor(users[pageSize-1].ID)
+	}
+	for i := range users {
+		user, err := toProto(&users[i])
+		if err != nil {
+			return nil, err
+		}
+		resp.Users = append(resp.Users, user)
+	}
+
+	return resp, nil
+}
+
+// UpdateUser sets the fields named by the update mask, including to empty
+// values, or every non-empty field without one.
+func (s *Server) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (*userspb.User, error) {
+	db := s.db(ctx)
+	if req.GetUser().GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "UserID must be a positive interger.")
+	}
+	id := uint(req.User.Id)
+
+	var attributes models.Attributes
+	if req.User.Attributes != nil {
+		attributes = req.User.Attributes.AsMap()
+	}
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		user := models.Users{
+			Username:   req.User.Username,
+			Email:      req.User.Email,
+			Fullname:   req.User.Fullname,
+			Attributes: attributes,
+		}
+		// attributes sent on update replace the whole set
+		if attributes != nil {
+			if err := validateAttributes(db, attributes); err != nil {
+				return nil, err
+			}
+		}
+		if err := models.UpdateUserByID(db, id, user); err != nil {
+			return nil, statusError(err)
+		}
+	} else {
+		fields := make(map[string]any, len(paths))
+		for _, path := range paths {
+			if !updatableFields[path] {
+				return nil, status.Errorf(codes.InvalidArgument, "Field %s can't be updated.", path)
+			}
+		}
+		for _, path := range paths {
+			switch path {
+			case "username":
+				if req.User.Username == "" {
+					return nil, status.Error(codes.InvalidArgument, "Username can't be empty.")
+				}
+				fields["username"] = req.User.Username
+			case "email":
+				if req.User.Email == "" {
+					return nil, status.Error(codes.InvalidArgument, "Email can't be empty.")
+				}
+				fields["email"] = req.User.Email
+			case "fullname":
+				fields["fullname"] = req.User.Fullname
+			case "attributes":
+				if err := validateAttributes(db, attributes); err != nil {
+					return nil, err
+				}
+				fields["attributes"] = attributes
+			}
+		}
+		if err := models.UpdateUserFieldsByID(db, id, fields); err != nil {
+			return nil, statusError(err)
+		}
+	}
+
+	user, err := models.GetUserByID(db, id)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return toProto(user)
+}
+
+func (s *Server) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*emptypb.Empty, error) {
+	db := s.db(ctx)
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "UserID must be a positive interger.")
+	}
+
+	if err := models.DeleteUserByID(db, uint(req.Id)); err != nil {
+		return nil, statusError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func validateAttributes(db *gorm.DB, attrs models.Attributes) error {
+	defs, err := models.GetAttributeDefinitions(db)
+	if err != nil {
+		return statusError(err)
+	}
+
+	return statusError(models.ValidateAttributes(defs, attrs))
+}
+
+// statusError maps an error from models to a gRPC status carrying the
+// message the REST API reports for it.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var attrErr *models.AttributeError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "User does not exist.")
+	case errors.As(err, &attrErr):
+		return status.Error(codes.InvalidArgument, "Attributes not valid: "+attrErr.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	switch models.UniqueViolation(err) {
+	case "email":
+		return status.Error(codes.AlreadyExists, "Email has been taken!")
+	case "username":
+		return status.Error(codes.AlreadyExists, "Username has been taken!")
+	}
+
+	return status.Error(codes.Internal, "User operation failed: "+err.Error())
+}
+
+func toProto(user *models.Users) (*userspb.User, error) {
+	pb := &userspb.User{
+		Id:       uint32(user.ID),
+		Username: user.Username,
+		Email:    user.Email,
+		Fullname: user.Fullname,
+		Status:   user.Status,
+	}
+	if user.SuspendedUntil != nil {
+		pb.SuspendedUntil = timestamppb.New(*user.SuspendedUntil)
+	}
+	if user.Attributes != nil {
+		attributes, err := structpb.NewStruct(user.Attributes)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to encode attributes: "+err.Error())
+		}
+		pb.Attributes = attributes
+	}
+
+	return pb, nil
+}
@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/rpc/userspb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dial serves NewServer over an in-memory connection.
+func dial(t *testing.T) (*grpc.ClientConn, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unable to init mock db %s", err.Error())
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: dbMock}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to db; gorm; %s", err.Error())
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	server, _ := NewServer(db, config.Tenant{})
+	go server.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Unable to dial gRPC server %s", err.Error())
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+		dbMock.Close()
+	})
+
+	return conn, mock
+}
+
+func TestHealthCheckIsNotScoped(t *testing.T) {
+	conn, _ := dial(t)
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: userspb.UserService_ServiceDesc.ServiceName,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
+
+func TestUserServiceErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		org         string
+		mockSQL     func(mock sqlmock.Sqlmock)
+		call        func(ctx context.Context, client userspb.UserServiceClient) error
+		wantCode    codes.Code
+		wantMessage string
+	}{
+		{
+			name: "Missing organization",
+			call: func(ctx context.Context, client userspb.UserServiceClient) error {
+				_, err := client.GetUser(ctx, &userspb.GetUserRequest{Id: 1})
+				return err
+			},
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "You must specify an organization.",
+		},
+		{
+			name: "User not found",
+			org:  "acme",
+			mockSQL: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			call: func(ctx context.Context, client userspb.UserServiceClient) error {
+				_, err := client.GetUser(ctx, &userspb.GetUserRequest{Id: 7})
+				return err
+			},
+			wantCode:    codes.NotFound,
+			wantMessage: "User does not exist.",
+		},
+		{
+			name: "Duplicate username",
+			org:  "acme",
+			mockSQL: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "attribute_definitions"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "users"`).
+					WillReturnError(errors.New(`ERROR: duplicate key value violates unique constraint "idx_users_org_username" (SQLSTATE 23505)`))
+				mock.ExpectRollback()
+			},
+			call: func(ctx context.Context, client userspb.UserServiceClient) error {
+				_, err := client.CreateUser(ctx, &userspb.CreateUserRequest{
+					User: &userspb.User{Username: "obi", Email: "obi@example.com"},
+				})
+				return err
+			},
+			wantCode:    codes.AlreadyExists,
+			wantMessage: "Username has been taken!",
+		},
+		{
+			name: "Field mask names a read-only field",
+			org:  "acme",
+			call: func(ctx context.Context, client userspb.UserServiceClient) error {
+				_, err := client.UpdateUser(ctx, &userspb.UpdateUserRequest{
+					User:       &userspb.User{Id: 1, Status: "locked"},
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"fullname", "status"}},
+				})
+				return err
+			},
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "Field status can't be updated.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, mock := dial(t)
+
+			ctx := context.Background()
+			if test.org != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-organization", test.org)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE slug = \$1`).WithArgs(test.org, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).AddRow(1, "Acme", test.org))
+			}
+			if test.mockSQL != nil {
+				test.mockSQL(mock)
+			}
+
+			err := test.call(ctx, userspb.NewUserServiceClient(conn))
+			assert.Equal(t, test.wantCode, status.Code(err))
+			assert.Equal(t, test.wantMessage, status.Convert(err).Message())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,5 @@
+// Package userspb holds the generated protobuf and gRPC code of the users.v1
+// API defined in users.proto.
+package userspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative users.proto
@@ -0,0 +1,105 @@
+package seed
+
+// locale holds the names people commonly have in one place. Names are
+// written as people there write them; usernames and emails use their
+// ASCII transliteration, or roman for scripts that don't transliterate
+// letter by letter.
+type locale struct {
+	first []name
+	last  []name
+	// familyFirst locales write the family name first, e.g. 山田 太郎.
+	familyFirst bool
+	// separator joins the two names; empty for none.
+	separator string
+}
+
+type name struct {
+	native string
+	// roman is the ASCII spelling, when it isn't the transliteration of
+	// native.
+	roman string
+}
+
+func names(list ...string) []name {
+	out := make([]name, len(list))
+	for i, n := range list {
+		out[i] = name{native: n}
+	}
+
+	return out
+}
+
+var locales = map[string]*locale{
+	"en_US": {
+		first: names("James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda", "David", "Elizabeth",
+			"William", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Christopher", "Karen"),
+		last: names("Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+			"Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin"),
+		separator: " ",
+	},
+	"en_GB": {
+		first: names("Oliver", "Olivia", "George", "Amelia", "Harry", "Isla", "Noah", "Ava", "Jack", "Emily",
+			"Leo", "Sophia", "Arthur", "Grace", "Muhammad", "Lily", "Oscar", "Freya", "Charlie", "Florence"),
+		last: names("Smith", "Jones", "Taylor", "Brown", "Williams", "Wilson", "Johnson", "Davies", "Patel", "Robinson",
+			"Wright", "Thompson", "Evans", "Walker", "White", "Roberts", "Green", "Hall", "Wood", "Clarke"),
+		separator: " ",
+	},
+	"de_DE": {
+		first: names("Lukas", "Anna", "Jonas", "Lea", "Leon", "Hannah", "Finn", "Lena", "Paul", "Mia",
+			"Felix", "Sophie", "Maximilian", "Marie", "Jürgen", "Jörg", "Björn", "Käthe", "Sören", "Lötte"),
+		last: names("Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann",
+			"Schäfer", "Koch", "Bauer", "Richter", "Klein", "Wolf", "Schröder", "Neumann", "Schwarz", "Zimmermann"),
+		separator: " ",
+	},
+	"fr_FR": {
+		first: names("Gabriel", "Louise", "Raphaël", "Jade", "Léo", "Ambre", "Louis", "Emma", "Noé", "Alice",
+			"Arthur", "Chloé", "Jules", "Léa", "Adam", "Zoé", "Hugo", "Inès", "Théo", "Mélanie"),
+		last: names("Martin", "Bernard", "Thomas", "Petit", "Robert", "Richard", "Durand", "Dubois", "Moreau", "Laurent",
+			"Simon", "Michel", "Lefèvre", "Leroy", "Roux", "David", "Bertrand", "Morel", "Fournier", "Girard"),
+		separator: " ",
+	},
+	"es_ES": {
+		first: names("Hugo", "Lucía", "Martín", "Sofía", "Pablo", "Martina", "Mateo", "María", "Lucas", "Julia",
+			"Leo", "Paula", "Daniel", "Valeria", "Alejandro", "Emma", "Manuel", "Daniela", "Álvaro", "Carmen"),
+		last: names("García", "Rodríguez", "González", "Fernández", "López", "Martínez", "Sánchez", "Pérez", "Gómez", "Martín",
+			"Jiménez", "Ruiz", "Hernández", "Díaz", "Moreno", "Muñoz", "Álvarez", "Romero", "Alonso", "Gutiérrez"),
+		separator: " ",
+	},
+	"pt_BR": {
+		first: names("Miguel", "Helena", "Arthur", "Alice", "Gael", "Laura", "Théo", "Maria", "Heitor", "Valentina",
+			"Ravi", "Heloísa", "Davi", "Luísa", "Bernardo", "Cecília", "Gabriel", "Lívia", "João", "Júlia"),
+		last: names("Silva", "Santos", "Oliveira", "Souza", "Rodrigues", "Ferreira", "Alves", "Pereira", "Lima", "Gomes",
+			"Costa", "Ribeiro", "Martins", "Carvalho", "Araújo", "Melo", "Barbosa", "Rocha", "Conceição", "Gonçalves"),
+		separator: " ",
+	},
+	"it_IT": {
+		first: names("Leonardo", "Sofia", "Francesco", "Aurora", "Alessandro", "Giulia", "Lorenzo", "Ginevra", "Mattia", "Vittoria",
+			"Tommaso", "Beatrice", "Gabriele", "Alice", "Riccardo", "Ludovica", "Andrea", "Emma", "Niccolò", "Nicolò"),
+		last: names("Rossi", "Russo", "Ferrari", "Esposito", "Bianchi", "Romano", "Colombo", "Ricci", "Marino", "Greco",
+			"Bruno", "Gallo", "Conti", "De Luca", "Mancini", "Costa", "Giordano", "Rizzo", "Lombardi", "Moretti"),
+		separator: " ",
+	},
+	"yo_NG": {
+		first: names("Adébáyọ̀", "Adéọlá", "Olúwaṣeun", "Fúnmiláyọ̀", "Bámidélé", "Títílayọ̀", "Ayọ̀dèjì", "Kẹ́hìndé", "Táíwò", "Ìdòwú",
+			"Oláolúwa", "Yéwándé", "Tèmítọ́pẹ́", "Ọláwálé", "Ṣadé", "Bùkọ́lá", "Ìfẹ́olúwa", "Damilọ́lá", "Túndé", "Ayọ̀mídé"),
+		last: names("Adébáyọ̀", "Ọládipọ̀", "Adéyẹmí", "Ògúnlẹ́yẹ", "Àjàyí", "Babátúndé", "Ọlátúnjí", "Adéwálé", "Akínọlá", "Fáṣọlá",
+			"Ọdúyẹmí", "Ògúndélé", "Adéléké", "Ìṣọ̀lá", "Akínwándé", "Olúwọlé", "Bákàrè", "Ọ̀ṣúntókun", "Adékúnlé", "Òkéowó"),
+		separator: " ",
+	},
+	"ja_JP": {
+		first: []name{
+			{"太郎", "taro"}, {"花子", "hanako"}, {"蓮", "ren"}, {"陽葵", "himari"}, {"湊", "minato"},
+			{"凛", "rin"}, {"大翔", "hiroto"}, {"結菜", "yuina"}, {"悠真", "yuma"}, {"葵", "aoi"},
+			{"陽翔", "haruto"}, {"芽依", "mei"}, {"樹", "itsuki"}, {"紬", "tsumugi"}, {"颯", "hayate"},
+			{"咲良", "sakura"}, {"健太", "kenta"}, {"美咲", "misaki"}, {"翔太", "shota"}, {"彩", "aya"},
+		},
+		last: []name{
+			{"佐藤", "sato"}, {"鈴木", "suzuki"}, {"高橋", "takahashi"}, {"田中", "tanaka"}, {"伊藤", "ito"},
+			{"渡辺", "watanabe"}, {"山本", "yamamoto"}, {"中村", "nakamura"}, {"小林", "kobayashi"}, {"加藤", "kato"},
+			{"吉田", "yoshida"}, {"山田", "yamada"}, {"佐々木", "sasaki"}, {"山口", "yamaguchi"}, {"松本", "matsumoto"},
+			{"井上", "inoue"}, {"木村", "kimura"}, {"林", "hayashi"}, {"斎藤", "saito"}, {"清水", "shimizu"},
+		},
+		familyFirst: true,
+		separator:   " ",
+	},
+}
@@ -0,0 +1,152 @@
+// Package seed generates plausible fake users for demos and load tests.
+// The same seed always yields the same users, on every platform and Go
+// version.
+package seed
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"golang.org/x/text/unicode/norm"
+)
+
+// domains are reserved for examples (RFC 2606), so seeded emails can never
+// reach a real mailbox.
+var domains = []string{"example.com", "example.org", "example.net"}
+
+// Locales returns the supported locale names, sorted.
+func Locales() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Generator produces users with unique usernames and emails.
+type Generator struct {
+	rng     *rand.Rand
+	locales []*locale
+	// taken holds the usernames given out; next is the last number tried
+	// for each stem.
+	taken map[string]bool
+	next  map[string]int
+}
+
+// NewGenerator returns a generator for the given seed that mixes users from
+// the named locales, or from every locale for "all".
+func NewGenerator(seed uint64, localeNames ...string) (*Generator, error) {
+	if len(localeNames) == 1 && localeNames[0] == "all" {
+		localeNames = Locales()
+	}
+	if len(localeNames) == 0 {
+		return nil, fmt.Errorf("seed: no locales")
+	}
+
+	g := &Generator{
+		// PCG's output is specified, unlike the default source's
+		rng:   rand.New(rand.NewPCG(seed, seed)),
+		taken: map[string]bool{},
+		next:  map[string]int{},
+	}
+	for _, name := range localeNames {
+		l, ok := locales[name]
+		if !ok {
+			return nil, fmt.Errorf("seed: unknown locale %q, available locales: %s", name, strings.Join(Locales(), ", "))
+		}
+		g.locales = append(g.locales, l)
+	}
+
+	return g, nil
+}
+
+// Users returns the next n users.
+func (g *Generator) Users(n int) []models.Users {
+	users := make([]models.Users, n)
+	for i := range users {
+		users[i] = g.User()
+	}
+
+	return users
+}
+
+// User returns the next user. Its status is active; the organization is
+// left for the tenant plugin to assign.
+func (g *Generator) User() models.Users {
+	l := g.locales[g.rng.IntN(len(g.locales))]
+	first := l.first[g.rng.IntN(len(l.first))]
+	last := l.last[g.rng.IntN(len(l.last))]
+
+	fullname := first.native + l.separator + last.native
+	if l.familyFirst {
+		fullname = last.native + l.separator + first.native
+	}
+
+	username := g.username(ascii(first), ascii(last))
+
+	return models.Users{
+		Username: username,
+		Email:    username + "@" + domains[g.rng.IntN(len(domains))],
+		Fullname: fullname,
+		Status:   models.StatusActive,
+	}
+}
+
+// username picks one of the usual patterns for the name, numbering it when
+// it was already given out.
+func (g *Generator) username(first, last string) string {
+	var stem string
+	switch g.rng.IntN(5) {
+	case 0:
+		stem = first + "." + last
+	case 1:
+		stem = first + last
+	case 2:
+		stem = first[:1] + last
+	case 3:
+		stem = first + "_" + last
+	default:
+		stem = first + "." + last + strconv.Itoa(10+g.rng.IntN(90))
+	}
+
+	// a numbered name may already be taken as another name's stem
+	for n := g.next[stem] + 1; ; n++ {
+		candidate := stem
+		if n > 1 {
+			candidate += strconv.Itoa(n)
+		}
+		if !g.taken[candidate] {
+			g.taken[candidate] = true
+			g.next[stem] = n
+			return candidate
+		}
+	}
+}
+
+var umlauts = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// ascii lowercases a name and spells it in ASCII letters: the roman
+// spelling if it has one, otherwise the name without accents, with German
+// umlauts and ß written out.
+func ascii(n name) string {
+	if n.roman != "" {
+		return n.roman
+	}
+
+	// NFD splits accents off their letters, so they are dropped with
+	// spaces and hyphens
+	var b strings.Builder
+	for _, r := range norm.NFD.String(umlauts.Replace(strings.ToLower(n.native))) {
+		if r >= 'a' && r <= 'z' {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package seed
+
+import (
+	"testing"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		seed    uint64
+		locales []string
+		wantErr string
+	}{
+		{name: "One locale", seed: 1, locales: []string{"en_US"}},
+		{name: "Mixed locales", seed: 42, locales: []string{"de_DE", "ja_JP", "yo_NG"}},
+		{name: "Every locale", seed: 7, locales: []string{"all"}},
+		{name: "Unknown locale", seed: 1, locales: []string{"xx_XX"}, wantErr: `seed: unknown locale "xx_XX", available locales: de_DE, en_GB, en_US, es_ES, fr_FR, it_IT, ja_JP, pt_BR, yo_NG`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := NewGenerator(test.seed, test.locales...)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			users := g.Users(5000)
+
+			// the same seed gives the same users
+			again, _ := NewGenerator(test.seed, test.locales...)
+			assert.Equal(t, users, again.Users(5000))
+
+			usernames := map[string]bool{}
+			emails := map[string]bool{}
+			for _, user := range users {
+				assert.Regexp(t, `^[a-z][a-z0-9._]*$`, user.Username)
+				assert.Regexp(t, `^[a-z0-9._]+@example\.(com|org|net)$`, user.Email)
+				assert.NotEmpty(t, user.Fullname)
+				assert.Equal(t, models.StatusActive, user.Status)
+				assert.False(t, usernames[user.Username], "duplicate username %s", user.Username)
+				assert.False(t, emails[user.Email], "duplicate email %s", user.Email)
+				usernames[user.Username] = true
+				emails[user.Email] = true
+			}
+		})
+	}
+}
+
+func TestSeedsDiffer(t *testing.T) {
+	a, _ := NewGenerator(1, "en_US")
+	b, _ := NewGenerator(2, "en_US")
+
+	assert.NotEqual(t, a.Users(10), b.Users(10))
+}
+
+func TestASCII(t *testing.T) {
+	tests := []struct {
+		name name
+		want string
+	}{
+		{name{native: "Müller"}, "mueller"},
+		{name{native: "Käthe"}, "kaethe"},
+		{name{native: "Lefèvre"}, "lefevre"},
+		{name{native: "Gonçalves"}, "goncalves"},
+		{name{native: "De Luca"}, "deluca"},
+		{name{native: "Ọ̀ṣúntókun"}, "osuntokun"},
+		{name{native: "山田", roman: "yamada"}, "yamada"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			assert.Equal(t, test.want, ascii(test.name))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Disk stores blobs as files under Root. The content type is kept in a
+// sidecar file next to each blob.
+type Disk struct {
+	Root string
+}
+
+func (d *Disk) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := writeFile(path+".type", []byte(contentType)); err != nil {
+		return err
+	}
+
+	return writeFile(path, data)
+}
+
+func (d *Disk) Get(ctx context.Context, key string) ([]byte, string, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType, err := os.ReadFile(path + ".type")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, "", err
+	}
+
+	return data, string(contentType), nil
+}
+
+func (d *Disk) Delete(ctx context.Context, key string) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range []string{path, path + ".type"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ping fails when Root can't be created or isn't a directory.
+func (d *Disk) Ping(ctx context.Context) error {
+	return os.MkdirAll(d.Root, 0o755)
+}
+
+// path maps key below Root, refusing keys that would escape it.
+func (d *Disk) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", errors.New("storage: invalid key")
+	}
+
+	return filepath.Join(d.Root, filepath.FromSlash(clean)), nil
+}
+
+// writeFile writes through a temporary file so readers never see a partial
+// blob.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3 stores blobs in a bucket of an S3-compatible service (AWS S3, MinIO,
+// ...) using path-style requests signed with AWS Signature Version 4.
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return s3Error(resp)
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, string, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if err := s3Error(resp); err != nil {
+		return nil, "", err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = s3Error(resp)
+	if err == ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// Ping checks that the bucket exists and the credentials may use it.
+func (s *S3) Ping(ctx context.Context) error {
+	resp, err := s.do(ctx, http.MethodHead, "", nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("storage: s3 bucket %s does not exist", s.Bucket)
+	}
+
+	return s3Error(resp)
+}
+
+func s3Error(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("storage: s3 responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	default:
+		return nil
+	}
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path = "/" + s.Bucket + "/" + strings.TrimPrefix(key, "/")
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return client.Do(req)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headerValues := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		signedHeaders = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+		headerValues["content-type"] = ct
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		canonicalHeaders.WriteString(h + ":" + headerValues[h] + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a MinIO-style stand-in holding objects in memory. It rejects
+// requests that are not signed for its credentials or whose payload hash does
+// not match the body.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = fakeObject{data: body, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		obj, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Write(obj.data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: map[string]fakeObject{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3 := &S3{
+		Endpoint:  server.URL,
+		Region:    "us-east-1",
+		Bucket:    "avatars",
+		AccessKey: "minio",
+		SecretKey: "minio123",
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, s3.Ping(ctx))
+
+	err := s3.Put(ctx, "a/b.png", []byte("png"), "image/png")
+	assert.NoError(t, err)
+	assert.Contains(t, fake.objects, "/avatars/a/b.png")
+
+	data, contentType, err := s3.Get(ctx, "a/b.png")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("png"), data)
+	assert.Equal(t, "image/png", contentType)
+
+	assert.NoError(t, s3.Delete(ctx, "a/b.png"))
+	_, _, err = s3.Get(ctx, "a/b.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	s3.AccessKey = "someone-else"
+	assert.Error(t, s3.Put(ctx, "a/b.png", []byte("png"), "image/png"))
+	assert.Error(t, s3.Ping(ctx))
+}
+
+func TestDisk(t *testing.T) {
+	disk := &Disk{Root: t.TempDir()}
+	ctx := context.Background()
+
+	assert.NoError(t, disk.Ping(ctx))
+
+	assert.NoError(t, disk.Put(ctx, "a/b.png", []byte("png"), "image/png"))
+
+	data, contentType, err := disk.Get(ctx, "a/b.png")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("png"), data)
+	assert.Equal(t, "image/png", contentType)
+
+	assert.NoError(t, disk.Delete(ctx, "a/b.png"))
+	_, _, err = disk.Get(ctx, "a/b.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Error(t, disk.Put(ctx, "../escape", []byte("x"), "text/plain"))
+}
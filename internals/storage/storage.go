@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+)
+
+// ErrNotFound is returned when a blob does not exist.
+var ErrNotFound = errors.New("storage: blob not found")
+
+// Blobs stores opaque objects by key.
+type Blobs interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (data []byte, contentType string, err error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Avatars holds uploaded avatars and their thumbnails.
+var Avatars Blobs
+
+// InitAvatars sets up avatar storage from cfg.Storage ("disk" or "s3").
+func InitAvatars(cfg config.Avatars) {
+	switch cfg.Storage {
+	case "s3":
+		Avatars = &S3{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		}
+		slog.Info("Storing avatars in S3")
+	default:
+		Avatars = &Disk{Root: cfg.DiskPath}
+		slog.Info("Storing avatars on disk")
+	}
+}
@@ -0,0 +1,56 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// UnaryServerInterceptor is Middleware for gRPC. The slug is taken from the
+// authorization and x-organization metadata or the :authority subdomain.
+// Calls to the grpc.* system services, such as health checks and
+// reflection, are not scoped.
+func UnaryServerInterceptor(db *gorm.DB, cfg config.Tenant) grpc.UnaryServerInterceptor {
+	baseDomain, secret := cfg.BaseDomain, cfg.TokenSecret
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if strings.HasPrefix(info.FullMethod, "/grpc.") {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		claims, err := resolveClaims(firstValue(md, "authorization"), firstValue(md, HeaderName), firstValue(md, ":authority"), baseDomain, secret)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "Organization token not valid.")
+		}
+		if claims.Org == "" {
+			return nil, status.Error(codes.InvalidArgument, "You must specify an organization.")
+		}
+
+		org, err := models.GetOrganizationBySlug(db.WithContext(ctx), claims.Org)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, status.Error(codes.NotFound, "Organization does not exist.")
+			}
+			return nil, status.Error(codes.Internal, "Failed to resolve organization.")
+		}
+
+		return handler(newRequestContext(ctx, org.ID, claims), req)
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
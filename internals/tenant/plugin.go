@@ -0,0 +1,77 @@
+package tenant
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoTenant is returned for queries against tenant-owned tables that were
+// not scoped to an organization.
+var ErrNoTenant = errors.New("tenant: query is not scoped to an organization")
+
+const tenantField = "OrganizationID"
+
+// Plugin scopes every statement on a model with an OrganizationID field to
+// the organization in the statement context, so a handler that forgets to
+// filter still cannot read or write another tenant's rows.
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "tenant"
+}
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:begin_transaction").Register("tenant:create", assignTenant); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("tenant:query", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register("tenant:update", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:begin_transaction").Register("tenant:delete", scopeTenant); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("tenant:row", scopeTenant)
+}
+
+func assignTenant(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.LookUpField(tenantField) == nil {
+		return
+	}
+	if isUnscoped(db.Statement.Context) {
+		return
+	}
+
+	orgID, ok := FromContext(db.Statement.Context)
+	if !ok {
+		db.AddError(ErrNoTenant)
+		return
+	}
+
+	db.Statement.SetColumn(tenantField, orgID, true)
+}
+
+func scopeTenant(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	field := db.Statement.Schema.LookUpField(tenantField)
+	if field == nil || isUnscoped(db.Statement.Context) {
+		return
+	}
+
+	orgID, ok := FromContext(db.Statement.Context)
+	if !ok {
+		db.AddError(ErrNoTenant)
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: orgID},
+	}})
+}
@@ -0,0 +1,90 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func InitDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unable to init mock db %s", err.Error())
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	db, err := gorm.Open(postgres.New(
+		postgres.Config{
+			Conn: dbMock,
+		}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to db; gorm; %s", err.Error())
+	}
+
+	if err := db.Use(Plugin{}); err != nil {
+		t.Fatalf("Unable to register tenant plugin %s", err.Error())
+	}
+
+	return db, mock
+}
+
+func TestPluginScopesQueries(t *testing.T) {
+	db, mock := InitDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE username = \$1 AND "users"."organization_id" = \$2`).
+		WithArgs("obi", 7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "organization_id", "username", "email"}).
+			AddRow(1, 7, "obi", "obi@example.com"))
+
+	user, err := models.GetUserByUsername(db.WithContext(NewContext(context.Background(), 7)), "obi")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), user.OrganizationID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPluginRejectsUnscopedQueries(t *testing.T) {
+	db, mock := InitDB(t)
+
+	_, err := models.GetAll(db, models.UserFilter{})
+	assert.True(t, errors.Is(err, ErrNoTenant))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	err = models.CreateUser(db, &models.Users{Username: "obi", Email: "obi@example.com"})
+	assert.True(t, errors.Is(err, ErrNoTenant))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPluginAssignsTenantOnCreate(t *testing.T) {
+	db, mock := InitDB(t)
+
+	user := models.Users{Username: "obi", Email: "obi@example.com"}
+	stmt := db.WithContext(NewContext(context.Background(), 7)).
+		Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true}).
+		Create(&user).Statement
+
+	assert.NoError(t, stmt.Error)
+	assert.Contains(t, stmt.SQL.String(), `"organization_id"`)
+	assert.Equal(t, uint(7), user.OrganizationID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPluginIgnoresUnscopedModels(t *testing.T) {
+	db, mock := InitDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE slug = \$1`).
+		WithArgs("acme", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).AddRow(1, "Acme", "acme"))
+
+	org, err := models.GetOrganizationBySlug(db, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", org.Slug)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,226 @@
+package tenant
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"gorm.io/gorm"
+)
+
+// adminActor is the verified actor of requests authorized by
+// AdminMiddleware.
+const adminActor = "admin"
+
+// HeaderName carries the organization slug when no token secret is
+// configured.
+const HeaderName = "X-Organization"
+
+type contextKey int
+
+const (
+	tenantKey contextKey = iota
+	unscopedKey
+)
+
+// NewContext returns a copy of ctx scoped to the given organization.
+func NewContext(ctx context.Context, orgID uint) context.Context {
+	return context.WithValue(ctx, tenantKey, orgID)
+}
+
+// FromContext returns the organization ctx is scoped to, if any.
+func FromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	orgID, ok := ctx.Value(tenantKey).(uint)
+	return orgID, ok
+}
+
+// WithoutScope marks ctx as a system operation that may touch every tenant,
+// e.g. migrations. On a request path, only use it for data that belongs to no
+// one, like the event IDs a stream skips over.
+func WithoutScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey, true)
+}
+
+func isUnscoped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	unscoped, _ := ctx.Value(unscopedKey).(bool)
+	return unscoped
+}
+
+// Middleware resolves the organization for every request and scopes the
+// request context to it. When cfg.TokenSecret is set, the slug is only taken
+// from the "org" claim of a bearer token signed with it, as anyone can send
+// a header or subdomain. Otherwise it is taken from the X-Organization header
+// or the subdomain of cfg.BaseDomain.
+func Middleware(db *gorm.DB, cfg config.Tenant) gin.HandlerFunc {
+	baseDomain, secret := cfg.BaseDomain, cfg.TokenSecret
+
+	return func(c *gin.Context) {
+		claims, err := resolveClaims(c.GetHeader("Authorization"), c.GetHeader(HeaderName), c.Request.Host, baseDomain, secret)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Organization token not valid.",
+			})
+			return
+		}
+		if claims.Org == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "You must specify an organization.",
+			})
+			return
+		}
+
+		if scope(c, db, claims) {
+			c.Next()
+		}
+	}
+}
+
+// scope scopes the request to the organization claims name, reporting
+// whether it exists.
+func scope(c *gin.Context, db *gorm.DB, claims Claims) bool {
+	org, err := models.GetOrganizationBySlug(db.WithContext(c.Request.Context()), claims.Org)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Organization does not exist.",
+			})
+			return false
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to resolve organization.",
+			"error": gin.H{
+				"error": err.Error(),
+			},
+		})
+		return false
+	}
+
+	c.Request = c.Request.WithContext(newRequestContext(c.Request.Context(), org.ID, claims))
+	return true
+}
+
+// resolveClaims picks the organization slug from a request's Authorization
+// and X-Organization headers and its host. With a secret, only a valid token
+// naming an organization is accepted, and its subject is verified too.
+// Otherwise only Org is set.
+func resolveClaims(auth, header, host, baseDomain, secret string) (Claims, error) {
+	if secret != "" {
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok {
+			return Claims{}, errInvalidToken
+		}
+		claims, err := VerifyToken(token, secret)
+		if err != nil {
+			return Claims{}, err
+		}
+		if claims.Org == "" {
+			return Claims{}, errInvalidToken
+		}
+		return claims, nil
+	}
+
+	if slug := strings.TrimSpace(header); slug != "" {
+		return Claims{Org: slug}, nil
+	}
+
+	if baseDomain != "" {
+		if i := strings.LastIndex(host, ":"); i != -1 && !strings.Contains(host[i:], "]") {
+			host = host[:i]
+		}
+		if sub, ok := strings.CutSuffix(host, "."+baseDomain); ok && !strings.Contains(sub, ".") {
+			return Claims{Org: sub}, nil
+		}
+	}
+
+	return Claims{}, nil
+}
+
+// newRequestContext scopes ctx to the organization and, when the token named
+// one, records its subject as the verified actor.
+func newRequestContext(ctx context.Context, orgID uint, claims Claims) context.Context {
+	if claims.Subject != "" {
+		ctx = requestinfo.WithVerifiedActor(ctx, claims.Subject)
+	}
+
+	return NewContext(ctx, orgID)
+}
+
+// AdminMiddleware only lets requests carrying cfg.AdminToken as a bearer
+// token through, for routes spanning every organization. Without an admin
+// token, they are disabled.
+func AdminMiddleware(cfg config.Tenant) gin.HandlerFunc {
+	adminToken := cfg.AdminToken
+
+	return func(c *gin.Context) {
+		if authorizeAdmin(c, adminToken) {
+			c.Next()
+		}
+	}
+}
+
+// OrganizationAdminMiddleware lets requests carrying cfg.AdminToken through
+// like AdminMiddleware, for routes that change how one organization is set
+// up. As the admin token names no organization, the request is scoped to the
+// one in the X-Organization header or subdomain, even with a token secret.
+func OrganizationAdminMiddleware(db *gorm.DB, cfg config.Tenant) gin.HandlerFunc {
+	adminToken, baseDomain := cfg.AdminToken, cfg.BaseDomain
+
+	return func(c *gin.Context) {
+		if !authorizeAdmin(c, adminToken) {
+			return
+		}
+
+		claims, _ := resolveClaims("", c.GetHeader(HeaderName), c.Request.Host, baseDomain, "")
+		if claims.Org == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "You must specify an organization.",
+			})
+			return
+		}
+
+		if scope(c, db, claims) {
+			c.Next()
+		}
+	}
+}
+
+// authorizeAdmin checks that the request carries adminToken as a bearer
+// token and records the admin as its verified actor, aborting otherwise.
+func authorizeAdmin(c *gin.Context, adminToken string) bool {
+	if adminToken == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Organization management is disabled.",
+		})
+		return false
+	}
+
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Admin token not valid.",
+		})
+		return false
+	}
+
+	c.Request = c.Request.WithContext(requestinfo.WithVerifiedActor(c.Request.Context(), adminActor))
+	return true
+}
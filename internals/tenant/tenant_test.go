@@ -0,0 +1,240 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"github.com/obimadu/ipc3-stage-2/internals/requestinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+// signToken returns an HS256 JWT with the given claims.
+func signToken(claims, secret string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	tests := []struct {
+		name      string
+		cfg       config.Tenant
+		headers   map[string]string
+		host      string
+		wantSlug  string
+		wantActor string
+		status    int
+	}{
+		{
+			name:     "header without a secret",
+			headers:  map[string]string{HeaderName: "acme"},
+			wantSlug: "acme",
+			status:   http.StatusOK,
+		},
+		{
+			name:     "subdomain without a secret",
+			cfg:      config.Tenant{BaseDomain: "users.example.com"},
+			host:     "acme.users.example.com:8080",
+			wantSlug: "acme",
+			status:   http.StatusOK,
+		},
+		{
+			name:   "nothing without a secret",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:     "token with a secret",
+			cfg:      config.Tenant{TokenSecret: "s3cret"},
+			headers:  map[string]string{"Authorization": "Bearer " + signToken(`{"org":"acme"}`, "s3cret"), HeaderName: "other"},
+			wantSlug: "acme",
+			status:   http.StatusOK,
+		},
+		{
+			name:      "token subject is the verified actor",
+			cfg:       config.Tenant{TokenSecret: "s3cret"},
+			headers:   map[string]string{"Authorization": "Bearer " + signToken(`{"org":"acme","sub":"jane"}`, "s3cret"), requestinfo.ActorHeader: "root"},
+			wantSlug:  "acme",
+			wantActor: "jane",
+			status:    http.StatusOK,
+		},
+		{
+			name:    "header without a token with a secret",
+			cfg:     config.Tenant{TokenSecret: "s3cret"},
+			headers: map[string]string{HeaderName: "other"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:   "subdomain without a token with a secret",
+			cfg:    config.Tenant{TokenSecret: "s3cret", BaseDomain: "users.example.com"},
+			host:   "other.users.example.com",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:    "token without an org claim",
+			cfg:     config.Tenant{TokenSecret: "s3cret"},
+			headers: map[string]string{"Authorization": "Bearer " + signToken(`{"sub":"jane"}`, "s3cret"), HeaderName: "other"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "token signed with another secret",
+			cfg:     config.Tenant{TokenSecret: "s3cret"},
+			headers: map[string]string{"Authorization": "Bearer " + signToken(`{"org":"other"}`, "guess")},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "expired token",
+			cfg:     config.Tenant{TokenSecret: "s3cret"},
+			headers: map[string]string{"Authorization": "Bearer " + signToken(`{"org":"acme","exp":1}`, "s3cret")},
+			status:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock := InitDB(t)
+			if test.wantSlug != "" {
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE slug = \$1`).
+					WithArgs(test.wantSlug, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).AddRow(7, "Acme", test.wantSlug))
+			}
+
+			r := gin.New()
+			r.GET("/api/users/", Middleware(db, test.cfg), func(c *gin.Context) {
+				orgID, _ := FromContext(c.Request.Context())
+				assert.Equal(t, uint(7), orgID)
+				wantActor := test.wantActor
+				if wantActor == "" {
+					wantActor = "system"
+				}
+				assert.Equal(t, wantActor, requestinfo.VerifiedActor(c.Request.Context()))
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/users/", nil)
+			if test.host != "" {
+				req.Host = test.host
+			}
+			for key, value := range test.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	tests := []struct {
+		name   string
+		cfg    config.Tenant
+		auth   string
+		status int
+	}{
+		{name: "admin token", cfg: config.Tenant{AdminToken: "adm1n"}, auth: "Bearer adm1n", status: http.StatusOK},
+		{name: "no token", cfg: config.Tenant{AdminToken: "adm1n"}, status: http.StatusUnauthorized},
+		{name: "wrong token", cfg: config.Tenant{AdminToken: "adm1n"}, auth: "Bearer admin", status: http.StatusUnauthorized},
+		{name: "tenant token", cfg: config.Tenant{AdminToken: "adm1n", TokenSecret: "s3cret"}, auth: "Bearer " + signToken(`{"org":"acme"}`, "s3cret"), status: http.StatusUnauthorized},
+		{name: "disabled", auth: "Bearer ", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/api/organizations/", AdminMiddleware(test.cfg), func(c *gin.Context) {
+				assert.Equal(t, adminActor, requestinfo.VerifiedActor(c.Request.Context()))
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/organizations/", nil)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
+
+func TestOrganizationAdminMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	cfg := config.Tenant{AdminToken: "adm1n", TokenSecret: "s3cret"}
+	tests := []struct {
+		name    string
+		cfg     config.Tenant
+		headers map[string]string
+		status  int
+	}{
+		{
+			name:    "admin token and header",
+			cfg:     cfg,
+			headers: map[string]string{"Authorization": "Bearer adm1n", HeaderName: "acme"},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "admin token without an organization",
+			cfg:     cfg,
+			headers: map[string]string{"Authorization": "Bearer adm1n"},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "tenant token",
+			cfg:     cfg,
+			headers: map[string]string{"Authorization": "Bearer " + signToken(`{"org":"acme","sub":"alice"}`, "s3cret"), HeaderName: "acme"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "disabled",
+			headers: map[string]string{HeaderName: "acme"},
+			status:  http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock := InitDB(t)
+			if test.status == http.StatusOK {
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE slug = \$1`).
+					WithArgs("acme", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).AddRow(7, "Acme", "acme"))
+			}
+
+			r := gin.New()
+			r.DELETE("/api/attributes/:name", OrganizationAdminMiddleware(db, test.cfg), func(c *gin.Context) {
+				orgID, _ := FromContext(c.Request.Context())
+				assert.Equal(t, uint(7), orgID)
+				assert.Equal(t, adminActor, requestinfo.VerifiedActor(c.Request.Context()))
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/attributes/team", nil)
+			for key, value := range test.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Package timeout bounds how long a request may take. The deadline is set on
+// the request context, which handlers pass to the database with
+// db.WithContext, so a slow query is cancelled instead of holding its
+// connection.
+package timeout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware sets a deadline on every request: the timeout of its route in
+// routes, keyed "METHOD /route" as in "GET /api/users/:userID", else
+// fallback. A zero timeout means none. Requests still running past their
+// deadline are answered 504.
+func Middleware(fallback time.Duration, routes map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := routes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			timeout = fallback
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		w := &writer{ResponseWriter: c.Writer, ctx: ctx, timeout: timeout}
+		c.Writer = w
+
+		c.Next()
+
+		// the handler gave up without answering
+		if !w.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			w.writeBody()
+		}
+	}
+}
+
+// writer turns the 500 a handler answers when its queries are cancelled by
+// the deadline into a 504 with an error saying so.
+type writer struct {
+	gin.ResponseWriter
+	ctx     context.Context
+	timeout time.Duration
+
+	timedOut bool
+	// body is whether the 504 body was written in place of the handler's
+	body bool
+}
+
+func (w *writer) WriteHeader(code int) {
+	if code >= http.StatusInternalServerError && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+		code = http.StatusGatewayTimeout
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writer) Write(data []byte) (int, error) {
+	if w.timedOut {
+		w.writeBody()
+		return len(data), nil
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *writer) WriteString(s string) (int, error) {
+	if w.timedOut {
+		w.writeBody()
+		return len(s), nil
+	}
+
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *writer) writeBody() {
+	if w.body {
+		return
+	}
+	w.timedOut, w.body = true, true
+
+	body, _ := json.Marshal(gin.H{
+		"status":  "error",
+		"message": "Request timed out.",
+		"error": gin.H{
+			"error":   context.DeadlineExceeded.Error(),
+			"timeout": w.timeout.String(),
+		},
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.Write(body)
+}
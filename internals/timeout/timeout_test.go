@@ -0,0 +1,134 @@
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestMiddleware(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unable to init mock db %s", err.Error())
+	}
+	defer dbMock.Close()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: dbMock}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to db; gorm; %s", err.Error())
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(Middleware(20*time.Millisecond, map[string]time.Duration{
+		"GET /stream": 0,
+		"GET /slow":   time.Second,
+	}))
+	// answers 500 when its query fails, as handlers do
+	r.GET("/organizations", func(c *gin.Context) {
+		orgs, err := models.GetOrganizations(db.WithContext(c.Request.Context()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to retrieve organizations."})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"organizations": orgs}})
+	})
+	r.GET("/silent", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+	deadline := func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			time.Sleep(40 * time.Millisecond)
+		}
+		c.Status(http.StatusNoContent)
+	}
+	r.GET("/stream", deadline)
+	r.GET("/slow", deadline)
+
+	tests := []struct {
+		name     string
+		url      string
+		query    time.Duration
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Fast query",
+			url:      "/organizations",
+			query:    time.Millisecond,
+			wantCode: http.StatusOK,
+			wantBody: `{"data":{"organizations":[{"id":1,"name":"Default","slug":"default"}]},"status":"success"}`,
+		},
+		{
+			name:     "Query cancelled at the deadline",
+			url:      "/organizations",
+			query:    time.Second,
+			wantCode: http.StatusGatewayTimeout,
+			wantBody: `{"error":{"error":"context deadline exceeded","timeout":"20ms"},"message":"Request timed out.","status":"error"}`,
+		},
+		{
+			name:     "Handler gave up without answering",
+			url:      "/silent",
+			wantCode: http.StatusGatewayTimeout,
+			wantBody: `{"error":{"error":"context deadline exceeded","timeout":"20ms"},"message":"Request timed out.","status":"error"}`,
+		},
+		{
+			name:     "Route without a timeout",
+			url:      "/stream",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Route with a longer timeout",
+			url:      "/slow",
+			wantCode: http.StatusNoContent,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.query > 0 {
+				mock.ExpectQuery(`SELECT \* FROM "organizations"`).
+					WillDelayFor(test.query).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).AddRow(1, "Default", "default"))
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.url, nil))
+
+			assert.Equal(t, test.wantCode, w.Code)
+			if test.wantBody != "" {
+				assert.JSONEq(t, test.wantBody, w.Body.String())
+			}
+			if test.wantCode == http.StatusGatewayTimeout {
+				assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareKeepsCancellation(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(Middleware(time.Minute, nil))
+	r.GET("/", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	// a client disconnecting cancels the request, which isn't a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -0,0 +1,23 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// probes are polled every few seconds and aren't worth a trace.
+var probes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// Middleware starts a server span named after the route template for every
+// request but the health probes, continuing the caller's trace, and puts it
+// in the request context for handlers to pass down.
+func Middleware(service string) gin.HandlerFunc {
+	return otelgin.Middleware(service, otelgin.WithFilter(func(r *http.Request) bool {
+		return !probes[r.URL.Path]
+	}))
+}
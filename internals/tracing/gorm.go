@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"errors"
+
+	"github.com/obimadu/ipc3-stage-2/internals/callbacks"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// spanKey holds a statement's span between the callbacks.
+const spanKey = "tracing:span"
+
+// Plugin records a client span for every GORM statement run under a span,
+// as its child, so handlers must pass the request context down with
+// db.WithContext. The SQL is recorded with placeholders, never values.
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "tracing"
+}
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	return callbacks.Around(db, "tracing", span)
+}
+
+func span(operation string) (before, after func(*gorm.DB)) {
+	before = func(db *gorm.DB) {
+		// background jobs polling outside any trace would start one each tick
+		if !trace.SpanContextFromContext(db.Statement.Context).IsValid() {
+			return
+		}
+		// the tracer is looked up each time, so the provider installed by
+		// Init is used even though the plugin is registered before it
+		_, span := otel.Tracer(instrumentation).Start(db.Statement.Context, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(system(db.Dialector.Name()), semconv.DBOperationName(operation)),
+		)
+		db.InstanceSet(spanKey, span)
+	}
+	after = func(db *gorm.DB) {
+		v, ok := db.InstanceGet(spanKey)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		defer span.End()
+
+		if db.Statement.Table != "" {
+			span.SetAttributes(semconv.DBCollectionName(db.Statement.Table))
+		}
+		if sql := db.Statement.SQL.String(); sql != "" {
+			span.SetAttributes(semconv.DBQueryText(sql))
+		}
+		span.SetAttributes(attribute.Int64("db.rows_affected", db.RowsAffected))
+
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(db.Error)
+			span.SetStatus(codes.Error, db.Error.Error())
+		}
+	}
+
+	return before, after
+}
+
+// system names the database the way OpenTelemetry does.
+func system(dialector string) attribute.KeyValue {
+	switch dialector {
+	case "postgres":
+		return semconv.DBSystemPostgreSQL
+	case "mysql":
+		return semconv.DBSystemMySQL
+	case "sqlite":
+		return semconv.DBSystemSqlite
+	default:
+		return semconv.DBSystemKey.String(dialector)
+	}
+}
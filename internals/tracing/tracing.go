@@ -0,0 +1,71 @@
+// Package tracing records OpenTelemetry spans for HTTP requests and GORM
+// statements, continuing traces from W3C traceparent headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/obimadu/ipc3-stage-2/internals/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const instrumentation = "github.com/obimadu/ipc3-stage-2/internals/tracing"
+
+// Init installs the W3C trace context propagator and, unless cfg.Exporter
+// is empty, a tracer provider exporting to the OTLP collector or stdout. The
+// returned func flushes pending spans and stops the exporter.
+func Init(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	// incoming trace ids are kept even when nothing is exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var processor sdktrace.SpanProcessor
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		opts := []otlptracegrpc.Option{}
+		if cfg.OTLPEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.OTLPEndpoint))
+		}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create OTLP exporter %w", err)
+		}
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("unable to create stdout exporter %w", err)
+		}
+		// spans are printed as they end, for local debugging
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to describe the service %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(processor),
+		// callers that sampled a trace keep it sampled
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
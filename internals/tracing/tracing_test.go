@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// record installs a tracer provider keeping spans in memory for the test.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(Middleware("users-api"))
+	var handlerSpan trace.SpanContext
+	r.GET("/api/users/:userID", func(c *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+	r.GET("/healthz", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "/api/users/:userID", span.Name())
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+		assert.True(t, span.Parent().IsRemote())
+		assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	recorder := record(t)
+
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unable to init mock db %s", err.Error())
+	}
+	defer dbMock.Close()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: dbMock}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to db; gorm; %s", err.Error())
+	}
+	if err := db.Use(Plugin{}); err != nil {
+		t.Fatalf("Unable to register the plugin %s", err.Error())
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE slug = \$1`).
+		WithArgs("acme", 1).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE slug = \$1`).
+		WithArgs("missing", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	models.GetOrganizationBySlug(db.WithContext(ctx), "acme")
+	models.GetOrganizationBySlug(db.WithContext(ctx), "missing")
+	parent.End()
+	// statements outside a trace, e.g. from background jobs, aren't traced
+	mock.ExpectQuery(`SELECT \* FROM "organizations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	models.GetOrganizations(db.WithContext(context.Background()))
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 3) {
+		failed, notFound := spans[0], spans[1]
+		for _, span := range []sdktrace.ReadOnlySpan{failed, notFound} {
+			assert.Equal(t, "gorm.query", span.Name())
+			assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+			assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+			assert.Contains(t, span.Attributes(), semconv.DBSystemPostgreSQL)
+			assert.Contains(t, span.Attributes(), semconv.DBCollectionName("organizations"))
+			assert.Contains(t, span.Attributes(), semconv.DBQueryText(`SELECT * FROM "organizations" WHERE slug = $1 ORDER BY "organizations"."id" LIMIT $2`))
+		}
+		assert.Equal(t, codes.Error, failed.Status().Code)
+		assert.Equal(t, "connection reset", failed.Status().Description)
+		// a record not found is an answer, not a failure
+		assert.Equal(t, codes.Unset, notFound.Status().Code)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
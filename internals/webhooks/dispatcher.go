@@ -0,0 +1,328 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/obimadu/ipc3-stage-2/internals/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Headers sent with every delivery. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// cursorName is the outbox consumer name of the dispatcher.
+const cursorName = "webhooks"
+
+// Dispatcher turns outbox events into deliveries for every subscribed webhook
+// and sends them, retrying failures with exponential backoff until
+// MaxAttempts, after which a delivery is dead-lettered.
+type Dispatcher struct {
+	DB          *gorm.DB
+	Client      *http.Client
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	BatchSize   int
+}
+
+// NewDispatcher returns a Dispatcher with the default retry policy: 8
+// attempts, backing off from 30 seconds up to an hour. Its client only
+// connects to public addresses, checked after DNS resolution so a webhook's
+// host can't be pointed at the API's own network once it was created. It
+// uses no proxy, which would connect on its behalf.
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   publicOnly,
+	}
+
+	return &Dispatcher{
+		DB: db,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		MaxAttempts: 8,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  time.Hour,
+		BatchSize:   100,
+	}
+}
+
+// publicOnly is a net.Dialer Control refusing connections to addresses that
+// aren't models.PublicAddr.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !models.PublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%s is not a public address", addrPort.Addr())
+	}
+
+	return nil
+}
+
+// Run fans out and delivers every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.FanOut(ctx); err != nil {
+				slog.ErrorContext(ctx, "Unable to queue webhook deliveries", "error", err)
+			}
+			if _, err := d.DeliverDue(ctx); err != nil {
+				slog.ErrorContext(ctx, "Unable to send webhook deliveries", "error", err)
+			}
+		}
+	}
+}
+
+// Flush queues deliveries for every new event and sends those due, e.g. for
+// the last requests before shutdown, stopping early when ctx is done.
+// Failed deliveries are retried by the next Run.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	for ctx.Err() == nil {
+		n, err := d.FanOut(ctx)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	for ctx.Err() == nil {
+		n, err := d.DeliverDue(ctx)
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// db works across every organization.
+func (d *Dispatcher) db(ctx context.Context) *gorm.DB {
+	return d.DB.WithContext(tenant.WithoutScope(ctx))
+}
+
+// FanOut creates a delivery for each new outbox event and each webhook
+// subscribed to it, and returns how many events it consumed.
+func (d *Dispatcher) FanOut(ctx context.Context) (int, error) {
+	consumed := 0
+	err := d.db(ctx).Transaction(func(tx *gorm.DB) error {
+		cursor, err := models.LockEventCursor(tx, cursorName)
+		if err != nil {
+			return err
+		}
+
+		events, err := models.GetPendingEvents(tx, cursor, d.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		orgIDs := make([]uint, 0, len(events))
+		for _, event := range events {
+			orgIDs = append(orgIDs, event.OrganizationID)
+		}
+		var webhooks []models.Webhooks
+		if err := tx.Where("organization_id IN ?", orgIDs).Find(&webhooks).Error; err != nil {
+			return err
+		}
+
+		var deliveries []models.WebhookDeliveries
+		now := time.Now()
+		for _, event := range events {
+			for _, webhook := range webhooks {
+				if webhook.OrganizationID != event.OrganizationID || !webhook.Subscribed(event.Type) {
+					continue
+				}
+				deliveries = append(deliveries, models.WebhookDeliveries{
+					OrganizationID: event.OrganizationID,
+					WebhookID:      webhook.ID,
+					EventID:        event.ID,
+					Status:         models.DeliveryPending,
+					NextAttemptAt:  now,
+				})
+			}
+		}
+		if len(deliveries) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error; err != nil {
+				return err
+			}
+		}
+
+		consumed = len(events)
+		cursor.Advance(models.EventIDs(events), now)
+		return models.SaveEventCursor(tx, cursor)
+	})
+
+	return consumed, err
+}
+
+// DeliverDue sends every pending delivery whose next attempt is due and
+// returns how many were attempted.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	db := d.db(ctx)
+
+	var due []models.WebhookDeliveries
+	err := db.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+		Order("next_attempt_at").
+		Limit(d.BatchSize).
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for _, delivery := range due {
+		claimed, err := d.claim(db, delivery)
+		if err != nil {
+			return attempted, err
+		}
+		if !claimed {
+			continue
+		}
+
+		attempted++
+		if err := d.attempt(ctx, db, delivery); err != nil {
+			return attempted, err
+		}
+	}
+
+	return attempted, nil
+}
+
+// claim pushes the delivery's next attempt past the request timeout so that
+// other instances skip it while this one sends it. It reports whether this
+// instance won the delivery.
+func (d *Dispatcher) claim(db *gorm.DB, delivery models.WebhookDeliveries) (bool, error) {
+	lease := time.Now().Add(d.Client.Timeout + time.Minute)
+	result := db.Model(&models.WebhookDeliveries{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, models.DeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", lease)
+
+	return result.RowsAffected == 1, result.Error
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, db *gorm.DB, delivery models.WebhookDeliveries) error {
+	var webhook models.Webhooks
+	if err := db.Where("id = ?", delivery.WebhookID).First(&webhook).Error; err != nil {
+		return err
+	}
+	var event models.Events
+	if err := db.Where("id = ?", delivery.EventID).First(&event).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]any{"attempts": delivery.Attempts + 1}
+	sendErr := d.send(ctx, &webhook, &event, delivery.ID)
+	switch {
+	case sendErr == nil:
+		updates["status"] = models.DeliveryDelivered
+		updates["delivered_at"] = now
+		updates["last_error"] = ""
+	case delivery.Attempts+1 >= d.MaxAttempts:
+		updates["status"] = models.DeliveryDead
+		updates["last_error"] = sendErr.Error()
+	default:
+		updates["next_attempt_at"] = now.Add(d.backoff(delivery.Attempts + 1))
+		updates["last_error"] = sendErr.Error()
+	}
+
+	return db.Model(&models.WebhookDeliveries{}).Where("id = ?", delivery.ID).Updates(updates).Error
+}
+
+// backoff is the wait after the given number of failed attempts:
+// BaseBackoff doubled for each attempt after the first, capped at MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.BaseBackoff
+	for i := 1; i < attempts && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	return min(wait, d.MaxBackoff)
+}
+
+// send POSTs the signed event to the webhook. Any non-2xx response is a
+// failure.
+func (d *Dispatcher) send(ctx context.Context, webhook *models.Webhooks, event *models.Events, deliveryID uint) error {
+	body, err := json.Marshal(map[string]any{
+		"id":         event.ID,
+		"type":       event.Type,
+		"created_at": event.CreatedAt,
+		"data":       event.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(deliveryID), 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the signature header value for a payload sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,126 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/obimadu/ipc3-stage-2/internals/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSendSignsPayload(t *testing.T) {
+	var received http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	// the test server listens on loopback
+	d := NewDispatcher(nil)
+	d.Client = server.Client()
+	webhook := &models.Webhooks{URL: server.URL, Secret: "whsec_test"}
+	event := &models.Events{ID: 9, Type: models.EventUserCreated, Data: models.Attributes{"user": map[string]any{"id": 1.0}}}
+
+	err := d.send(context.Background(), webhook, event, 3)
+	assert.NoError(t, err)
+
+	timestamp, err := strconv.ParseInt(received.Get(TimestampHeader), 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, Sign("whsec_test", timestamp, body), received.Get(SignatureHeader))
+	assert.Equal(t, models.EventUserCreated, received.Get(EventHeader))
+	assert.Equal(t, "3", received.Get(DeliveryHeader))
+
+	var payload map[string]any
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, 9.0, payload["id"])
+	assert.Equal(t, models.EventUserCreated, payload["type"])
+}
+
+func TestSendFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(nil)
+	d.Client = server.Client()
+	err := d.send(context.Background(), &models.Webhooks{URL: server.URL}, &models.Events{Type: models.EventUserDeleted}, 1)
+	assert.EqualError(t, err, "webhook responded 503 Service Unavailable")
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	// a name resolving to loopback, as after DNS rebinding
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	d := NewDispatcher(nil)
+	err := d.send(context.Background(), &models.Webhooks{URL: url}, &models.Events{Type: models.EventUserDeleted}, 1)
+	assert.ErrorContains(t, err, "is not a public address")
+	assert.False(t, called)
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseBackoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}
+
+	assert.Equal(t, 30*time.Second, d.backoff(1))
+	assert.Equal(t, time.Minute, d.backoff(2))
+	assert.Equal(t, 2*time.Minute, d.backoff(3))
+	assert.Equal(t, 4*time.Minute, d.backoff(4))
+	assert.Equal(t, 5*time.Minute, d.backoff(5))
+	assert.Equal(t, 5*time.Minute, d.backoff(20))
+}
+
+func TestFanOutEventsCommittedOutOfOrder(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Unable to open sqlite %s", err.Error())
+	}
+	if err := db.AutoMigrate(&models.Events{}, &models.EventCursors{}, &models.Webhooks{}, &models.WebhookDeliveries{}); err != nil {
+		t.Fatalf("Unable to migrate %s", err.Error())
+	}
+	assert.NoError(t, db.Create(&models.Webhooks{OrganizationID: 1, URL: "https://example.com", EventTypes: models.StringList{models.EventUserCreated}}).Error)
+
+	d := NewDispatcher(db)
+	commit := func(id uint) {
+		assert.NoError(t, db.Create(&models.Events{ID: id, OrganizationID: 1, Type: models.EventUserCreated, UserID: 1}).Error)
+	}
+	fanOut := func() int {
+		n, err := d.FanOut(context.Background())
+		assert.NoError(t, err)
+		return n
+	}
+	assert.Equal(t, 0, fanOut())
+
+	// 1 and 2 commit in order, 3 gets its ID before 4 but commits after it
+	commit(1)
+	commit(2)
+	commit(4)
+	assert.Equal(t, 3, fanOut())
+	commit(3)
+	assert.Equal(t, 1, fanOut())
+	assert.Equal(t, 0, fanOut())
+
+	var delivered []uint
+	assert.NoError(t, db.Model(&models.WebhookDeliveries{}).Order("event_id").Pluck("event_id", &delivered).Error)
+	assert.Equal(t, []uint{1, 2, 3, 4}, delivered)
+
+	var cursor models.EventCursors
+	assert.NoError(t, db.First(&cursor, "consumer = ?", cursorName).Error)
+	assert.Equal(t, uint(4), cursor.LastEventID)
+	assert.Empty(t, cursor.Gaps)
+}